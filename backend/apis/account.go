@@ -0,0 +1,48 @@
+package apis
+
+import "fmt"
+
+// minPasswordLength applies to passwords chosen through a reset or a change.
+const minPasswordLength = 8
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+
+	return nil
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (r *ResetPasswordRequest) Validate() error {
+	return validatePassword(r.Password)
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+func (r *ChangePasswordRequest) Validate() error {
+	if err := validatePassword(r.NewPassword); err != nil {
+		return err
+	}
+
+	if r.NewPassword == r.CurrentPassword {
+		return fmt.Errorf("new_password must differ from current_password")
+	}
+
+	return nil
+}
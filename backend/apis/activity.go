@@ -0,0 +1,21 @@
+package apis
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Activity struct {
+	ActivityID  string          `json:"activity_id"`
+	ItemID      string          `json:"item_id"`
+	IsDirectory bool            `json:"is_directory"`
+	Action      string          `json:"action"`
+	Actor       UserSummary     `json:"actor"`
+	Details     json.RawMessage `json:"details"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+type ListActivitiesResponse struct {
+	Activities []Activity `json:"activities"`
+	NextCursor string     `json:"next_cursor"`
+}
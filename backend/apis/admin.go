@@ -0,0 +1,56 @@
+package apis
+
+import (
+	"fmt"
+	"time"
+)
+
+type AdminUser struct {
+	UserID        string     `json:"user_id"`
+	Username      string     `json:"username"`
+	Email         string     `json:"email"`
+	EmailVerified bool       `json:"email_verified"`
+	Name          string     `json:"name"`
+	Role          string     `json:"role"`
+	DisabledAt    *time.Time `json:"disabled_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ListUsersResponse struct {
+	Users      []AdminUser `json:"users"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+type ImpersonateUserRequest struct {
+	// Reason is recorded in the audit log, such as the support ticket being worked on.
+	Reason string `json:"reason" binding:"required"`
+}
+
+func (r *ImpersonateUserRequest) Validate() error {
+	if r.Reason == "" {
+		return fmt.Errorf("reason is required")
+	}
+
+	return nil
+}
+
+// UpdateUserQuotaRequest sets the storage limits of a user in bytes. A null limit puts the
+// user back on the configured default, and 0 makes it unlimited.
+type UpdateUserQuotaRequest struct {
+	SoftLimitBytes *int64 `json:"soft_limit_bytes"`
+	HardLimitBytes *int64 `json:"hard_limit_bytes"`
+}
+
+func (r *UpdateUserQuotaRequest) Validate() error {
+	if r.SoftLimitBytes != nil && *r.SoftLimitBytes < 0 {
+		return fmt.Errorf("soft_limit_bytes cannot be negative")
+	}
+	if r.HardLimitBytes != nil && *r.HardLimitBytes < 0 {
+		return fmt.Errorf("hard_limit_bytes cannot be negative")
+	}
+	if r.SoftLimitBytes != nil && r.HardLimitBytes != nil && *r.HardLimitBytes > 0 && *r.SoftLimitBytes > *r.HardLimitBytes {
+		return fmt.Errorf("soft_limit_bytes cannot be above hard_limit_bytes")
+	}
+
+	return nil
+}
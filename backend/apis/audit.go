@@ -0,0 +1,23 @@
+package apis
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLog struct {
+	AuditLogID string          `json:"audit_log_id"`
+	ActorID    string          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   string          `json:"target_id"`
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	Metadata   json.RawMessage `json:"metadata"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+type ListAuditLogsResponse struct {
+	AuditLogs  []AuditLog `json:"audit_logs"`
+	NextCursor string     `json:"next_cursor"`
+}
@@ -0,0 +1,13 @@
+package apis
+
+// ItemResult reports the outcome of one item of a batch request such as a copy or a move.
+type ItemResult struct {
+	SourceID string         `json:"source_id"`
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name,omitempty"`
+	Error    *ErrorResponse `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	Results []ItemResult `json:"results"`
+}
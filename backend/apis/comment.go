@@ -0,0 +1,130 @@
+package apis
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// maxCommentLength bounds the body of a comment, in characters.
+const maxCommentLength = 10000
+
+type CommentAnnotation struct {
+	Region    *AnnotationRegion    `json:"region"`
+	TimeRange *AnnotationTimeRange `json:"time_range"`
+}
+
+// AnnotationRegion is a rectangle on an image, in fractions of its width and height from
+// its top left corner, so that it does not depend on the size the image is shown at.
+type AnnotationRegion struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// AnnotationTimeRange is a moment or, with End, a span of a video, in seconds from its start.
+type AnnotationTimeRange struct {
+	Start float64  `json:"start"`
+	End   *float64 `json:"end"`
+}
+
+func (a *CommentAnnotation) Validate() error {
+	switch {
+	case (a.Region == nil) == (a.TimeRange == nil):
+		return fmt.Errorf("an annotation has either a region or a time_range")
+	case a.Region != nil:
+		r := a.Region
+		if r.X < 0 || r.Y < 0 || r.Width <= 0 || r.Height <= 0 || r.X+r.Width > 1 || r.Y+r.Height > 1 {
+			return fmt.Errorf("region must lie within the image, in fractions of its width and height")
+		}
+	default:
+		t := a.TimeRange
+		if t.Start < 0 {
+			return fmt.Errorf("time_range start must not be negative")
+		}
+		if t.End != nil && *t.End <= t.Start {
+			return fmt.Errorf("time_range end must be after its start")
+		}
+	}
+
+	return nil
+}
+
+func validateCommentBody(body string) error {
+	if body == "" {
+		return fmt.Errorf("body is required")
+	}
+
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return fmt.Errorf("body must be at most %d characters", maxCommentLength)
+	}
+
+	return nil
+}
+
+type CreateCommentRequest struct {
+	Body string `json:"body" binding:"required"`
+	// ParentCommentID makes the comment a reply in the thread of that comment.
+	ParentCommentID string `json:"parent_comment_id"`
+	// FileVersionID pins a new thread to a version of the file.
+	FileVersionID string             `json:"file_version_id"`
+	Annotation    *CommentAnnotation `json:"annotation"`
+}
+
+func (r *CreateCommentRequest) Validate() error {
+	if err := validateCommentBody(r.Body); err != nil {
+		return err
+	}
+
+	if r.ParentCommentID != "" && (r.FileVersionID != "" || r.Annotation != nil) {
+		return fmt.Errorf("replies take the version and annotation of their thread")
+	}
+
+	if r.Annotation != nil {
+		return r.Annotation.Validate()
+	}
+
+	return nil
+}
+
+type UpdateCommentRequest struct {
+	Body string `json:"body" binding:"required"`
+	// Annotation replaces the annotation of a thread; leaving it out removes it.
+	Annotation *CommentAnnotation `json:"annotation"`
+}
+
+func (r *UpdateCommentRequest) Validate() error {
+	if err := validateCommentBody(r.Body); err != nil {
+		return err
+	}
+
+	if r.Annotation != nil {
+		return r.Annotation.Validate()
+	}
+
+	return nil
+}
+
+type Comment struct {
+	CommentID       string             `json:"comment_id"`
+	FileID          string             `json:"file_id"`
+	FileVersionID   string             `json:"file_version_id"`
+	ParentCommentID string             `json:"parent_comment_id"`
+	Author          UserSummary        `json:"author"`
+	Body            string             `json:"body"`
+	Mentions        []UserSummary      `json:"mentions"`
+	Annotation      *CommentAnnotation `json:"annotation"`
+	Resolved        bool               `json:"resolved"`
+	ResolvedAt      *time.Time         `json:"resolved_at"`
+	ResolvedBy      *UserSummary       `json:"resolved_by"`
+	Deleted         bool               `json:"deleted"`
+	CreatedAt       time.Time          `json:"created_at"`
+	UpdatedAt       time.Time          `json:"updated_at"`
+	// Replies is only set on the comment opening a thread.
+	Replies []Comment `json:"replies,omitempty"`
+}
+
+type ListCommentsResponse struct {
+	Threads []Comment `json:"threads"`
+}
@@ -1,10 +1,14 @@
 package apis
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 type CreateDirectoryRequest struct {
 	Name     string `json:"name"`
 	ParentID string `json:"parent_id"`
+	Conflict string `json:"conflict"`
 }
 
 type CreateDirectoryResponse struct {
@@ -12,7 +16,8 @@ type CreateDirectoryResponse struct {
 }
 
 type UpdateDirectoryRequest struct {
-	Name string `json:"name"`
+	Name     string `json:"name"`
+	Conflict string `json:"conflict"`
 }
 
 type UpdateDirectoryResponse struct {
@@ -22,15 +27,101 @@ type UpdateDirectoryResponse struct {
 type MoveDirectoriesRequest struct {
 	SourceDirectoryIDs     []string `json:"source_directory_ids"`
 	DestinationDirectoryID string   `json:"destination_directory_id"`
+	Conflict               string   `json:"conflict"`
+}
+
+type CopyDirectoriesRequest struct {
+	SourceDirectoryIDs     []string `json:"source_directory_ids"`
+	DestinationDirectoryID string   `json:"destination_directory_id"`
+	Conflict               string   `json:"conflict"`
+	IncludeVersions        bool     `json:"include_versions"`
 }
 
 type Directory struct {
 	DirectoryID       string    `json:"directory_id"`
 	Name              string    `json:"name"`
 	FullPath          string    `json:"full_path"`
+	DisplayPath       string    `json:"display_path"`
 	UserID            string    `json:"user_id"`
 	Level             int       `json:"level"`
 	ParentDirectoryID string    `json:"parent_directory_id"`
 	CreatedAt         time.Time `json:"created_at"`
 	UpdatedAt         time.Time `json:"updated_at"`
 }
+
+type Breadcrumb struct {
+	DirectoryID string `json:"directory_id"`
+	Name        string `json:"name"`
+}
+
+type BreadcrumbsResponse struct {
+	Breadcrumbs []Breadcrumb `json:"breadcrumbs"`
+	DisplayPath string       `json:"display_path"`
+}
+
+type ResolvePathResponse struct {
+	IsDirectory bool       `json:"is_directory"`
+	Directory   *Directory `json:"directory,omitempty"`
+	File        *File      `json:"file,omitempty"`
+}
+
+type DirectoryTreeNode struct {
+	DirectoryID       string              `json:"directory_id"`
+	Name              string              `json:"name"`
+	ParentDirectoryID string              `json:"parent_directory_id"`
+	Level             int                 `json:"level"`
+	FileCount         int64               `json:"file_count"`
+	TotalSize         int64               `json:"total_size"`
+	CreatedAt         time.Time           `json:"created_at"`
+	UpdatedAt         time.Time           `json:"updated_at"`
+	Children          []DirectoryTreeNode `json:"children"`
+}
+
+type FileOrFolder struct {
+	ID                  string    `json:"id"`
+	Name                string    `json:"name"`
+	ParentDirectoryID   string    `json:"parent_directory_id"`
+	IsDirectory         bool      `json:"is_directory"`
+	FullPath            string    `json:"full_path"`
+	Size                int64     `json:"size"`
+	MimeType            string    `json:"mime_type"`
+	Tags                []string  `json:"tags"`
+	LatestFileVersionID string    `json:"latest_file_version_id"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+type ListFilesOrFoldersResponse struct {
+	Items      []FileOrFolder `json:"items"`
+	NextCursor string         `json:"next_cursor"`
+	Total      int64          `json:"total"`
+}
+
+type UploadPolicy struct {
+	MaxFileSize       *int64   `json:"max_file_size"`
+	AllowedMimeTypes  []string `json:"allowed_mime_types"`
+	AllowedExtensions []string `json:"allowed_extensions"`
+	MaxFiles          *int     `json:"max_files"`
+	// RequireApproval keeps versions which are not approved from being shared publicly.
+	RequireApproval *bool `json:"require_approval"`
+}
+
+func (p *UploadPolicy) Validate() error {
+	if p.MaxFileSize != nil && *p.MaxFileSize <= 0 {
+		return errors.New("max_file_size must be positive")
+	}
+
+	if p.MaxFiles != nil && *p.MaxFiles <= 0 {
+		return errors.New("max_files must be positive")
+	}
+
+	return nil
+}
+
+type UploadPolicyResponse struct {
+	DirectoryID string `json:"directory_id"`
+	// Policy is what is set on the directory itself, Effective what applies to uploads
+	// into it once the policies of its ancestors are taken into account.
+	Policy    UploadPolicy `json:"policy"`
+	Effective UploadPolicy `json:"effective"`
+}
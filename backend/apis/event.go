@@ -0,0 +1,18 @@
+package apis
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event is the data of a change pushed by GET /events. The SSE event ID is its position in
+// the stream, to resume from with Last-Event-ID.
+type Event struct {
+	// EventID is the event_id of the webhook payloads announcing the same change.
+	EventID     string          `json:"event_id"`
+	Type        string          `json:"type"`
+	ActorID     string          `json:"actor_id"`
+	DirectoryID string          `json:"directory_id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Data        json.RawMessage `json:"data"`
+}
@@ -0,0 +1,18 @@
+package apis
+
+import "time"
+
+type FavoritesResponse struct {
+	Files       []File      `json:"files"`
+	Directories []Directory `json:"directories"`
+}
+
+type RecentActivity struct {
+	Action     string    `json:"action"`
+	AccessedAt time.Time `json:"accessed_at"`
+	File       File      `json:"file"`
+}
+
+type ListRecentActivitiesResponse struct {
+	Items []RecentActivity `json:"items"`
+}
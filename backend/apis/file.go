@@ -4,16 +4,30 @@ import "time"
 
 type UploadFileResponse struct {
 	FileVersionID string `json:"file_version_id"`
+	// QuotaWarning is set once the owner of the file is over their soft storage limit.
+	QuotaWarning bool `json:"quota_warning"`
 }
 
 type MoveFilesRequest struct {
 	SourceFileIDs          []string `json:"source_file_ids"`
 	DestinationDirectoryID string   `json:"destination_directory_id"`
+	Conflict               string   `json:"conflict"`
 }
 
+type CopyFilesRequest struct {
+	SourceFileIDs          []string `json:"source_file_ids"`
+	DestinationDirectoryID string   `json:"destination_directory_id"`
+	Conflict               string   `json:"conflict"`
+	IncludeVersions        bool     `json:"include_versions"`
+}
+
+// UpdateFileRequest changes the fields which are present and leaves the others as they are.
 type UpdateFileRequest struct {
-	Description string   `json:"description"`
-	Tags        []string `json:"tags"`
+	// Name renames the file when set.
+	Name        *string   `json:"name"`
+	Conflict    string    `json:"conflict"`
+	Description *string   `json:"description"`
+	Tags        *[]string `json:"tags"`
 }
 
 type ListFileVersions struct {
@@ -29,6 +43,7 @@ type File struct {
 	UserID      string    `json:"user_id"`
 	DirectoryID string    `json:"directory_id"`
 	FullPath    string    `json:"full_path"`
+	DisplayPath string    `json:"display_path"`
 	Description string    `json:"description"`
 	Tags        []string  `json:"tags"`
 	CreatedAt   time.Time `json:"created_at"`
@@ -41,6 +56,7 @@ type FileVersion struct {
 	Size          int64     `json:"size"`
 	Extension     string    `json:"extension"`
 	UserID        string    `json:"user_id"`
+	ReviewStatus  string    `json:"review_status"`
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -0,0 +1,66 @@
+package apis
+
+import (
+	"dam/enums"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// maxNotificationsPerRead bounds how many notifications one bulk read can name.
+const maxNotificationsPerRead = 100
+
+type Notification struct {
+	NotificationID string          `json:"notification_id"`
+	Type           string          `json:"type"`
+	Actor          UserSummary     `json:"actor"`
+	ItemID         string          `json:"item_id"`
+	IsDirectory    bool            `json:"is_directory"`
+	Details        json.RawMessage `json:"details"`
+	Read           bool            `json:"read"`
+	ReadAt         *time.Time      `json:"read_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+type ListNotificationsResponse struct {
+	Notifications []Notification `json:"notifications"`
+	UnreadCount   int64          `json:"unread_count"`
+	NextCursor    string         `json:"next_cursor"`
+}
+
+type ReadNotificationsRequest struct {
+	// NotificationIDs are the notifications to mark read. All unread notifications are
+	// marked read when All is set instead.
+	NotificationIDs []string `json:"notification_ids"`
+	All             bool     `json:"all"`
+}
+
+func (r *ReadNotificationsRequest) Validate() error {
+	if r.All == (len(r.NotificationIDs) > 0) {
+		return fmt.Errorf("either notification_ids or all is required")
+	}
+	if len(r.NotificationIDs) > maxNotificationsPerRead {
+		return fmt.Errorf("at most %d notification_ids are allowed", maxNotificationsPerRead)
+	}
+	return nil
+}
+
+type ReadNotificationsResponse struct {
+	// Marked is how many notifications were unread before.
+	Marked      int64 `json:"marked"`
+	UnreadCount int64 `json:"unread_count"`
+}
+
+type NotificationPreferences struct {
+	// Email are the notification types which are emailed as well.
+	Email []string `json:"email" binding:"required"`
+}
+
+func (r *NotificationPreferences) Validate() error {
+	for _, notificationType := range r.Email {
+		if !enums.NotificationType(notificationType).IsValid() {
+			return fmt.Errorf("notification type %q is invalid", notificationType)
+		}
+	}
+	return nil
+}
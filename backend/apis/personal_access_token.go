@@ -0,0 +1,55 @@
+package apis
+
+import (
+	"dam/enums"
+	"fmt"
+	"time"
+)
+
+type CreatePersonalAccessTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresAt is optional; tokens without it never expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (r *CreatePersonalAccessTokenRequest) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+
+	if len(r.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, scope := range r.Scopes {
+		if !enums.Scope(scope).IsValid() {
+			return fmt.Errorf("scope %q is invalid", scope)
+		}
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+
+	return nil
+}
+
+type PersonalAccessToken struct {
+	PersonalAccessTokenID string     `json:"personal_access_token_id"`
+	Name                  string     `json:"name"`
+	Scopes                []string   `json:"scopes"`
+	ExpiresAt             *time.Time `json:"expires_at"`
+	LastUsedAt            *time.Time `json:"last_used_at"`
+	CreatedAt             time.Time  `json:"created_at"`
+}
+
+type CreatePersonalAccessTokenResponse struct {
+	PersonalAccessToken
+	// Token is only returned here and cannot be retrieved again.
+	Token string `json:"token"`
+}
+
+type ListPersonalAccessTokensResponse struct {
+	Tokens []PersonalAccessToken `json:"tokens"`
+}
@@ -0,0 +1,68 @@
+package apis
+
+import (
+	"dam/enums"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// maxReviewers bounds how many reviewers one file version can be submitted to.
+const maxReviewers = 20
+
+type RequestReviewRequest struct {
+	ReviewerIDs []string `json:"reviewer_ids" binding:"required"`
+}
+
+func (r *RequestReviewRequest) Validate() error {
+	if len(r.ReviewerIDs) == 0 || len(r.ReviewerIDs) > maxReviewers {
+		return fmt.Errorf("between 1 and %d reviewers are required", maxReviewers)
+	}
+	return nil
+}
+
+type DecideReviewRequest struct {
+	Decision string `json:"decision" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+func (r *DecideReviewRequest) Validate() error {
+	if r.Decision != string(enums.ReviewDecisionApproved) && r.Decision != string(enums.ReviewDecisionChangesRequested) {
+		return fmt.Errorf("decision must be %s or %s", enums.ReviewDecisionApproved, enums.ReviewDecisionChangesRequested)
+	}
+	if utf8.RuneCountInString(r.Comment) > maxCommentLength {
+		return fmt.Errorf("comment must be at most %d characters", maxCommentLength)
+	}
+	return nil
+}
+
+type VersionReview struct {
+	Reviewer    UserSummary `json:"reviewer"`
+	RequestedBy UserSummary `json:"requested_by"`
+	Decision    string      `json:"decision"`
+	Comment     string      `json:"comment"`
+	RequestedAt time.Time   `json:"requested_at"`
+	DecidedAt   *time.Time  `json:"decided_at"`
+}
+
+type VersionReviewsResponse struct {
+	FileID        string          `json:"file_id"`
+	FileVersionID string          `json:"file_version_id"`
+	ReviewStatus  string          `json:"review_status"`
+	Reviews       []VersionReview `json:"reviews"`
+}
+
+// PendingReview is a review the current user was asked for and has not answered yet.
+type PendingReview struct {
+	FileID        string      `json:"file_id"`
+	FileName      string      `json:"file_name"`
+	FileVersionID string      `json:"file_version_id"`
+	Uploader      UserSummary `json:"uploader"`
+	RequestedBy   UserSummary `json:"requested_by"`
+	RequestedAt   time.Time   `json:"requested_at"`
+}
+
+type ListPendingReviewsResponse struct {
+	Reviews    []PendingReview `json:"reviews"`
+	NextCursor string          `json:"next_cursor"`
+}
@@ -0,0 +1,55 @@
+package apis
+
+import "fmt"
+
+// TwoFactorChallengeResponse is returned by login instead of tokens when the user has to
+// present a second factor, or set one up first when EnrollmentRequired is set.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired  bool   `json:"two_factor_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ChallengeToken     string `json:"challenge_token"`
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+type TwoFactorStatusResponse struct {
+	Enabled           bool  `json:"enabled"`
+	Required          bool  `json:"required"`
+	RecoveryCodesLeft int64 `json:"recovery_codes_left"`
+}
+
+type EnrollTOTPResponse struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type ConfirmTOTPRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// TwoFactorVerificationRequest proves the second factor with either a code of the
+// authenticator app or a recovery code.
+type TwoFactorVerificationRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+func (r *TwoFactorVerificationRequest) Validate() error {
+	if (r.Code == "") == (r.RecoveryCode == "") {
+		return fmt.Errorf("either code or recovery_code is required")
+	}
+
+	return nil
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type EnrollLoginTOTPRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+}
+
+type VerifyLoginTwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	TwoFactorVerificationRequest
+}
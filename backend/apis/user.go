@@ -1,6 +1,9 @@
 package apis
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 type CreateUserRequest struct {
 	Username string `json:"username" binding:"required"`
@@ -33,13 +36,21 @@ type CreateUserResponse struct {
 	UserID string `json:"user_id"`
 }
 
-type GetUserResponse struct {
+// UserSummary names a user wherever the API shows who did something.
+type UserSummary struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
-	Email    string `json:"email"`
 	Name     string `json:"name"`
 }
 
+type GetUserResponse struct {
+	UserID        string `json:"user_id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
 type UpdateUserRequest struct {
 	Name string `json:"name"`
 }
@@ -51,10 +62,52 @@ type UpdateUserResponse struct {
 type LoginRequest struct {
 	Email    string `json:"email" binding:"required"`
 	Password string `json:"password" binding:"required"`
+	// Device is a name the client gives itself, shown in the list of sessions.
+	Device string `json:"device"`
 }
 
 type LoginResponse struct {
-	Token     string `json:"token"`
-	Type      string `json:"type"`
-	ExpiresIn int    `json:"expires_in"`
+	Token        string `json:"token"`
+	Type         string `json:"type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	SessionID    string `json:"session_id"`
+	// RecoveryCodes is only set when the second factor was set up while logging in.
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type Session struct {
+	SessionID string `json:"session_id"`
+	Device    string `json:"device"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Current   bool   `json:"current"`
+	// Impersonated sessions were opened by an admin for support.
+	Impersonated bool      `json:"impersonated"`
+	CreatedAt    time.Time `json:"created_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []Session `json:"sessions"`
+}
+
+type StorageUsageBreakdown struct {
+	Key       string `json:"key"`
+	Name      string `json:"name"`
+	UsedBytes int64  `json:"used_bytes"`
+}
+
+type StorageUsageResponse struct {
+	UsedBytes        int64                   `json:"used_bytes"`
+	SoftLimitBytes   int64                   `json:"soft_limit_bytes"`
+	HardLimitBytes   int64                   `json:"hard_limit_bytes"`
+	SoftLimitReached bool                    `json:"soft_limit_reached"`
+	ByDirectory      []StorageUsageBreakdown `json:"by_directory"`
+	ByMimeFamily     []StorageUsageBreakdown `json:"by_mime_family"`
 }
@@ -0,0 +1,94 @@
+package apis
+
+import (
+	"dam/enums"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// maxWebhookURLLength keeps webhook URLs to what HTTP servers reliably accept.
+const maxWebhookURLLength = 2048
+
+type WebhookRequest struct {
+	URL    string   `json:"url" binding:"required"`
+	Events []string `json:"events" binding:"required"`
+	// Description tells webhooks apart, such as "CMS" or "Slack bot".
+	Description string `json:"description"`
+	// Active is optional; webhooks are on unless it is false.
+	Active *bool `json:"active"`
+}
+
+func (r *WebhookRequest) Validate() error {
+	if len(r.URL) > maxWebhookURLLength {
+		return fmt.Errorf("url must be at most %d characters", maxWebhookURLLength)
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	if u.User != nil {
+		return fmt.Errorf("url must not hold credentials, requests are signed instead")
+	}
+
+	if len(r.Events) == 0 {
+		return fmt.Errorf("at least one event is required")
+	}
+	for _, event := range r.Events {
+		if !enums.WebhookEvent(event).IsValid() {
+			return fmt.Errorf("event %q is invalid", event)
+		}
+	}
+
+	return nil
+}
+
+type Webhook struct {
+	WebhookID   string    `json:"webhook_id"`
+	URL         string    `json:"url"`
+	Events      []string  `json:"events"`
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type CreateWebhookResponse struct {
+	Webhook
+	// Secret signs the deliveries. It is only returned here and cannot be retrieved again.
+	Secret string `json:"secret"`
+}
+
+type ListWebhooksResponse struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+type WebhookDelivery struct {
+	WebhookDeliveryID string          `json:"webhook_delivery_id"`
+	EventType         string          `json:"event_type"`
+	Payload           json.RawMessage `json:"payload"`
+	Status            string          `json:"status"`
+	Attempts          int             `json:"attempts"`
+	NextAttemptAt     *time.Time      `json:"next_attempt_at"`
+	ResponseStatus    *int            `json:"response_status"`
+	ResponseBody      string          `json:"response_body"`
+	Error             string          `json:"error"`
+	CreatedAt         time.Time       `json:"created_at"`
+	UpdatedAt         time.Time       `json:"updated_at"`
+}
+
+type ListWebhookDeliveriesResponse struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"next_cursor"`
+}
+
+// WebhookPayload is the body of every webhook delivery.
+type WebhookPayload struct {
+	// EventID is the same for every delivery of an event, for receivers to skip duplicates.
+	EventID   string          `json:"event_id"`
+	Type      string          `json:"type"`
+	ActorID   string          `json:"actor_id"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
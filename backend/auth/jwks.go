@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+// JWK is the public part of a verification key as described by RFC 7517.
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	// RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519 and EC keys
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+	Y     string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// jwk returns the JWK of key, or false for symmetric keys which must never be published.
+func jwk(key *Key) (JWK, bool) {
+	encode := base64.RawURLEncoding.EncodeToString
+	switch publicKey := key.VerifyKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			KeyType:   "RSA",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+			N:         encode(publicKey.N.Bytes()),
+			E:         encode(big.NewInt(int64(publicKey.E)).Bytes()),
+		}, true
+	case ed25519.PublicKey:
+		return JWK{
+			KeyType:   "OKP",
+			KeyID:     key.ID,
+			Use:       "sig",
+			Algorithm: key.Method.Alg(),
+			Curve:     "Ed25519",
+			X:         encode(publicKey),
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// parseJWK returns the kid and public key of a signing key published by another issuer.
+// RSA and EC keys are supported.
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var key JWK
+	if err := json.Unmarshal(raw, &key); err != nil {
+		return "", nil, err
+	}
+	if key.Use != "" && key.Use != "sig" {
+		return "", nil, fmt.Errorf("key %q is not a signing key", key.KeyID)
+	}
+
+	decode := base64.RawURLEncoding.DecodeString
+	switch key.KeyType {
+	case "RSA":
+		n, err := decode(key.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(key.E)
+		if err != nil {
+			return "", nil, err
+		}
+		return key.KeyID, &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch key.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("unsupported curve %q", key.Curve)
+		}
+		x, err := decode(key.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(key.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		return key.KeyID, &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %q", key.KeyType)
+	}
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"dam/config"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Every login attempt counts against the IP it comes from under loginAttemptsIPKey. Wrong
+// passwords count against the account under loginFailuresKey, which slows down further
+// attempts and eventually locks the account for a while under loginLockKey.
+const (
+	loginAttemptsIPKeyPrefix = "login_attempts:ip:"
+	loginFailuresKeyPrefix   = "login_failures:"
+	loginLockKeyPrefix       = "login_lock:"
+)
+
+var ErrLoginThrottled = errors.New("too many login attempts")
+
+// checkLoginScript counts an attempt from an IP and returns how many milliseconds the
+// client has to wait before it may try again, 0 when it may try now.
+var checkLoginScript = redis.NewScript(`
+local attempts = redis.call('INCR', KEYS[1])
+if attempts == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+if attempts > tonumber(ARGV[1]) then
+	local ttl = redis.call('PTTL', KEYS[1])
+	if ttl < 0 then
+		return tonumber(ARGV[2])
+	end
+	return ttl
+end
+
+local lockTTL = redis.call('PTTL', KEYS[3])
+if lockTTL > 0 then
+	return lockTTL
+end
+
+local failures = tonumber(redis.call('HGET', KEYS[2], 'failures') or '0')
+local excess = failures - tonumber(ARGV[4])
+if excess > 0 then
+	local delay = math.min(tonumber(ARGV[5]) * 2 ^ (excess - 1), tonumber(ARGV[6]))
+	local wait = tonumber(redis.call('HGET', KEYS[2], 'last_failure_at')) + delay - tonumber(ARGV[3])
+	if wait > 0 then
+		return wait
+	end
+end
+return 0
+`)
+
+// recordLoginFailureScript counts a wrong password and locks the account once there were
+// too many, returning 1 when it did.
+var recordLoginFailureScript = redis.NewScript(`
+local failures = redis.call('HINCRBY', KEYS[1], 'failures', 1)
+redis.call('HSET', KEYS[1], 'last_failure_at', ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+if failures >= tonumber(ARGV[3]) then
+	redis.call('SET', KEYS[2], '1', 'PX', ARGV[4])
+	redis.call('DEL', KEYS[1])
+	return 1
+end
+return 0
+`)
+
+// LoginThrottle protects password logins against guessing, per IP and per account.
+// Accounts are keyed by the email address tried, whether it has an account or not, so
+// that throttling does not tell them apart.
+type LoginThrottle struct {
+	rdClient *redis.Client
+	cfg      *config.LoginThrottleConfig
+}
+
+func NewLoginThrottle(rdClient *redis.Client, cfg *config.LoginThrottleConfig) *LoginThrottle {
+	return &LoginThrottle{
+		rdClient: rdClient,
+		cfg:      cfg,
+	}
+}
+
+// Allow records a login attempt for email from ip. It returns ErrLoginThrottled and how
+// long to wait when the attempt must be refused.
+func (t *LoginThrottle) Allow(ctx context.Context, ip, email string) (time.Duration, error) {
+	keys := []string{
+		loginAttemptsIPKeyPrefix + ip,
+		loginFailuresKeyPrefix + normalizeEmail(email),
+		loginLockKeyPrefix + normalizeEmail(email),
+	}
+	wait, err := checkLoginScript.Run(ctx, t.rdClient, keys,
+		t.cfg.MaxAttemptsPerIP,
+		t.cfg.IPWindow.Milliseconds(),
+		time.Now().UnixMilli(),
+		t.cfg.FreeFailures,
+		t.cfg.BaseDelay.Milliseconds(),
+		t.cfg.MaxDelay.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		return time.Duration(wait) * time.Millisecond, ErrLoginThrottled
+	}
+	return 0, nil
+}
+
+// RecordFailure counts a failed login for email and reports whether it locked the account.
+func (t *LoginThrottle) RecordFailure(ctx context.Context, email string) (bool, error) {
+	keys := []string{
+		loginFailuresKeyPrefix + normalizeEmail(email),
+		loginLockKeyPrefix + normalizeEmail(email),
+	}
+	locked, err := recordLoginFailureScript.Run(ctx, t.rdClient, keys,
+		time.Now().UnixMilli(),
+		t.cfg.FailureWindow.Milliseconds(),
+		t.cfg.LockoutThreshold,
+		t.cfg.LockoutDuration.Milliseconds(),
+	).Int()
+	return locked == 1, err
+}
+
+// RecordSuccess forgets the failed logins of email.
+func (t *LoginThrottle) RecordSuccess(ctx context.Context, email string) error {
+	return t.rdClient.Del(ctx, loginFailuresKeyPrefix+normalizeEmail(email)).Err()
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"dam/config"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	oidcStateKeyPrefix = "oidc_state:"
+	// oidcStateTTL is how long a user has to log in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// oidcKeysRefreshInterval limits how often an unknown kid makes us fetch the keys of
+	// the provider again.
+	oidcKeysRefreshInterval = time.Minute
+)
+
+var (
+	ErrInvalidOIDCState = errors.New("invalid or expired OIDC state")
+	ErrInvalidIDToken   = errors.New("invalid ID token")
+)
+
+// oidcSigningMethods are the algorithms ID tokens are accepted with. Symmetric algorithms
+// and none are never accepted.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type oidcState struct {
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+}
+
+// audience accepts the aud claim both as a single string and as a list.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// IDTokenClaims are the claims of an ID token used to find or provision the user.
+type IDTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	AuthorizedParty   string   `json:"azp"`
+	ExpiresAt         int64    `json:"exp"`
+	IssuedAt          int64    `json:"iat"`
+	NotBefore         int64    `json:"nbf"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	Name              string   `json:"name"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Valid is left to verifyIDToken, which knows the expected issuer, audience and nonce.
+func (c *IDTokenClaims) Valid() error {
+	return nil
+}
+
+// OIDCProvider logs users in with the authorization code flow and PKCE. The endpoints and
+// keys of the provider are discovered on first use rather than at startup, so that the API
+// still starts while the provider is down.
+type OIDCProvider struct {
+	cfg        *config.OIDCConfig
+	rdClient   *redis.Client
+	httpClient *http.Client
+
+	mu            sync.Mutex
+	discovery     *oidcDiscovery
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+func NewOIDCProvider(cfg *config.OIDCConfig, rdClient *redis.Client, httpClient *http.Client) *OIDCProvider {
+	return &OIDCProvider{
+		cfg:        cfg,
+		rdClient:   rdClient,
+		httpClient: httpClient,
+	}
+}
+
+// StartLogin returns the URL of the provider to send the user to. The state, nonce and
+// PKCE verifier of the attempt are kept in Redis until FinishLogin.
+func (p *OIDCProvider) StartLogin(ctx context.Context) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	secrets := make([]string, 3)
+	for i := range secrets {
+		if secrets[i], err = randomToken(); err != nil {
+			return "", err
+		}
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+
+	data, err := json.Marshal(oidcState{Nonce: nonce, CodeVerifier: codeVerifier})
+	if err != nil {
+		return "", err
+	}
+	if err := p.rdClient.Set(ctx, oidcStateKeyPrefix+state, data, oidcStateTTL).Err(); err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	authURL, err := url.Parse(discovery.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+	for key, values := range authURL.Query() {
+		query[key] = values
+	}
+	authURL.RawQuery = query.Encode()
+	return authURL.String(), nil
+}
+
+// FinishLogin exchanges the code the provider redirected back with and returns the claims
+// of the verified ID token. Each state can only be used once.
+func (p *OIDCProvider) FinishLogin(ctx context.Context, code, state string) (*IDTokenClaims, error) {
+	data, err := p.rdClient.GetDel(ctx, oidcStateKeyPrefix+state).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, ErrInvalidOIDCState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var loginState oidcState
+	if err := json.Unmarshal(data, &loginState); err != nil {
+		return nil, err
+	}
+
+	idToken, err := p.exchangeCode(ctx, code, loginState.CodeVerifier)
+	if err != nil {
+		return nil, err
+	}
+	return p.verifyIDToken(ctx, idToken, loginState.Nonce)
+}
+
+func (p *OIDCProvider) exchangeCode(ctx context.Context, code, codeVerifier string) (string, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	var tokenResp struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResp); err != nil {
+		return "", fmt.Errorf("decode token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token endpoint returned %d: %s %s", resp.StatusCode, tokenResp.Error, tokenResp.ErrorDescription)
+	}
+	if tokenResp.IDToken == "" {
+		return "", fmt.Errorf("%w: token response has no id_token", ErrInvalidIDToken)
+	}
+	return tokenResp.IDToken, nil
+}
+
+// verifyIDToken checks the signature of idToken against the keys of the provider and its
+// iss, aud, azp, exp, iat, nbf and nonce claims.
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	parser := &jwt.Parser{ValidMethods: oidcSigningMethods}
+	_, err := parser.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.getKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIDToken, err.Error())
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.cfg.IssuerURL:
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, claims.Issuer)
+	case !slices.Contains(claims.Audience, p.cfg.ClientID):
+		return nil, fmt.Errorf("%w: not issued for this client", ErrInvalidIDToken)
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID:
+		return nil, fmt.Errorf("%w: unexpected authorized party", ErrInvalidIDToken)
+	case claims.ExpiresAt == 0 || now.Add(-clockSkew).Unix() >= claims.ExpiresAt:
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidIDToken)
+	case claims.IssuedAt == 0 || now.Add(clockSkew).Unix() < claims.IssuedAt:
+		return nil, fmt.Errorf("%w: token was issued in the future", ErrInvalidIDToken)
+	case claims.NotBefore != 0 && now.Add(clockSkew).Unix() < claims.NotBefore:
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidIDToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%w: missing subject", ErrInvalidIDToken)
+	}
+	return claims, nil
+}
+
+func (p *OIDCProvider) getDiscovery(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+
+	discovery := &oidcDiscovery{}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.cfg.IssuerURL, "/")+"/.well-known/openid-configuration", discovery); err != nil {
+		return nil, fmt.Errorf("discover OIDC provider: %w", err)
+	}
+	if discovery.Issuer != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("discover OIDC provider: issuer %q does not match %q", discovery.Issuer, p.cfg.IssuerURL)
+	}
+	p.discovery = discovery
+	return discovery, nil
+}
+
+// getKey returns the verification key kid of the provider, fetching the keys again when
+// kid is unknown since the provider may have rotated them.
+func (p *OIDCProvider) getKey(ctx context.Context, kid string) (interface{}, error) {
+	discovery, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+
+	var jwks struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.getJSON(ctx, discovery.JWKSURI, &jwks); err != nil {
+		return nil, fmt.Errorf("fetch OIDC keys: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(jwks.Keys))
+	for _, raw := range jwks.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			// Keys we cannot use, such as encryption keys, are skipped.
+			continue
+		}
+		keys[id] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	return key, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,391 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"dam/config"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	testClientID    = "dam"
+	testRedirectURL = "https://dam.example/api/v1/auth/oidc/callback"
+	testSigningKey  = "test-key"
+)
+
+// fakeOIDCProvider is an identity provider which authorizes every login, so that tests
+// only have to follow the redirect to it with authorize.
+type fakeOIDCProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// issuer is what discovery claims the issuer is, the URL of the server unless set.
+	issuer string
+	// claims adjusts the claims of the ID tokens issued from then on.
+	claims func(claims jwt.MapClaims)
+
+	mu             sync.Mutex
+	authorizations map[string]fakeAuthorization
+}
+
+// fakeAuthorization is what the provider remembers about a code until it is exchanged.
+type fakeAuthorization struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %s", err)
+	}
+	p := &fakeOIDCProvider{
+		t:              t,
+		key:            key,
+		authorizations: map[string]fakeAuthorization{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// newProvider returns an OIDCProvider for the fake, keeping its state in a fake Redis.
+func (p *fakeOIDCProvider) newProvider() *OIDCProvider {
+	return NewOIDCProvider(&config.OIDCConfig{
+		IssuerURL:   p.server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+		Scopes:      []string{"openid", "email", "profile"},
+	}, newTestRedis(p.t), p.server.Client())
+}
+
+// authorize plays the user logging in at authURL and returns the code and state the
+// provider redirects back with.
+func (p *fakeOIDCProvider) authorize(authURL string) (string, string) {
+	p.t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatalf("parse authorization URL: %s", err)
+	}
+	query := u.Query()
+	for key, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"code_challenge_method": "S256",
+	} {
+		if got := query.Get(key); got != want {
+			p.t.Fatalf("authorization URL has %s %q, want %q", key, got, want)
+		}
+	}
+	if query.Get("state") == "" || query.Get("nonce") == "" || query.Get("code_challenge") == "" {
+		p.t.Fatalf("authorization URL lacks state, nonce or code_challenge: %s", authURL)
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		p.t.Fatalf("random code: %s", err)
+	}
+	p.mu.Lock()
+	p.authorizations[code] = fakeAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	p.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (p *fakeOIDCProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	issuer := p.issuer
+	if issuer == "" {
+		issuer = p.server.URL
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 issuer,
+		"authorization_endpoint": p.server.URL + "/authorize",
+		"token_endpoint":         p.server.URL + "/token",
+		"jwks_uri":               p.server.URL + "/jwks",
+	})
+}
+
+func (p *fakeOIDCProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	key, _ := jwk(&Key{ID: testSigningKey, Method: jwt.SigningMethodRS256, VerifyKey: &p.key.PublicKey})
+	writeJSON(w, http.StatusOK, JWKS{Keys: []JWK{key}})
+}
+
+// token exchanges a code once, and only with the verifier matching its challenge.
+func (p *fakeOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("client_id") != testClientID ||
+		r.PostForm.Get("redirect_uri") != testRedirectURL {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	code := r.PostForm.Get("code")
+	p.mu.Lock()
+	authorization, ok := p.authorizations[code]
+	delete(p.authorizations, code)
+	p.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	verifier := r.PostForm.Get("code_verifier")
+	challenge := sha256.Sum256([]byte(verifier))
+	if len(verifier) < 43 || base64.RawURLEncoding.EncodeToString(challenge[:]) != authorization.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "code_verifier mismatch"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            "subject-1",
+		"aud":            testClientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          authorization.nonce,
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"name":           "Ada Lovelace",
+	}
+	if p.claims != nil {
+		p.claims(claims)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testSigningKey
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Errorf("sign ID token: %s", err)
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": idToken, "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeOIDCProvider(t)
+	provider := fake.newProvider()
+
+	authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+	if !strings.HasPrefix(authURL, fake.server.URL+"/authorize?") {
+		t.Fatalf("StartLogin redirects to %s, want the discovered authorization endpoint", authURL)
+	}
+
+	code, state := fake.authorize(authURL)
+	claims, err := provider.FinishLogin(ctx, code, state)
+	if err != nil {
+		t.Fatalf("FinishLogin: %s", err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "ada@example.com" || !claims.EmailVerified {
+		t.Errorf("FinishLogin returned %+v", claims)
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	fake := newFakeOIDCProvider(t)
+	fake.issuer = "https://idp.example"
+	provider := fake.newProvider()
+
+	_, err := provider.StartLogin(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Fatalf("StartLogin returned %v, want an issuer mismatch", err)
+	}
+}
+
+func TestOIDCStartLoginUsesFreshSecrets(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeOIDCProvider(t)
+	provider := fake.newProvider()
+
+	first, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+	second, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+
+	firstQuery, _ := url.ParseQuery(first[strings.Index(first, "?")+1:])
+	secondQuery, _ := url.ParseQuery(second[strings.Index(second, "?")+1:])
+	for _, key := range []string{"state", "nonce", "code_challenge"} {
+		if firstQuery.Get(key) == secondQuery.Get(key) {
+			t.Errorf("two logins share their %s", key)
+		}
+	}
+}
+
+func TestOIDCStateIsSingleUse(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeOIDCProvider(t)
+	provider := fake.newProvider()
+
+	authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+	code, state := fake.authorize(authURL)
+	if _, err := provider.FinishLogin(ctx, code, state); err != nil {
+		t.Fatalf("FinishLogin: %s", err)
+	}
+
+	// Even a fresh code does not make the state usable again.
+	code, _ = fake.authorize(authURL)
+	if _, err := provider.FinishLogin(ctx, code, state); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("FinishLogin with a used state returned %v, want %v", err, ErrInvalidOIDCState)
+	}
+	if _, err := provider.FinishLogin(ctx, code, "unknown"); !errors.Is(err, ErrInvalidOIDCState) {
+		t.Errorf("FinishLogin with an unknown state returned %v, want %v", err, ErrInvalidOIDCState)
+	}
+}
+
+func TestOIDCCodeVerifierMismatch(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeOIDCProvider(t)
+	provider := fake.newProvider()
+
+	// The code was issued to another login, whose challenge the verifier of this one does
+	// not match.
+	otherURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+	code, _ := fake.authorize(otherURL)
+	authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+	_, state := fake.authorize(authURL)
+
+	_, err = provider.FinishLogin(ctx, code, state)
+	if err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Fatalf("FinishLogin returned %v, want the provider to reject the verifier", err)
+	}
+}
+
+func TestOIDCIDTokenValidation(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims func(claims jwt.MapClaims)
+		reason string
+	}{
+		{
+			name:   "nonce mismatch",
+			claims: func(claims jwt.MapClaims) { claims["nonce"] = "other" },
+			reason: "nonce mismatch",
+		},
+		{
+			name:   "other issuer",
+			claims: func(claims jwt.MapClaims) { claims["iss"] = "https://idp.example" },
+			reason: "unexpected issuer",
+		},
+		{
+			name:   "other audience",
+			claims: func(claims jwt.MapClaims) { claims["aud"] = "other-client" },
+			reason: "not issued for this client",
+		},
+		{
+			name:   "several audiences without azp",
+			claims: func(claims jwt.MapClaims) { claims["aud"] = []string{testClientID, "other-client"} },
+			reason: "unexpected authorized party",
+		},
+		{
+			name: "several audiences with another azp",
+			claims: func(claims jwt.MapClaims) {
+				claims["aud"] = []string{testClientID, "other-client"}
+				claims["azp"] = "other-client"
+			},
+			reason: "unexpected authorized party",
+		},
+		{
+			name:   "expired",
+			claims: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-time.Minute).Unix() },
+			reason: "token is expired",
+		},
+		{
+			name:   "issued in the future",
+			claims: func(claims jwt.MapClaims) { claims["iat"] = time.Now().Add(time.Hour).Unix() },
+			reason: "issued in the future",
+		},
+		{
+			name:   "not valid yet",
+			claims: func(claims jwt.MapClaims) { claims["nbf"] = time.Now().Add(time.Hour).Unix() },
+			reason: "not valid yet",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newFakeOIDCProvider(t)
+			fake.claims = tt.claims
+			provider := fake.newProvider()
+
+			authURL, err := provider.StartLogin(ctx)
+			if err != nil {
+				t.Fatalf("StartLogin: %s", err)
+			}
+			code, state := fake.authorize(authURL)
+
+			_, err = provider.FinishLogin(ctx, code, state)
+			if !errors.Is(err, ErrInvalidIDToken) || !strings.Contains(err.Error(), tt.reason) {
+				t.Errorf("FinishLogin returned %v, want %v for %s", err, ErrInvalidIDToken, tt.reason)
+			}
+		})
+	}
+}
+
+func TestOIDCAcceptsAuthorizedPartyAmongAudiences(t *testing.T) {
+	ctx := context.Background()
+	fake := newFakeOIDCProvider(t)
+	fake.claims = func(claims jwt.MapClaims) {
+		claims["aud"] = []string{"other-client", testClientID}
+		claims["azp"] = testClientID
+	}
+	provider := fake.newProvider()
+
+	authURL, err := provider.StartLogin(ctx)
+	if err != nil {
+		t.Fatalf("StartLogin: %s", err)
+	}
+	code, state := fake.authorize(authURL)
+	if _, err := provider.FinishLogin(ctx, code, state); err != nil {
+		t.Fatalf("FinishLogin: %s", err)
+	}
+}
@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"context"
+	"dam/config"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Password reset requests count against the IP they come from under
+// passwordResetsIPKey and against the address they name under passwordResetsEmailKey.
+const (
+	passwordResetsIPKeyPrefix    = "password_resets:ip:"
+	passwordResetsEmailKeyPrefix = "password_resets:email:"
+)
+
+var ErrPasswordResetThrottled = errors.New("too many password reset requests")
+
+// checkPasswordResetScript counts a request from an IP and, unless the IP is over its
+// limit, for an address. It returns how many milliseconds the client has to wait before
+// it may ask again, 0 when the request may go ahead.
+var checkPasswordResetScript = redis.NewScript(`
+local function count(key, limit, window)
+	local requests = redis.call('INCR', key)
+	if requests == 1 then
+		redis.call('PEXPIRE', key, window)
+	end
+	if requests > tonumber(limit) then
+		local ttl = redis.call('PTTL', key)
+		if ttl < 0 then
+			return tonumber(window)
+		end
+		return ttl
+	end
+	return 0
+end
+
+local wait = count(KEYS[1], ARGV[1], ARGV[2])
+if wait > 0 then
+	return wait
+end
+return count(KEYS[2], ARGV[3], ARGV[4])
+`)
+
+// PasswordResetThrottle keeps password reset requests from flooding inboxes or probing
+// the mail server. Addresses are keyed whether they have an account or not, so that
+// throttling does not tell them apart.
+type PasswordResetThrottle struct {
+	rdClient *redis.Client
+	cfg      *config.PasswordResetThrottleConfig
+}
+
+func NewPasswordResetThrottle(rdClient *redis.Client, cfg *config.PasswordResetThrottleConfig) *PasswordResetThrottle {
+	return &PasswordResetThrottle{
+		rdClient: rdClient,
+		cfg:      cfg,
+	}
+}
+
+// Allow records a password reset request for email from ip. It returns
+// ErrPasswordResetThrottled and how long to wait when the request must be refused.
+func (t *PasswordResetThrottle) Allow(ctx context.Context, ip, email string) (time.Duration, error) {
+	keys := []string{
+		passwordResetsIPKeyPrefix + ip,
+		passwordResetsEmailKeyPrefix + normalizeEmail(email),
+	}
+	wait, err := checkPasswordResetScript.Run(ctx, t.rdClient, keys,
+		t.cfg.MaxRequestsPerIP,
+		t.cfg.IPWindow.Milliseconds(),
+		t.cfg.MaxRequestsPerEmail,
+		t.cfg.EmailWindow.Milliseconds(),
+	).Int64()
+	if err != nil {
+		return 0, err
+	}
+	if wait > 0 {
+		return time.Duration(wait) * time.Millisecond, ErrPasswordResetThrottled
+	}
+	return 0, nil
+}
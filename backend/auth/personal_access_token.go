@@ -0,0 +1,22 @@
+package auth
+
+import "strings"
+
+// PersonalAccessTokenPrefix tells personal access tokens apart from session JWTs, and makes
+// them easy to spot by secret scanners.
+const PersonalAccessTokenPrefix = "dam_pat_"
+
+// NewPersonalAccessToken returns a new token and the hash it is stored under. The token
+// itself is only ever shown to its owner once.
+func NewPersonalAccessToken() (string, string, error) {
+	random, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	token := PersonalAccessTokenPrefix + random
+	return token, HashToken(token), nil
+}
+
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
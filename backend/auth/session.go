@@ -0,0 +1,336 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// A session lives in Redis as a hash under sessionKey, listed in the set under
+// userSessionsKey so that all sessions of a user can be found. Its current refresh token
+// points back to it from refreshTokenKey; exchanged refresh tokens move to
+// usedRefreshTokenKey until they would have expired, to detect reuse.
+const (
+	sessionKeyPrefix          = "session:"
+	userSessionsKeyPrefix     = "user_sessions:"
+	refreshTokenKeyPrefix     = "refresh_token:"
+	usedRefreshTokenKeyPrefix = "used_refresh_token:"
+)
+
+// rotateRefreshTokenAttempts bounds how often a rotation is retried while its session keeps
+// being written to.
+const rotateRefreshTokenAttempts = 5
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrSessionNotFound     = errors.New("session not found")
+)
+
+// touchSessionScript updates last_seen_at of a session and returns its user, without
+// recreating a session which was revoked in the meantime.
+var touchSessionScript = redis.NewScript(`
+local userID = redis.call('HGET', KEYS[1], 'user_id')
+if userID then
+	redis.call('HSET', KEYS[1], 'last_seen_at', ARGV[1])
+end
+return userID
+`)
+
+type Session struct {
+	SessionID  string
+	UserID     string
+	Device     string
+	IP         string
+	UserAgent  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	// ImpersonatorID is set on sessions an admin opened as UserID, for support.
+	ImpersonatorID string
+	// refreshTokenHash identifies the current refresh token so that it can be dropped
+	// together with the session.
+	refreshTokenHash string
+}
+
+// SessionStore keeps the sessions of logged in users. Access tokens carry the ID of their
+// session and are only accepted while it exists, so revoking a session logs it out.
+type SessionStore struct {
+	rdClient        *redis.Client
+	refreshTokenTTL time.Duration
+}
+
+func NewSessionStore(rdClient *redis.Client, refreshTokenTTL time.Duration) *SessionStore {
+	return &SessionStore{
+		rdClient:        rdClient,
+		refreshTokenTTL: refreshTokenTTL,
+	}
+}
+
+// CreateSession starts a session for session.UserID and returns its first refresh token.
+func (s *SessionStore) CreateSession(ctx context.Context, session *Session) (string, error) {
+	refreshToken, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	session.SessionID = uuid.New().String()
+	session.CreatedAt = now
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(s.refreshTokenTTL)
+	session.refreshTokenHash = HashToken(refreshToken)
+
+	_, err = s.rdClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		s.saveSession(ctx, pipe, session)
+		return nil
+	})
+	return refreshToken, err
+}
+
+// RotateRefreshToken exchanges refreshToken for a new one and extends its session. A
+// refresh token can only be exchanged once: presenting it again means it leaked, so the
+// whole session is revoked and ErrRefreshTokenReused returned.
+func (s *SessionStore) RotateRefreshToken(ctx context.Context, refreshToken, ip, userAgent string) (*Session, string, error) {
+	hash := HashToken(refreshToken)
+	newRefreshToken, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	// The token is only consumed by a transaction which also rotates it. One which fails
+	// because the session was touched meanwhile has consumed nothing and is retried; after
+	// a concurrent exchange of the same token, the retry finds it gone.
+	var session *Session
+	for attempt := 0; attempt < rotateRefreshTokenAttempts; attempt++ {
+		session, err = s.rotateRefreshToken(ctx, hash, newRefreshToken, ip, userAgent)
+		if !errors.Is(err, redis.TxFailedErr) {
+			break
+		}
+	}
+	if errors.Is(err, redis.Nil) {
+		return nil, "", s.handleUnknownRefreshToken(ctx, hash)
+	}
+	if errors.Is(err, ErrSessionNotFound) || errors.Is(err, redis.TxFailedErr) {
+		return nil, "", ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return session, newRefreshToken, nil
+}
+
+// rotateRefreshToken replaces the refresh token hashed to hash by newRefreshToken in one
+// transaction, watching both the token and its session. It returns redis.Nil for an unknown
+// token and redis.TxFailedErr when either changed before the transaction ran.
+func (s *SessionStore) rotateRefreshToken(ctx context.Context, hash, newRefreshToken, ip, userAgent string) (*Session, error) {
+	var session *Session
+	err := s.rdClient.Watch(ctx, func(tx *redis.Tx) error {
+		sessionID, err := tx.Get(ctx, refreshTokenKeyPrefix+hash).Result()
+		if err != nil {
+			return err
+		}
+		if err := tx.Watch(ctx, sessionKeyPrefix+sessionID).Err(); err != nil {
+			return err
+		}
+		current, err := getSession(ctx, tx, sessionID)
+		if err != nil {
+			return err
+		}
+		session = current
+
+		now := time.Now()
+		session.IP = ip
+		session.UserAgent = userAgent
+		session.LastSeenAt = now
+		session.ExpiresAt = now.Add(s.refreshTokenTTL)
+		session.refreshTokenHash = HashToken(newRefreshToken)
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, refreshTokenKeyPrefix+hash)
+			pipe.Set(ctx, usedRefreshTokenKeyPrefix+hash, sessionID, s.refreshTokenTTL)
+			s.saveSession(ctx, pipe, session)
+			return nil
+		})
+		return err
+	}, refreshTokenKeyPrefix+hash)
+	return session, err
+}
+
+func (s *SessionStore) handleUnknownRefreshToken(ctx context.Context, hash string) error {
+	sessionID, err := s.rdClient.Get(ctx, usedRefreshTokenKeyPrefix+hash).Result()
+	if errors.Is(err, redis.Nil) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	session, err := getSession(ctx, s.rdClient, sessionID)
+	if errors.Is(err, ErrSessionNotFound) {
+		return ErrRefreshTokenReused
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.DeleteSession(ctx, session.UserID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// TouchSession records that sessionID was just used and returns the user it belongs to, or
+// ErrSessionNotFound once it was revoked or expired.
+func (s *SessionStore) TouchSession(ctx context.Context, sessionID string) (string, error) {
+	userID, err := touchSessionScript.Run(ctx, s.rdClient, []string{sessionKeyPrefix + sessionID}, time.Now().Unix()).Text()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrSessionNotFound
+	}
+	return userID, err
+}
+
+// ListSessions returns the active sessions of userID, most recently used first.
+func (s *SessionStore) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	sessionIDs, err := s.rdClient.SMembers(ctx, userSessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := make([]Session, 0, len(sessionIDs))
+	for _, sessionID := range sessionIDs {
+		session, err := getSession(ctx, s.rdClient, sessionID)
+		if errors.Is(err, ErrSessionNotFound) {
+			// The session expired, so it only has to be forgotten.
+			if err := s.rdClient.SRem(ctx, userSessionsKeyPrefix+userID, sessionID).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].LastSeenAt.After(sessions[j].LastSeenAt)
+	})
+	return sessions, nil
+}
+
+// DeleteSession revokes sessionID if it belongs to userID.
+func (s *SessionStore) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	session, err := getSession(ctx, s.rdClient, sessionID)
+	if err != nil {
+		return err
+	}
+	if session.UserID != userID {
+		return ErrSessionNotFound
+	}
+
+	_, err = s.rdClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, sessionKeyPrefix+sessionID, refreshTokenKeyPrefix+session.refreshTokenHash)
+		pipe.SRem(ctx, userSessionsKeyPrefix+userID, sessionID)
+		return nil
+	})
+	return err
+}
+
+// DeleteUserSessions revokes every session of userID.
+func (s *SessionStore) DeleteUserSessions(ctx context.Context, userID string) error {
+	if err := s.DeleteOtherSessions(ctx, userID, ""); err != nil {
+		return err
+	}
+	return s.rdClient.Del(ctx, userSessionsKeyPrefix+userID).Err()
+}
+
+// DeleteOtherSessions revokes every session of userID except keepSessionID.
+func (s *SessionStore) DeleteOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	sessionIDs, err := s.rdClient.SMembers(ctx, userSessionsKeyPrefix+userID).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if sessionID == keepSessionID {
+			continue
+		}
+		if err := s.DeleteSession(ctx, userID, sessionID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SessionStore) saveSession(ctx context.Context, pipe redis.Pipeliner, session *Session) {
+	key := sessionKeyPrefix + session.SessionID
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"user_id":            session.UserID,
+		"device":             session.Device,
+		"ip":                 session.IP,
+		"user_agent":         session.UserAgent,
+		"created_at":         session.CreatedAt.Unix(),
+		"last_seen_at":       session.LastSeenAt.Unix(),
+		"expires_at":         session.ExpiresAt.Unix(),
+		"refresh_token_hash": session.refreshTokenHash,
+		"impersonator_id":    session.ImpersonatorID,
+	})
+	pipe.ExpireAt(ctx, key, session.ExpiresAt)
+	pipe.Set(ctx, refreshTokenKeyPrefix+session.refreshTokenHash, session.SessionID, s.refreshTokenTTL)
+	// Every write pushes the expiry of the set past that of all the sessions in it.
+	pipe.SAdd(ctx, userSessionsKeyPrefix+session.UserID, session.SessionID)
+	pipe.Expire(ctx, userSessionsKeyPrefix+session.UserID, s.refreshTokenTTL)
+}
+
+func getSession(ctx context.Context, rdClient redis.Cmdable, sessionID string) (*Session, error) {
+	fields, err := rdClient.HGetAll(ctx, sessionKeyPrefix+sessionID).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrSessionNotFound
+	}
+
+	return &Session{
+		SessionID:        sessionID,
+		UserID:           fields["user_id"],
+		Device:           fields["device"],
+		IP:               fields["ip"],
+		UserAgent:        fields["user_agent"],
+		CreatedAt:        parseUnix(fields["created_at"]),
+		LastSeenAt:       parseUnix(fields["last_seen_at"]),
+		ExpiresAt:        parseUnix(fields["expires_at"]),
+		ImpersonatorID:   fields["impersonator_id"],
+		refreshTokenHash: fields["refresh_token_hash"],
+	}, nil
+}
+
+func parseUnix(s string) time.Time {
+	sec, _ := strconv.ParseInt(s, 10, 64)
+	return time.Unix(sec, 0)
+}
+
+// randomToken returns 256 random bits, encoded to be safe in URLs.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken is how refresh and personal access tokens are stored, so that reading the
+// stores is not enough to use them.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"dam/config"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// clockSkew is how far the clocks of the servers issuing and checking a token may drift.
+const clockSkew = 30 * time.Second
+
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	UserID    string `json:"userID"`
+	SessionID string `json:"sid"`
+	// ImpersonatorID is the admin acting as UserID, for support.
+	ImpersonatorID string `json:"imp,omitempty"`
+	jwt.StandardClaims
+}
+
+// TokenManager signs access tokens with the current key and verifies them with any of the
+// active keys, picked by the kid header.
+type TokenManager struct {
+	signingKey       *Key
+	verificationKeys map[string]*Key
+	issuer           string
+	audience         string
+	accessTokenTTL   time.Duration
+}
+
+func NewTokenManager(cfg *config.AuthConfig) (*TokenManager, error) {
+	var signingKey *Key
+	var err error
+	switch cfg.Algorithm {
+	case jwt.SigningMethodHS256.Alg():
+		signingKey, err = newSecretKey(cfg.KeyID, cfg.Secret)
+	case jwt.SigningMethodRS256.Alg(), signingMethodEdDSA.Alg():
+		signingKey, err = loadPrivateKey(cfg.KeyID, cfg.Algorithm, cfg.PrivateKeyFile)
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", cfg.Algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	verificationKeys := map[string]*Key{signingKey.ID: signingKey}
+	for id, path := range cfg.VerificationKeyFiles {
+		if id == signingKey.ID {
+			return nil, fmt.Errorf("verification key %q reuses the kid of the signing key", id)
+		}
+		key, err := loadPublicKey(id, path)
+		if err != nil {
+			return nil, err
+		}
+		verificationKeys[id] = key
+	}
+
+	return &TokenManager{
+		signingKey:       signingKey,
+		verificationKeys: verificationKeys,
+		issuer:           cfg.Issuer,
+		audience:         cfg.Audience,
+		accessTokenTTL:   cfg.AccessTokenTTL,
+	}, nil
+}
+
+func (m *TokenManager) AccessTokenTTL() time.Duration {
+	return m.accessTokenTTL
+}
+
+// IssueAccessToken signs a token for the user of session which stays valid while the
+// session is active.
+func (m *TokenManager) IssueAccessToken(session *Session) (string, error) {
+	now := time.Now()
+	token := jwt.NewWithClaims(m.signingKey.Method, &Claims{
+		UserID:         session.UserID,
+		SessionID:      session.SessionID,
+		ImpersonatorID: session.ImpersonatorID,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   session.UserID,
+			Issuer:    m.issuer,
+			Audience:  m.audience,
+			IssuedAt:  now.Unix(),
+			NotBefore: now.Unix(),
+			ExpiresAt: now.Add(m.accessTokenTTL).Unix(),
+		},
+	})
+	token.Header["kid"] = m.signingKey.ID
+	return token.SignedString(m.signingKey.SignKey)
+}
+
+// ParseAccessToken verifies the signature of tokenStr and its iss, aud, exp and nbf claims,
+// all of which are required.
+func (m *TokenManager) ParseAccessToken(tokenStr string) (*Claims, error) {
+	claims := &Claims{}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err := parser.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := m.verificationKeys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown kid %q", kid)
+		}
+		// The algorithm is bound to the key, never taken from the token, so that a token
+		// cannot pick a weaker way to be checked.
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %q", token.Method.Alg())
+		}
+		return key.VerifyKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err.Error())
+	}
+
+	now := time.Now()
+	switch {
+	case !claims.VerifyIssuer(m.issuer, true):
+		return nil, fmt.Errorf("%w: unexpected issuer", ErrInvalidToken)
+	case !claims.VerifyAudience(m.audience, true):
+		return nil, fmt.Errorf("%w: unexpected audience", ErrInvalidToken)
+	case !claims.VerifyExpiresAt(now.Add(-clockSkew).Unix(), true):
+		return nil, fmt.Errorf("%w: token is expired", ErrInvalidToken)
+	case !claims.VerifyNotBefore(now.Add(clockSkew).Unix(), true):
+		return nil, fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+	case claims.UserID == "" || claims.SessionID == "":
+		return nil, fmt.Errorf("%w: missing user or session", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// JWKS returns the public keys tokens can currently be verified with. It is empty when
+// tokens are signed with HS256.
+func (m *TokenManager) JWKS() JWKS {
+	ids := make([]string, 0, len(m.verificationKeys))
+	for id := range m.verificationKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jwks := JWKS{Keys: []JWK{}}
+	for _, id := range ids {
+		if key, ok := jwk(m.verificationKeys[id]); ok {
+			jwks.Keys = append(jwks.Keys, key)
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	twoFactorChallengeKeyPrefix = "2fa_challenge:"
+	// maxTwoFactorAttempts is how many wrong codes a challenge survives.
+	maxTwoFactorAttempts = 5
+)
+
+var ErrInvalidTwoFactorChallenge = errors.New("invalid or expired two-factor challenge")
+
+// recordFailedAttemptScript counts a wrong code and drops the challenge after too many,
+// without recreating a challenge which expired in the meantime.
+var recordFailedAttemptScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+if redis.call('HINCRBY', KEYS[1], 'attempts', 1) >= tonumber(ARGV[1]) then
+	redis.call('DEL', KEYS[1])
+end
+return 1
+`)
+
+// TwoFactorChallenge is a login which passed its first factor and waits for the second.
+// Enrollment is set when the user has no second factor yet but is required to set one up.
+type TwoFactorChallenge struct {
+	UserID     string
+	Device     string
+	Enrollment bool
+}
+
+// TwoFactorChallengeStore keeps challenges in Redis, keyed by the hash of their token.
+type TwoFactorChallengeStore struct {
+	rdClient *redis.Client
+	ttl      time.Duration
+}
+
+func NewTwoFactorChallengeStore(rdClient *redis.Client, ttl time.Duration) *TwoFactorChallengeStore {
+	return &TwoFactorChallengeStore{
+		rdClient: rdClient,
+		ttl:      ttl,
+	}
+}
+
+func (s *TwoFactorChallengeStore) TTL() time.Duration {
+	return s.ttl
+}
+
+// CreateChallenge returns the token the client answers challenge with.
+func (s *TwoFactorChallengeStore) CreateChallenge(ctx context.Context, challenge *TwoFactorChallenge) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	key := twoFactorChallengeKeyPrefix + HashToken(token)
+	_, err = s.rdClient.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, key, map[string]interface{}{
+			"user_id":    challenge.UserID,
+			"device":     challenge.Device,
+			"enrollment": challenge.Enrollment,
+			"attempts":   0,
+		})
+		pipe.Expire(ctx, key, s.ttl)
+		return nil
+	})
+	return token, err
+}
+
+func (s *TwoFactorChallengeStore) GetChallenge(ctx context.Context, token string) (*TwoFactorChallenge, error) {
+	fields, err := s.rdClient.HGetAll(ctx, twoFactorChallengeKeyPrefix+HashToken(token)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		return nil, ErrInvalidTwoFactorChallenge
+	}
+
+	enrollment, _ := strconv.ParseBool(fields["enrollment"])
+	return &TwoFactorChallenge{
+		UserID:     fields["user_id"],
+		Device:     fields["device"],
+		Enrollment: enrollment,
+	}, nil
+}
+
+// RecordFailedAttempt counts a wrong code, dropping the challenge once too many were
+// tried so that codes cannot be guessed.
+func (s *TwoFactorChallengeStore) RecordFailedAttempt(ctx context.Context, token string) error {
+	key := twoFactorChallengeKeyPrefix + HashToken(token)
+	return recordFailedAttemptScript.Run(ctx, s.rdClient, []string{key}, maxTwoFactorAttempts).Err()
+}
+
+func (s *TwoFactorChallengeStore) DeleteChallenge(ctx context.Context, token string) error {
+	return s.rdClient.Del(ctx, twoFactorChallengeKeyPrefix+HashToken(token)).Err()
+}
@@ -0,0 +1,11 @@
+package auth
+
+// NewUserToken returns a single-use token to email to a user and the hash it is stored
+// under.
+func NewUserToken() (string, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, HashToken(token), nil
+}
@@ -3,10 +3,17 @@ package config
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type ApplicationConfig struct {
 	Port string
+	// CaseInsensitiveNames makes "Photo.jpg" and "photo.jpg" conflict within the same directory.
+	CaseInsensitiveNames bool
+	// PublicURL is where the web app is served, links in emails point to it.
+	PublicURL string
 }
 
 type DatabaseConfig struct {
@@ -30,17 +37,130 @@ func (d *RedisConfig) Addr() string {
 	return fmt.Sprintf("%s:%s", d.Host, d.Port)
 }
 
+// QuotaConfig holds the storage limits in bytes. Zero means unlimited.
+type QuotaConfig struct {
+	// DefaultSoftLimit and DefaultHardLimit apply to users without their own limits.
+	DefaultSoftLimit int64
+	DefaultHardLimit int64
+	// WorkspaceHardLimit caps the bytes stored by all users together.
+	WorkspaceHardLimit int64
+}
+
+// AuthConfig describes how access tokens are signed and verified.
+type AuthConfig struct {
+	// Algorithm is HS256, RS256 or EdDSA.
+	Algorithm string
+	// KeyID is put in the kid header of every token signed with the current key.
+	KeyID string
+	// Secret is the HS256 key. RS256 and EdDSA read a PEM private key from PrivateKeyFile.
+	Secret         string
+	PrivateKeyFile string
+	// VerificationKeyFiles maps the kid of retired keys to PEM public key files, so that
+	// tokens signed before a rotation stay valid until they expire.
+	VerificationKeyFiles map[string]string
+	Issuer               string
+	Audience             string
+	AccessTokenTTL       time.Duration
+	// RefreshTokenTTL is how long a session lasts without being refreshed.
+	RefreshTokenTTL time.Duration
+}
+
+// OIDCConfig describes the OpenID Connect provider users can log in with. Single sign-on
+// is disabled when IssuerURL is empty.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is where the provider sends users back to, it must route to the
+	// callback endpoint.
+	RedirectURL string
+	Scopes      []string
+}
+
+type TwoFactorConfig struct {
+	// Policy is optional, admins or all, see enums.TwoFactorPolicy.
+	Policy string
+	// Issuer names the account in authenticator apps.
+	Issuer       string
+	ChallengeTTL time.Duration
+}
+
+// AccountConfig holds how long the links emailed to users stay valid.
+type AccountConfig struct {
+	EmailVerificationTTL time.Duration
+	PasswordResetTTL     time.Duration
+}
+
+// MailConfig describes the SMTP server emails are sent through. Emails are only kept in
+// memory when Host is empty.
+type MailConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// LoginThrottleConfig limits password logins. Every attempt counts against the IP it comes
+// from; failures count against the account, delaying the next attempt more and more after
+// the free ones until the account is locked.
+type LoginThrottleConfig struct {
+	MaxAttemptsPerIP int64
+	IPWindow         time.Duration
+	FreeFailures     int64
+	BaseDelay        time.Duration
+	MaxDelay         time.Duration
+	// FailureWindow is how long failures are remembered after the last one.
+	FailureWindow    time.Duration
+	LockoutThreshold int64
+	LockoutDuration  time.Duration
+}
+
+// PasswordResetThrottleConfig limits password reset requests, which email whoever owns the
+// address. Every request counts against the IP it comes from and the address it names.
+type PasswordResetThrottleConfig struct {
+	MaxRequestsPerIP    int64
+	IPWindow            time.Duration
+	MaxRequestsPerEmail int64
+	EmailWindow         time.Duration
+}
+
+// WebhookConfig controls how webhook deliveries are made. A failed delivery is retried
+// after BaseDelay, doubling up to MaxDelay, until MaxAttempts.
+type WebhookConfig struct {
+	PollInterval time.Duration
+	Timeout      time.Duration
+	MaxAttempts  int64
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	// AllowPrivateTargets lets webhooks post to loopback and private addresses, which is
+	// only meant for development.
+	AllowPrivateTargets bool
+}
+
 type Config struct {
-	Database    *DatabaseConfig
-	Redis       *RedisConfig
-	Application *ApplicationConfig
+	Database      *DatabaseConfig
+	Redis         *RedisConfig
+	Application   *ApplicationConfig
+	Quota         *QuotaConfig
+	Auth          *AuthConfig
+	OIDC          *OIDCConfig
+	TwoFactor     *TwoFactorConfig
+	Account       *AccountConfig
+	Mail          *MailConfig
+	Login         *LoginThrottleConfig
+	PasswordReset *PasswordResetThrottleConfig
+	Webhook       *WebhookConfig
 }
 
 var Cfg Config
 
 func LoadConfig() {
+	caseInsensitiveNames, _ := strconv.ParseBool(os.Getenv("DAM_CASE_INSENSITIVE_NAMES"))
 	ApplicationConfig := ApplicationConfig{
-		Port: os.Getenv("DAM_PORT"),
+		Port:                 os.Getenv("DAM_PORT"),
+		CaseInsensitiveNames: caseInsensitiveNames,
+		PublicURL:            strings.TrimSuffix(getEnv("DAM_PUBLIC_URL", "http://localhost:3000"), "/"),
 	}
 
 	dbConfig := DatabaseConfig{
@@ -56,9 +176,131 @@ func LoadConfig() {
 		Port: os.Getenv("DAM_REDIS_PORT"),
 	}
 
+	quotaConfig := QuotaConfig{
+		DefaultSoftLimit:   parseInt64(os.Getenv("DAM_QUOTA_SOFT_LIMIT_BYTES")),
+		DefaultHardLimit:   parseInt64(os.Getenv("DAM_QUOTA_HARD_LIMIT_BYTES")),
+		WorkspaceHardLimit: parseInt64(os.Getenv("DAM_WORKSPACE_QUOTA_HARD_LIMIT_BYTES")),
+	}
+
+	authConfig := AuthConfig{
+		Algorithm:            getEnv("DAM_JWT_ALGORITHM", "HS256"),
+		KeyID:                getEnv("DAM_JWT_KEY_ID", "default"),
+		Secret:               os.Getenv("DAM_JWT_SECRET"),
+		PrivateKeyFile:       os.Getenv("DAM_JWT_PRIVATE_KEY_FILE"),
+		VerificationKeyFiles: parseMap(os.Getenv("DAM_JWT_VERIFICATION_KEY_FILES")),
+		Issuer:               getEnv("DAM_JWT_ISSUER", "dam"),
+		Audience:             getEnv("DAM_JWT_AUDIENCE", "dam"),
+		AccessTokenTTL:       parseDuration(os.Getenv("DAM_JWT_ACCESS_TOKEN_TTL"), 15*time.Minute),
+		RefreshTokenTTL:      parseDuration(os.Getenv("DAM_JWT_REFRESH_TOKEN_TTL"), 30*24*time.Hour),
+	}
+
+	oidcConfig := OIDCConfig{
+		IssuerURL:    os.Getenv("DAM_OIDC_ISSUER_URL"),
+		ClientID:     os.Getenv("DAM_OIDC_CLIENT_ID"),
+		ClientSecret: os.Getenv("DAM_OIDC_CLIENT_SECRET"),
+		RedirectURL:  os.Getenv("DAM_OIDC_REDIRECT_URL"),
+		Scopes:       strings.Fields(getEnv("DAM_OIDC_SCOPES", "openid email profile")),
+	}
+
+	twoFactorConfig := TwoFactorConfig{
+		Policy:       getEnv("DAM_2FA_POLICY", "admins"),
+		Issuer:       getEnv("DAM_2FA_ISSUER", "DAM"),
+		ChallengeTTL: parseDuration(os.Getenv("DAM_2FA_CHALLENGE_TTL"), 5*time.Minute),
+	}
+
+	accountConfig := AccountConfig{
+		EmailVerificationTTL: parseDuration(os.Getenv("DAM_EMAIL_VERIFICATION_TTL"), 48*time.Hour),
+		PasswordResetTTL:     parseDuration(os.Getenv("DAM_PASSWORD_RESET_TTL"), time.Hour),
+	}
+
+	mailConfig := MailConfig{
+		Host:     os.Getenv("DAM_SMTP_HOST"),
+		Port:     getEnv("DAM_SMTP_PORT", "587"),
+		Username: os.Getenv("DAM_SMTP_USERNAME"),
+		Password: os.Getenv("DAM_SMTP_PASSWORD"),
+		From:     getEnv("DAM_MAIL_FROM", "no-reply@localhost"),
+	}
+
+	loginThrottleConfig := LoginThrottleConfig{
+		MaxAttemptsPerIP: parseInt64Default(os.Getenv("DAM_LOGIN_MAX_ATTEMPTS_PER_IP"), 30),
+		IPWindow:         parseDuration(os.Getenv("DAM_LOGIN_IP_WINDOW"), time.Minute),
+		FreeFailures:     parseInt64Default(os.Getenv("DAM_LOGIN_FREE_FAILURES"), 3),
+		BaseDelay:        parseDuration(os.Getenv("DAM_LOGIN_BASE_DELAY"), time.Second),
+		MaxDelay:         parseDuration(os.Getenv("DAM_LOGIN_MAX_DELAY"), 30*time.Second),
+		FailureWindow:    parseDuration(os.Getenv("DAM_LOGIN_FAILURE_WINDOW"), 15*time.Minute),
+		LockoutThreshold: parseInt64Default(os.Getenv("DAM_LOGIN_LOCKOUT_THRESHOLD"), 10),
+		LockoutDuration:  parseDuration(os.Getenv("DAM_LOGIN_LOCKOUT_DURATION"), 15*time.Minute),
+	}
+
+	passwordResetThrottleConfig := PasswordResetThrottleConfig{
+		MaxRequestsPerIP:    parseInt64Default(os.Getenv("DAM_PASSWORD_RESET_MAX_REQUESTS_PER_IP"), 10),
+		IPWindow:            parseDuration(os.Getenv("DAM_PASSWORD_RESET_IP_WINDOW"), 15*time.Minute),
+		MaxRequestsPerEmail: parseInt64Default(os.Getenv("DAM_PASSWORD_RESET_MAX_REQUESTS_PER_EMAIL"), 3),
+		EmailWindow:         parseDuration(os.Getenv("DAM_PASSWORD_RESET_EMAIL_WINDOW"), time.Hour),
+	}
+
+	allowPrivateWebhookTargets, _ := strconv.ParseBool(os.Getenv("DAM_WEBHOOK_ALLOW_PRIVATE_TARGETS"))
+	webhookConfig := WebhookConfig{
+		PollInterval:        parseDuration(os.Getenv("DAM_WEBHOOK_POLL_INTERVAL"), 2*time.Second),
+		Timeout:             parseDuration(os.Getenv("DAM_WEBHOOK_TIMEOUT"), 10*time.Second),
+		MaxAttempts:         parseInt64Default(os.Getenv("DAM_WEBHOOK_MAX_ATTEMPTS"), 8),
+		BaseDelay:           parseDuration(os.Getenv("DAM_WEBHOOK_BASE_DELAY"), 30*time.Second),
+		MaxDelay:            parseDuration(os.Getenv("DAM_WEBHOOK_MAX_DELAY"), 6*time.Hour),
+		AllowPrivateTargets: allowPrivateWebhookTargets,
+	}
+
 	Cfg = Config{
-		Database:    &dbConfig,
-		Redis:       &redisConfig,
-		Application: &ApplicationConfig,
+		Database:      &dbConfig,
+		Redis:         &redisConfig,
+		Application:   &ApplicationConfig,
+		Quota:         &quotaConfig,
+		Auth:          &authConfig,
+		OIDC:          &oidcConfig,
+		TwoFactor:     &twoFactorConfig,
+		Account:       &accountConfig,
+		Mail:          &mailConfig,
+		Login:         &loginThrottleConfig,
+		PasswordReset: &passwordResetThrottleConfig,
+		Webhook:       &webhookConfig,
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func parseInt64(s string) int64 {
+	i, _ := strconv.ParseInt(s, 10, 64)
+	return i
+}
+
+func parseInt64Default(s string, fallback int64) int64 {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fallback
+	}
+	return i
+}
+
+func parseDuration(s string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+// parseMap reads comma separated key=value pairs such as "2024-01=/keys/old.pem".
+func parseMap(s string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if ok && key != "" {
+			m[key] = value
+		}
 	}
+	return m
 }
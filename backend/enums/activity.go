@@ -0,0 +1,25 @@
+package enums
+
+// RecentAction is what a user last did with a file in their recent activity.
+type RecentAction string
+
+const (
+	RecentActionViewed     RecentAction = "viewed"
+	RecentActionDownloaded RecentAction = "downloaded"
+	RecentActionUploaded   RecentAction = "uploaded"
+)
+
+// ActivityAction is what happened to a file or directory in its activity feed.
+type ActivityAction string
+
+const (
+	ActivityCreated           ActivityAction = "created"
+	ActivityVersionUploaded   ActivityAction = "version_uploaded"
+	ActivityRenamed           ActivityAction = "renamed"
+	ActivityMoved             ActivityAction = "moved"
+	ActivityCopied            ActivityAction = "copied"
+	ActivityDescriptionEdited ActivityAction = "description_edited"
+	ActivityTagsEdited        ActivityAction = "tags_edited"
+	ActivityReviewRequested   ActivityAction = "review_requested"
+	ActivityReviewDecided     ActivityAction = "review_decided"
+)
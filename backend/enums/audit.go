@@ -0,0 +1,73 @@
+package enums
+
+type AuditAction string
+
+const (
+	AuditLoginSucceeded AuditAction = "login.succeeded"
+	AuditLoginFailed    AuditAction = "login.failed"
+	AuditLoginLocked    AuditAction = "login.locked"
+	AuditLoggedOut      AuditAction = "login.logged_out"
+
+	AuditProfileUpdated                 AuditAction = "account.profile_updated"
+	AuditPasswordChanged                AuditAction = "account.password_changed"
+	AuditPasswordReset                  AuditAction = "account.password_reset"
+	AuditTwoFactorEnabled               AuditAction = "account.two_factor_enabled"
+	AuditTwoFactorDisabled              AuditAction = "account.two_factor_disabled"
+	AuditSessionRevoked                 AuditAction = "account.session_revoked"
+	AuditSessionsRevoked                AuditAction = "account.sessions_revoked"
+	AuditAccessTokenCreated             AuditAction = "account.access_token_created"
+	AuditAccessTokenRevoked             AuditAction = "account.access_token_revoked"
+	AuditWebhookCreated                 AuditAction = "account.webhook_created"
+	AuditWebhookUpdated                 AuditAction = "account.webhook_updated"
+	AuditWebhookDeleted                 AuditAction = "account.webhook_deleted"
+	AuditNotificationPreferencesUpdated AuditAction = "account.notification_preferences_updated"
+	AuditUserSettingCreated             AuditAction = "setting.created"
+	AuditUploadPolicyUpdated            AuditAction = "setting.upload_policy_updated"
+
+	AuditFileUploaded   AuditAction = "file.uploaded"
+	AuditFileDownloaded AuditAction = "file.downloaded"
+	AuditFileUpdated    AuditAction = "file.updated"
+	AuditFileMoved      AuditAction = "file.moved"
+	AuditFileCopied     AuditAction = "file.copied"
+
+	AuditReviewRequested AuditAction = "file_version.review_requested"
+	AuditReviewDecided   AuditAction = "file_version.review_decided"
+
+	AuditCommentCreated    AuditAction = "comment.created"
+	AuditCommentUpdated    AuditAction = "comment.updated"
+	AuditCommentDeleted    AuditAction = "comment.deleted"
+	AuditCommentResolved   AuditAction = "comment.resolved"
+	AuditCommentUnresolved AuditAction = "comment.unresolved"
+
+	AuditDirectoryCreated AuditAction = "directory.created"
+	AuditDirectoryUpdated AuditAction = "directory.updated"
+	AuditDirectoryMoved   AuditAction = "directory.moved"
+	AuditDirectoryCopied  AuditAction = "directory.copied"
+
+	AuditUserDisabled         AuditAction = "admin.user_disabled"
+	AuditUserEnabled          AuditAction = "admin.user_enabled"
+	AuditQuotaReset           AuditAction = "admin.quota_reset"
+	AuditQuotaUpdated         AuditAction = "admin.quota_updated"
+	AuditImpersonationStarted AuditAction = "admin.impersonation_started"
+)
+
+type AuditTargetType string
+
+const (
+	AuditTargetUser                AuditTargetType = "user"
+	AuditTargetSession             AuditTargetType = "session"
+	AuditTargetFile                AuditTargetType = "file"
+	AuditTargetFileVersion         AuditTargetType = "file_version"
+	AuditTargetDirectory           AuditTargetType = "directory"
+	AuditTargetComment             AuditTargetType = "comment"
+	AuditTargetUserSetting         AuditTargetType = "user_setting"
+	AuditTargetPersonalAccessToken AuditTargetType = "personal_access_token"
+	AuditTargetWebhook             AuditTargetType = "webhook"
+)
+
+type AuditExportFormat string
+
+const (
+	AuditExportCSV   AuditExportFormat = "csv"
+	AuditExportJSONL AuditExportFormat = "jsonl"
+)
@@ -0,0 +1,11 @@
+package enums
+
+// ConflictPolicy decides what happens when an item is written into a directory
+// that already contains an item with the same name.
+type ConflictPolicy string
+
+const (
+	ConflictFail       ConflictPolicy = "fail"
+	ConflictRename     ConflictPolicy = "rename"
+	ConflictNewVersion ConflictPolicy = "new_version"
+)
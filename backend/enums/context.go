@@ -3,5 +3,10 @@ package enums
 type ContextKey string
 
 const (
-	UserIDCtxKey ContextKey = "userID"
+	UserIDCtxKey    ContextKey = "userID"
+	SessionIDCtxKey ContextKey = "sessionID"
+	// ScopesCtxKey is only set for requests made with a personal access token.
+	ScopesCtxKey ContextKey = "scopes"
+	// ImpersonatorIDCtxKey is only set for requests made by an admin impersonating the user.
+	ImpersonatorIDCtxKey ContextKey = "impersonatorID"
 )
@@ -20,4 +20,45 @@ const (
 	MissingFileError                 Error = 200013
 	FileNotFoundError                Error = 200014
 	FileVersionNotFoundError         Error = 200015
+	NameConflictError                Error = 200016
+	PathNotFoundError                Error = 200017
+	DirectoryCycleError              Error = 200018
+	EmptyNameError                   Error = 200019
+	NameContainsSeparatorError       Error = 200020
+	NameContainsControlCharError     Error = 200021
+	ReservedNameError                Error = 200022
+	NameTooLongError                 Error = 200023
+	QuotaExceededError               Error = 200024
+	FileTooLargeError                Error = 200025
+	FileTypeNotAllowedError          Error = 200026
+	DirectoryFileLimitError          Error = 200027
+	StorageNotConfiguredError        Error = 200028
+	InvalidRefreshTokenError         Error = 200029
+	RefreshTokenReusedError          Error = 200030
+	SessionNotFoundError             Error = 200031
+	PersonalAccessTokenNotFoundError Error = 200032
+	InsufficientScopeError           Error = 200033
+	InvalidOIDCStateError            Error = 200034
+	OIDCLoginError                   Error = 200035
+	AccountLinkConflictError         Error = 200036
+	TwoFactorAlreadyEnabledError     Error = 200037
+	TwoFactorNotEnabledError         Error = 200038
+	InvalidTwoFactorCodeError        Error = 200039
+	InvalidTwoFactorChallengeError   Error = 200040
+	TwoFactorRequiredError           Error = 200041
+	InvalidUserTokenError            Error = 200042
+	EmailAlreadyVerifiedError        Error = 200043
+	InvalidPasswordError             Error = 200044
+	InvalidCredentialsError          Error = 200045
+	TooManyLoginAttemptsError        Error = 200046
+	InsufficientRoleError            Error = 200047
+	AccountDisabledError             Error = 200048
+	ImpersonationNotAllowedError     Error = 200049
+	CommentNotFoundError             Error = 200050
+	AnnotationNotSupportedError      Error = 200051
+	ReviewNotFoundError              Error = 200052
+	InvalidReviewStateError          Error = 200053
+	WebhookNotFoundError             Error = 200054
+	NotificationNotFoundError        Error = 200055
+	TooManyPasswordResetsError       Error = 200056
 )
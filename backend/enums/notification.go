@@ -0,0 +1,21 @@
+package enums
+
+// NotificationType is what a notification tells its user about.
+type NotificationType string
+
+const (
+	// NotificationReviewRequested tells a user they were asked to review a file version.
+	NotificationReviewRequested NotificationType = "review_requested"
+	// NotificationReviewDecided tells the user who asked for a review what a reviewer decided.
+	NotificationReviewDecided NotificationType = "review_decided"
+	// NotificationMentioned tells a user they were mentioned in a comment.
+	NotificationMentioned NotificationType = "mentioned"
+)
+
+func (t NotificationType) IsValid() bool {
+	switch t {
+	case NotificationReviewRequested, NotificationReviewDecided, NotificationMentioned:
+		return true
+	}
+	return false
+}
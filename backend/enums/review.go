@@ -0,0 +1,20 @@
+package enums
+
+// ReviewStatus is where a file version is in its approval workflow.
+type ReviewStatus string
+
+const (
+	ReviewStatusDraft    ReviewStatus = "draft"
+	ReviewStatusInReview ReviewStatus = "in_review"
+	ReviewStatusApproved ReviewStatus = "approved"
+	ReviewStatusRejected ReviewStatus = "rejected"
+)
+
+// ReviewDecision is what a reviewer answered a review request with.
+type ReviewDecision string
+
+const (
+	ReviewDecisionPending          ReviewDecision = "pending"
+	ReviewDecisionApproved         ReviewDecision = "approved"
+	ReviewDecisionChangesRequested ReviewDecision = "changes_requested"
+)
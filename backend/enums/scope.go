@@ -0,0 +1,20 @@
+package enums
+
+// Scope limits what a personal access token may do. Session tokens are not limited.
+type Scope string
+
+const (
+	ScopeRead  Scope = "read"
+	ScopeWrite Scope = "write"
+	// ScopeAdmin covers managing the account itself: settings, sessions and tokens.
+	ScopeAdmin Scope = "admin"
+	ScopeShare Scope = "share"
+)
+
+func (s Scope) IsValid() bool {
+	switch s {
+	case ScopeRead, ScopeWrite, ScopeAdmin, ScopeShare:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package enums
+
+// SortKey is a field a directory listing can be ordered by.
+type SortKey string
+
+const (
+	SortByName      SortKey = "name"
+	SortBySize      SortKey = "size"
+	SortByCreatedAt SortKey = "created_at"
+	SortByUpdatedAt SortKey = "updated_at"
+	SortByType      SortKey = "type"
+)
+
+type SortDirection string
+
+const (
+	SortAscending  SortDirection = "asc"
+	SortDescending SortDirection = "desc"
+)
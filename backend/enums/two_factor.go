@@ -0,0 +1,10 @@
+package enums
+
+// TwoFactorPolicy decides who must use a second factor to log in with a password.
+type TwoFactorPolicy string
+
+const (
+	TwoFactorOptional       TwoFactorPolicy = "optional"
+	TwoFactorRequiredAdmins TwoFactorPolicy = "admins"
+	TwoFactorRequiredAll    TwoFactorPolicy = "all"
+)
@@ -0,0 +1,9 @@
+package enums
+
+// UserTokenPurpose is what a single-use token emailed to a user allows.
+type UserTokenPurpose string
+
+const (
+	UserTokenEmailVerification UserTokenPurpose = "email_verification"
+	UserTokenPasswordReset     UserTokenPurpose = "password_reset"
+)
@@ -0,0 +1,33 @@
+package enums
+
+// WebhookEvent is a change webhooks can subscribe to.
+type WebhookEvent string
+
+const (
+	WebhookFileCreated        WebhookEvent = "file.created"
+	WebhookFileVersionCreated WebhookEvent = "file_version.created"
+	WebhookFileMoved          WebhookEvent = "file.moved"
+	WebhookDirectoryCreated   WebhookEvent = "directory.created"
+	WebhookDirectoryUpdated   WebhookEvent = "directory.updated"
+	WebhookDirectoryMoved     WebhookEvent = "directory.moved"
+	// WebhookTest is only sent by the test-delivery endpoint and cannot be subscribed to.
+	WebhookTest WebhookEvent = "webhook.test"
+)
+
+func (e WebhookEvent) IsValid() bool {
+	switch e {
+	case WebhookFileCreated, WebhookFileVersionCreated, WebhookFileMoved, WebhookDirectoryCreated, WebhookDirectoryUpdated, WebhookDirectoryMoved:
+		return true
+	}
+	return false
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending deliveries are attempted again at their next_attempt_at.
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	// WebhookDeliveryFailed deliveries ran out of attempts.
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
@@ -0,0 +1,331 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var errInvalidUserToken = errors.New("invalid or expired link")
+
+type AccountHandler struct {
+	UserRepo              repositories.UserRepoInterface
+	AccountMailer         *AccountMailer
+	SessionStore          *auth.SessionStore
+	PasswordResetThrottle *auth.PasswordResetThrottle
+	db                    *gorm.DB
+}
+
+type AccountHandlerInterface interface {
+	VerifyEmail(c *gin.Context)
+	ResendEmailVerification(c *gin.Context)
+	ForgotPassword(c *gin.Context)
+	ResetPassword(c *gin.Context)
+	ChangePassword(c *gin.Context)
+}
+
+func NewAccountHandler(db *gorm.DB, accountMailer *AccountMailer, sessionStore *auth.SessionStore, passwordResetThrottle *auth.PasswordResetThrottle) AccountHandlerInterface {
+	return &AccountHandler{
+		UserRepo:              repositories.NewUserRepo(db),
+		AccountMailer:         accountMailer,
+		SessionStore:          sessionStore,
+		PasswordResetThrottle: passwordResetThrottle,
+		db:                    db,
+	}
+}
+
+// VerifyEmail marks the address of the user a verification link was sent to as verified.
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var verifyEmailReq apis.VerifyEmailRequest
+	if err := c.BindJSON(&verifyEmailReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user, err := consumeUserToken(ctx, tx, verifyEmailReq.Token, enums.UserTokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		if user.EmailVerifiedAt != nil {
+			return nil
+		}
+
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+		user.UpdatedAt = now
+		return repositories.UpdateUser(ctx, tx, user)
+	})
+	if err != nil {
+		respondWithUserTokenError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ResendEmailVerification sends the current user a new verification link.
+func (h *AccountHandler) ResendEmailVerification(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	user, err := h.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, apis.ErrorResponse{
+			Message: "Email address is already verified",
+			Code:    enums.EmailAlreadyVerifiedError,
+		})
+		return
+	}
+
+	h.AccountMailer.SendEmailVerification(*user)
+	c.JSON(http.StatusAccepted, gin.H{})
+}
+
+// ForgotPassword emails a password reset link to the account with the given address. It
+// answers the same whether there is such an account or not, so that it cannot be used to
+// find out who has one. Requests are throttled per IP and per address.
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var forgotPasswordReq apis.ForgotPasswordRequest
+	if err := c.BindJSON(&forgotPasswordReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	retryAfter, err := h.PasswordResetThrottle.Allow(ctx, c.ClientIP(), forgotPasswordReq.Email)
+	if errors.Is(err, auth.ErrPasswordResetThrottled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, apis.ErrorResponse{
+			Message: "Too many password reset requests, try again later",
+			Code:    enums.TooManyPasswordResetsError,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByEmail(ctx, forgotPasswordReq.Email)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+	if err == nil {
+		h.AccountMailer.SendPasswordReset(*user)
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{})
+}
+
+// ResetPassword sets the password of the user a reset link was sent to and logs them out
+// everywhere. Following the link also proves they own their address.
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var resetPasswordReq apis.ResetPasswordRequest
+	if err := c.BindJSON(&resetPasswordReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := resetPasswordReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(resetPasswordReq.Password), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.HashPasswordError,
+		})
+		return
+	}
+
+	var userID string
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user, err := consumeUserToken(ctx, tx, resetPasswordReq.Token, enums.UserTokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		if err := repositories.InvalidateUserTokens(ctx, tx, user.UserID, string(enums.UserTokenPasswordReset)); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		user.PasswordHash = string(passwordHash)
+		if user.EmailVerifiedAt == nil {
+			user.EmailVerifiedAt = &now
+		}
+		user.UpdatedAt = now
+		userID = user.UserID
+		if err := repositories.UpdateUser(ctx, tx, user); err != nil {
+			return err
+		}
+
+		entry := newAuditLog(c, enums.AuditPasswordReset, enums.AuditTargetUser, user.UserID, nil)
+		entry.ActorID = user.UserID
+		return repositories.CreateAuditLog(ctx, tx, entry)
+	})
+	if err != nil {
+		respondWithUserTokenError(c, err)
+		return
+	}
+
+	if err := h.SessionStore.DeleteUserSessions(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ChangePassword replaces the password of the current user and logs out all their other
+// sessions.
+func (h *AccountHandler) ChangePassword(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var changePasswordReq apis.ChangePasswordRequest
+	if err := c.BindJSON(&changePasswordReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := changePasswordReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(changePasswordReq.CurrentPassword)); err != nil {
+		c.JSON(http.StatusForbidden, apis.ErrorResponse{
+			Message: "Current password is wrong",
+			Code:    enums.InvalidPasswordError,
+		})
+		return
+	}
+
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(changePasswordReq.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.HashPasswordError,
+		})
+		return
+	}
+
+	user.PasswordHash = string(passwordHash)
+	user.UpdatedAt = time.Now()
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.UpdateUser(ctx, tx, user); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditPasswordChanged, enums.AuditTargetUser, userID, nil))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	// Requests made with a personal access token have no session to keep.
+	sessionID, _ := ctx.Value(enums.SessionIDCtxKey).(string)
+	if err := h.SessionStore.DeleteOtherSessions(ctx, userID, sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// consumeUserToken uses up token if it was emailed for purpose and returns its user.
+func consumeUserToken(ctx context.Context, tx *gorm.DB, token string, purpose enums.UserTokenPurpose) (*models.User, error) {
+	userToken, err := repositories.ConsumeUserToken(ctx, tx, auth.HashToken(token), string(purpose))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return repositories.GetUserByID(ctx, tx, userToken.UserID)
+}
+
+func respondWithUserTokenError(c *gin.Context, err error) {
+	if errors.Is(err, errInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidUserTokenError,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+		Message: err.Error(),
+		Code:    enums.InternalError,
+	})
+}
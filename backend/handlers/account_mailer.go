@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"dam/auth"
+	"dam/config"
+	"dam/enums"
+	"dam/mail"
+	"dam/models"
+	"dam/repositories"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const accountMailTimeout = 30 * time.Second
+
+// AccountMailer emails users the single-use links of the account flows. Emails are sent
+// in the background: a slow mail server must not delay the request, and the time a
+// forgot-password request takes must not tell whether the address has an account.
+type AccountMailer struct {
+	sender mail.Sender
+	logger *zap.Logger
+	db     *gorm.DB
+}
+
+func NewAccountMailer(db *gorm.DB, sender mail.Sender, logger *zap.Logger) *AccountMailer {
+	return &AccountMailer{
+		sender: sender,
+		logger: logger,
+		db:     db,
+	}
+}
+
+// SendEmailVerification emails user a link which proves they own their address. Links sent
+// before stop working.
+func (m *AccountMailer) SendEmailVerification(user models.User) {
+	go m.send(user, enums.UserTokenEmailVerification, config.Cfg.Account.EmailVerificationTTL, "/verify-email", func(link string) *mail.Message {
+		return &mail.Message{
+			To:      user.Email,
+			Subject: "Verify your email address",
+			Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below within %s:\n\n%s\n",
+				user.Name, config.Cfg.Account.EmailVerificationTTL, link),
+		}
+	})
+}
+
+// SendPasswordReset emails user a link to choose a new password. Links sent before stop
+// working. Callers acting on behalf of anonymous clients go through a
+// PasswordResetThrottle first.
+func (m *AccountMailer) SendPasswordReset(user models.User) {
+	go m.send(user, enums.UserTokenPasswordReset, config.Cfg.Account.PasswordResetTTL, "/reset-password", func(link string) *mail.Message {
+		return &mail.Message{
+			To:      user.Email,
+			Subject: "Reset your password",
+			Body: fmt.Sprintf("Hi %s,\n\nOpen the link below within %s to choose a new password:\n\n%s\n\nIf you did not ask for it, you can ignore this email.\n",
+				user.Name, config.Cfg.Account.PasswordResetTTL, link),
+		}
+	})
+}
+
+// send stores a new token for purpose and emails user the link to path of the web app
+// carrying it.
+func (m *AccountMailer) send(user models.User, purpose enums.UserTokenPurpose, ttl time.Duration, path string, message func(link string) *mail.Message) {
+	ctx, cancel := context.WithTimeout(context.Background(), accountMailTimeout)
+	defer cancel()
+
+	token, tokenHash, err := auth.NewUserToken()
+	if err != nil {
+		m.logger.Sugar().Errorf("create %s token error: %s", purpose, err.Error())
+		return
+	}
+
+	err = m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.InvalidateUserTokens(ctx, tx, user.UserID, string(purpose)); err != nil {
+			return err
+		}
+		now := time.Now()
+		return repositories.CreateUserToken(ctx, tx, &models.UserToken{
+			TokenHash: tokenHash,
+			UserID:    user.UserID,
+			Purpose:   string(purpose),
+			ExpiresAt: now.Add(ttl),
+			CreatedAt: now,
+		})
+	})
+	if err != nil {
+		m.logger.Sugar().Errorf("save %s token error: %s", purpose, err.Error())
+		return
+	}
+
+	link := config.Cfg.Application.PublicURL + path + "?" + url.Values{"token": {token}}.Encode()
+	if err := m.sender.Send(ctx, message(link)); err != nil {
+		m.logger.Sugar().Errorf("send %s email to user %s error: %s", purpose, user.UserID, err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"dam/enums"
+	"dam/models"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// newActivity describes action by the user making the request on an item which is in
+// directoryID afterwards, to be stored with repositories.CreateActivity.
+func newActivity(c *gin.Context, action enums.ActivityAction, itemID string, isDirectory bool, directoryID string, details map[string]interface{}) *models.Activity {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	// Details only holds strings and slices of strings, which always marshal.
+	rawDetails, _ := json.Marshal(details)
+
+	return &models.Activity{
+		ActivityID:  uuid.New().String(),
+		ItemID:      itemID,
+		IsDirectory: isDirectory,
+		DirectoryID: directoryID,
+		ActorID:     c.Request.Context().Value(enums.UserIDCtxKey).(string),
+		Action:      string(action),
+		Details:     string(rawDetails),
+		CreatedAt:   time.Now(),
+	}
+}
+
+// moveActivity describes the move of an item from one directory to another, where it may
+// have been renamed to avoid a conflict.
+func moveActivity(c *gin.Context, itemID string, isDirectory bool, fromDirectoryID, fromName, toDirectoryID, toName string) *models.Activity {
+	details := map[string]interface{}{
+		"from_directory_id": fromDirectoryID,
+		"to_directory_id":   toDirectoryID,
+	}
+	if fromName != toName {
+		details["from_name"] = fromName
+		details["to_name"] = toName
+	}
+	return newActivity(c, enums.ActivityMoved, itemID, isDirectory, toDirectoryID, details)
+}
+
+// fileUpdateActivities describes in the activity feed how file changed from before.
+func fileUpdateActivities(c *gin.Context, before, file *models.File) []*models.Activity {
+	activities := []*models.Activity{}
+	if before.Name != file.Name {
+		activities = append(activities, newActivity(c, enums.ActivityRenamed, file.FileID, false, file.DirectoryID, map[string]interface{}{
+			"from": before.Name,
+			"to":   file.Name,
+		}))
+	}
+	if before.Description != file.Description {
+		activities = append(activities, newActivity(c, enums.ActivityDescriptionEdited, file.FileID, false, file.DirectoryID, map[string]interface{}{
+			"from": before.Description,
+			"to":   file.Description,
+		}))
+	}
+	added, removed := diffTags(before.Tags, file.Tags)
+	if len(added) > 0 || len(removed) > 0 {
+		activities = append(activities, newActivity(c, enums.ActivityTagsEdited, file.FileID, false, file.DirectoryID, map[string]interface{}{
+			"added":   added,
+			"removed": removed,
+		}))
+	}
+	return activities
+}
+
+// diffTags returns the tags of after missing from before, and the other way around.
+func diffTags(before, after []string) (added, removed []string) {
+	added, removed = []string{}, []string{}
+	for _, tag := range after {
+		if !slices.Contains(before, tag) && !slices.Contains(added, tag) {
+			added = append(added, tag)
+		}
+	}
+	for _, tag := range before {
+		if !slices.Contains(after, tag) && !slices.Contains(removed, tag) {
+			removed = append(removed, tag)
+		}
+	}
+	return added, removed
+}
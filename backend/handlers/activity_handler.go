@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type ActivityHandler struct {
+	ActivityRepo  repositories.ActivityRepoInterface
+	DirectoryRepo repositories.DirectoryRepoInterface
+	FileRepo      repositories.FileRepoInterface
+	db            *gorm.DB
+}
+
+type ActivityHandlerInterface interface {
+	ListFileActivity(c *gin.Context)
+	ListDirectoryActivity(c *gin.Context)
+}
+
+func NewActivityHandler(db *gorm.DB) ActivityHandlerInterface {
+	return &ActivityHandler{
+		ActivityRepo:  repositories.NewActivityRepo(db),
+		DirectoryRepo: repositories.NewDirectoryRepo(db),
+		FileRepo:      repositories.NewFileRepo(db),
+		db:            db,
+	}
+}
+
+// ListFileActivity returns the history of a file, newest first.
+func (h *ActivityHandler) ListFileActivity(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	h.listActivities(c, repositories.ListActivitiesParams{ItemID: file.FileID})
+}
+
+// ListDirectoryActivity returns the history of a directory and of the items directly in
+// it, newest first.
+func (h *ActivityHandler) ListDirectoryActivity(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	h.listActivities(c, repositories.ListActivitiesParams{ItemID: dir.DirectoryID, IncludeChildren: true})
+}
+
+func (h *ActivityHandler) listActivities(c *gin.Context, params repositories.ListActivitiesParams) {
+	ctx := c.Request.Context()
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid limit",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+	params.Limit = limit
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.ActivityCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	page, err := h.ActivityRepo.ListActivities(ctx, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	actorIDs := make([]string, 0, len(page.Activities))
+	for _, activity := range page.Activities {
+		actorIDs = append(actorIDs, activity.ActorID)
+	}
+	actors, err := usersByID(ctx, h.db, actorIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	resp := apis.ListActivitiesResponse{Activities: make([]apis.Activity, 0, len(page.Activities))}
+	for i := range page.Activities {
+		resp.Activities = append(resp.Activities, activityResponse(&page.Activities[i], actors))
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func activityResponse(activity *models.Activity, users map[string]*models.User) apis.Activity {
+	details := activity.Details
+	if details == "" {
+		details = "{}"
+	}
+	return apis.Activity{
+		ActivityID:  activity.ActivityID,
+		ItemID:      activity.ItemID,
+		IsDirectory: activity.IsDirectory,
+		Action:      activity.Action,
+		Actor:       userSummary(activity.ActorID, users),
+		Details:     json.RawMessage(details),
+		CreatedAt:   activity.CreatedAt,
+	}
+}
@@ -0,0 +1,435 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errCannotDisableSelf  = errors.New("admins cannot disable themselves")
+	errCannotImpersonate  = errors.New("only enabled users who are not admins can be impersonated")
+	errUserAlreadyInState = errors.New("user is already in the requested state")
+)
+
+type AdminHandler struct {
+	UserRepo         repositories.UserRepoInterface
+	StorageUsageRepo repositories.StorageUsageRepoInterface
+	TokenManager     *auth.TokenManager
+	SessionStore     *auth.SessionStore
+	db               *gorm.DB
+}
+
+type AdminHandlerInterface interface {
+	ListUsers(c *gin.Context)
+	GetUser(c *gin.Context)
+	DisableUser(c *gin.Context)
+	EnableUser(c *gin.Context)
+	ResetUserQuota(c *gin.Context)
+	UpdateUserQuota(c *gin.Context)
+	GetUserUsage(c *gin.Context)
+	ImpersonateUser(c *gin.Context)
+}
+
+func NewAdminHandler(db *gorm.DB, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore) AdminHandlerInterface {
+	return &AdminHandler{
+		UserRepo:         repositories.NewUserRepo(db),
+		StorageUsageRepo: repositories.NewStorageUsageRepo(db),
+		TokenManager:     tokenManager,
+		SessionStore:     sessionStore,
+		db:               db,
+	}
+}
+
+// ListUsers searches all users, newest first.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid limit",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	params := repositories.ListUsersParams{
+		Query: c.Query("q"),
+		Role:  c.Query("role"),
+		Limit: limit,
+	}
+	if disabledStr := c.Query("disabled"); disabledStr != "" {
+		disabled, err := strconv.ParseBool(disabledStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid disabled",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+		params.Disabled = &disabled
+	}
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.UserCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	page, err := repositories.ListUsers(ctx, h.db, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	resp := apis.ListUsersResponse{Users: make([]apis.AdminUser, 0, len(page.Users))}
+	for i := range page.Users {
+		resp.Users = append(resp.Users, adminUserResponse(&page.Users[i]))
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	user, err := h.UserRepo.GetUserByID(ctx, c.Param("user_id"))
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, adminUserResponse(user))
+}
+
+// DisableUser blocks a user from logging in and revokes all their sessions at once.
+func (h *AdminHandler) DisableUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	adminID := ctx.Value(enums.UserIDCtxKey).(string)
+	userID := c.Param("user_id")
+	if userID == adminID {
+		respondWithAdminError(c, errCannotDisableSelf)
+		return
+	}
+
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return setUserDisabled(ctx, tx, c, userID, true)
+	})
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	if err := h.SessionStore.DeleteUserSessions(ctx, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (h *AdminHandler) EnableUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return setUserDisabled(ctx, tx, c, c.Param("user_id"), false)
+	})
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ResetUserQuota puts a user back on the default storage limits and recounts their usage.
+func (h *AdminHandler) ResetUserQuota(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.Param("user_id")
+	var usage *models.StorageUsage
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := repositories.GetUserByID(ctx, tx, userID); err != nil {
+			return err
+		}
+		before, err := repositories.GetStorageUsageByUserID(ctx, tx, userID, true)
+		if err != nil {
+			return err
+		}
+		if err := repositories.ResetStorageUsage(ctx, tx, userID); err != nil {
+			return err
+		}
+		usage, err = repositories.GetStorageUsageByUserID(ctx, tx, userID, false)
+		if err != nil {
+			return err
+		}
+
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditQuotaReset, enums.AuditTargetUser, userID, map[string]interface{}{
+			"used_bytes_before": before.UsedBytes,
+			"used_bytes_after":  usage.UsedBytes,
+		}))
+	})
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, storageUsageResponse(usage, []models.StorageUsageBreakdown{}, []models.StorageUsageBreakdown{}))
+}
+
+// UpdateUserQuota sets the storage limits of a user. Usage already over a lowered hard
+// limit is kept, only new uploads are refused.
+func (h *AdminHandler) UpdateUserQuota(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var updateQuotaReq apis.UpdateUserQuotaRequest
+	if err := c.BindJSON(&updateQuotaReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := updateQuotaReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	userID := c.Param("user_id")
+	var usage *models.StorageUsage
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := repositories.GetUserByID(ctx, tx, userID); err != nil {
+			return err
+		}
+		before, err := repositories.GetStorageUsageByUserID(ctx, tx, userID, true)
+		if err != nil {
+			return err
+		}
+		if err := repositories.SetStorageLimits(ctx, tx, userID, updateQuotaReq.SoftLimitBytes, updateQuotaReq.HardLimitBytes); err != nil {
+			return err
+		}
+		usage, err = repositories.GetStorageUsageByUserID(ctx, tx, userID, false)
+		if err != nil {
+			return err
+		}
+
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditQuotaUpdated, enums.AuditTargetUser, userID, auditChanges(storageLimitAuditFields(before), storageLimitAuditFields(usage))))
+	})
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, storageUsageResponse(usage, []models.StorageUsageBreakdown{}, []models.StorageUsageBreakdown{}))
+}
+
+// storageLimitAuditFields returns the limits set on usage, nil standing for the default.
+func storageLimitAuditFields(usage *models.StorageUsage) map[string]interface{} {
+	return map[string]interface{}{
+		"soft_limit_bytes": usage.SoftLimitBytes,
+		"hard_limit_bytes": usage.HardLimitBytes,
+	}
+}
+
+func (h *AdminHandler) GetUserUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := c.Param("user_id")
+	if _, err := h.UserRepo.GetUserByID(ctx, userID); err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	usage, err := h.StorageUsageRepo.GetStorageUsageByUserID(ctx, userID, false)
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	byDirectory, err := h.StorageUsageRepo.ListStorageUsageByTopLevelDirectory(ctx, userID)
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	byMimeFamily, err := h.StorageUsageRepo.ListStorageUsageByMimeFamily(ctx, userID)
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, storageUsageResponse(usage, byDirectory, byMimeFamily))
+}
+
+// ImpersonateUser opens a session as another user for support. The session is marked
+// with the admin everywhere: in its tokens, in the sessions list of the user, and in
+// every audit entry written while it is used. It cannot change account settings.
+func (h *AdminHandler) ImpersonateUser(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	adminID := ctx.Value(enums.UserIDCtxKey).(string)
+	var impersonateReq apis.ImpersonateUserRequest
+	if err := c.BindJSON(&impersonateReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := impersonateReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	admin, err := h.UserRepo.GetUserByID(ctx, adminID)
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByID(ctx, c.Param("user_id"))
+	if err != nil {
+		respondWithAdminError(c, err)
+		return
+	}
+
+	if user.Role == string(enums.RoleAdmin) || user.DisabledAt != nil {
+		respondWithAdminError(c, errCannotImpersonate)
+		return
+	}
+
+	session := &auth.Session{
+		UserID:         user.UserID,
+		Device:         fmt.Sprintf("Impersonation by %s", admin.Username),
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		ImpersonatorID: adminID,
+	}
+	refreshToken, err := h.SessionStore.CreateSession(ctx, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	err = repositories.CreateAuditLog(ctx, h.db, newAuditLog(c, enums.AuditImpersonationStarted, enums.AuditTargetUser, user.UserID, map[string]interface{}{
+		"reason":     impersonateReq.Reason,
+		"session_id": session.SessionID,
+	}))
+	if err != nil {
+		// A session nobody can trace back to the admin must not be handed out.
+		if err := h.SessionStore.DeleteSession(ctx, user.UserID, session.SessionID); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.RedisError,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	respondWithTokens(c, h.TokenManager, session, refreshToken)
+}
+
+// setUserDisabled disables or enables userID and records it in the audit log.
+func setUserDisabled(ctx context.Context, tx *gorm.DB, c *gin.Context, userID string, disabled bool) error {
+	user, err := repositories.GetUserByID(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if (user.DisabledAt != nil) == disabled {
+		return errUserAlreadyInState
+	}
+
+	now := time.Now()
+	action := enums.AuditUserEnabled
+	user.DisabledAt = nil
+	if disabled {
+		action = enums.AuditUserDisabled
+		user.DisabledAt = &now
+	}
+	user.UpdatedAt = now
+	if err := repositories.UpdateUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, action, enums.AuditTargetUser, userID, nil))
+}
+
+func adminUserResponse(user *models.User) apis.AdminUser {
+	return apis.AdminUser{
+		UserID:        user.UserID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Name:          user.Name,
+		Role:          user.Role,
+		DisabledAt:    user.DisabledAt,
+		CreatedAt:     user.CreatedAt,
+	}
+}
+
+func respondWithAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "User not found",
+			Code:    enums.UserNotFoundError,
+		})
+	case errors.Is(err, errCannotDisableSelf), errors.Is(err, errCannotImpersonate):
+		c.JSON(http.StatusForbidden, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+	case errors.Is(err, errUserAlreadyInState):
+		c.JSON(http.StatusConflict, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+	}
+}
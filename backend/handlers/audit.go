@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"dam/enums"
+	"dam/models"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// newAuditLog describes action on a target by the user making the request, if any, to be
+// stored with repositories.CreateAuditLog.
+func newAuditLog(c *gin.Context, action enums.AuditAction, targetType enums.AuditTargetType, targetID string, metadata map[string]interface{}) *models.AuditLog {
+	ctx := c.Request.Context()
+	actorID, _ := ctx.Value(enums.UserIDCtxKey).(string)
+	if metadata == nil {
+		metadata = map[string]interface{}{}
+	}
+	// What an admin does while impersonating is recorded as the user, marked with the admin.
+	if impersonatorID, ok := ctx.Value(enums.ImpersonatorIDCtxKey).(string); ok {
+		metadata["impersonator_id"] = impersonatorID
+	}
+	// Metadata only holds strings, numbers, booleans and slices or maps of them, which
+	// always marshal.
+	rawMetadata, _ := json.Marshal(metadata)
+
+	return &models.AuditLog{
+		AuditLogID: uuid.New().String(),
+		ActorID:    actorID,
+		Action:     string(action),
+		TargetType: string(targetType),
+		TargetID:   targetID,
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+		Metadata:   string(rawMetadata),
+		CreatedAt:  time.Now(),
+	}
+}
+
+// auditChanges returns the fields of after whose value differs from before, with both
+// values, to be stored as the metadata of a change.
+func auditChanges(before, after map[string]interface{}) map[string]interface{} {
+	changedBefore := map[string]interface{}{}
+	changedAfter := map[string]interface{}{}
+	for key, value := range after {
+		if !reflect.DeepEqual(before[key], value) {
+			changedBefore[key] = before[key]
+			changedAfter[key] = value
+		}
+	}
+	return map[string]interface{}{
+		"before": changedBefore,
+		"after":  changedAfter,
+	}
+}
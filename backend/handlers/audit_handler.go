@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// auditExportBatchSize is how many entries ExportAuditLogs reads from the database at once.
+const auditExportBatchSize = 500
+
+type AuditHandler struct {
+	UserRepo repositories.UserRepoInterface
+	db       *gorm.DB
+}
+
+type AuditHandlerInterface interface {
+	ListAuditLogs(c *gin.Context)
+	ExportAuditLogs(c *gin.Context)
+}
+
+func NewAuditHandler(db *gorm.DB) AuditHandlerInterface {
+	return &AuditHandler{
+		UserRepo: repositories.NewUserRepo(db),
+		db:       db,
+	}
+}
+
+// ListAuditLogs returns audit entries matching the filters, newest first. Admins see every
+// entry, other users only what they did themselves.
+func (h *AuditHandler) ListAuditLogs(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	params, ok := h.auditLogsParams(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid limit",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+	params.Limit = limit
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.AuditLogCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	page, err := repositories.ListAuditLogs(ctx, h.db, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	resp := apis.ListAuditLogsResponse{AuditLogs: make([]apis.AuditLog, 0, len(page.AuditLogs))}
+	for i := range page.AuditLogs {
+		resp.AuditLogs = append(resp.AuditLogs, auditLogResponse(&page.AuditLogs[i]))
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExportAuditLogs streams every audit entry matching the filters of ListAuditLogs as CSV
+// or as JSON Lines, newest first.
+func (h *AuditHandler) ExportAuditLogs(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	format := enums.AuditExportFormat(c.DefaultQuery("format", string(enums.AuditExportCSV)))
+	if format != enums.AuditExportCSV && format != enums.AuditExportJSONL {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: fmt.Sprintf("format must be %s or %s", enums.AuditExportCSV, enums.AuditExportJSONL),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	params, ok := h.auditLogsParams(c)
+	if !ok {
+		return
+	}
+	params.Limit = auditExportBatchSize
+
+	// The first batch is read before anything is written, so that most errors can still
+	// be answered with a proper status.
+	page, err := repositories.ListAuditLogs(ctx, h.db, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.%s", time.Now().UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	var write func(entry *models.AuditLog) error
+	switch format {
+	case enums.AuditExportCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		defer w.Flush()
+		if err := w.Write([]string{"created_at", "audit_log_id", "actor_id", "action", "target_type", "target_id", "ip", "user_agent", "metadata"}); err != nil {
+			return
+		}
+		write = func(entry *models.AuditLog) error {
+			return w.Write([]string{
+				entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+				entry.AuditLogID,
+				csvCell(entry.ActorID),
+				entry.Action,
+				entry.TargetType,
+				csvCell(entry.TargetID),
+				csvCell(entry.IP),
+				csvCell(entry.UserAgent),
+				csvCell(entry.Metadata),
+			})
+		}
+	case enums.AuditExportJSONL:
+		c.Header("Content-Type", "application/x-ndjson")
+		encoder := json.NewEncoder(c.Writer)
+		write = func(entry *models.AuditLog) error {
+			return encoder.Encode(auditLogResponse(entry))
+		}
+	}
+	c.Status(http.StatusOK)
+
+	for {
+		for i := range page.AuditLogs {
+			if err := write(&page.AuditLogs[i]); err != nil {
+				// The client went away.
+				return
+			}
+		}
+		if page.NextCursor == nil {
+			return
+		}
+
+		params.After = page.NextCursor
+		page, err = repositories.ListAuditLogs(ctx, h.db, params)
+		if err != nil {
+			// The status is already sent; a cut short file is all that can be done.
+			_ = c.Error(err)
+			return
+		}
+	}
+}
+
+// auditLogsParams reads the filters shared by ListAuditLogs and ExportAuditLogs. On
+// failure it responds with the error and returns false.
+func (h *AuditHandler) auditLogsParams(c *gin.Context) (repositories.ListAuditLogsParams, bool) {
+	ctx := c.Request.Context()
+
+	params := repositories.ListAuditLogsParams{
+		ActorID:    c.Query("actor_id"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+	for name, value := range map[string]**time.Time{"since": &params.Since, "until": &params.Until} {
+		s := c.Query(name)
+		if s == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: fmt.Sprintf("%s must be an RFC 3339 time", name),
+				Code:    enums.InvalidRequestError,
+			})
+			return params, false
+		}
+		*value = &t
+	}
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	user, err := h.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return params, false
+	}
+	if user.Role != string(enums.RoleAdmin) {
+		if params.ActorID != "" && params.ActorID != userID {
+			c.JSON(http.StatusForbidden, apis.ErrorResponse{
+				Message: "Only admins can see what other users did",
+				Code:    enums.InsufficientRoleError,
+			})
+			return params, false
+		}
+		params.ActorID = userID
+	}
+
+	return params, true
+}
+
+// csvCell keeps spreadsheet applications from running a value written by a user, such as
+// a user agent or a file name, as a formula.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func auditLogResponse(entry *models.AuditLog) apis.AuditLog {
+	metadata := entry.Metadata
+	if metadata == "" {
+		metadata = "{}"
+	}
+	return apis.AuditLog{
+		AuditLogID: entry.AuditLogID,
+		ActorID:    entry.ActorID,
+		Action:     entry.Action,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		IP:         entry.IP,
+		UserAgent:  entry.UserAgent,
+		Metadata:   json.RawMessage(metadata),
+		CreatedAt:  entry.CreatedAt,
+	}
+}
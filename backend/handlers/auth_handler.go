@@ -0,0 +1,29 @@
+package handlers
+
+import (
+	"dam/auth"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthHandler struct {
+	TokenManager *auth.TokenManager
+}
+
+type AuthHandlerInterface interface {
+	GetJWKS(c *gin.Context)
+}
+
+func NewAuthHandler(tokenManager *auth.TokenManager) AuthHandlerInterface {
+	return &AuthHandler{
+		TokenManager: tokenManager,
+	}
+}
+
+// GetJWKS publishes the public keys access tokens are verified with, so that other
+// services can check them without sharing a secret.
+func (h *AuthHandler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.TokenManager.JWKS())
+}
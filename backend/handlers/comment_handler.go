@@ -0,0 +1,615 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	errCommentNotFound        = errors.New("comment not found")
+	errNotCommentAuthor       = errors.New("only the author can change a comment")
+	errCannotResolveComment   = errors.New("only the author of a thread or the owner of the file can resolve it")
+	errCommentIsReply         = errors.New("replies cannot be annotated or resolved on their own")
+	errAnnotationNotSupported = errors.New("regions can only annotate images and time ranges only videos")
+	errFileVersionMismatch    = errors.New("file version not found")
+)
+
+// mentionPattern matches @username where it does not continue a word, such as in an
+// email address.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@])@([\w.\-]+)`)
+
+type CommentHandler struct {
+	CommentRepo repositories.CommentRepoInterface
+	FileRepo    repositories.FileRepoInterface
+	db          *gorm.DB
+}
+
+type CommentHandlerInterface interface {
+	ListComments(c *gin.Context)
+	CreateComment(c *gin.Context)
+	UpdateComment(c *gin.Context)
+	DeleteComment(c *gin.Context)
+	ResolveComment(c *gin.Context)
+	UnresolveComment(c *gin.Context)
+}
+
+func NewCommentHandler(db *gorm.DB) CommentHandlerInterface {
+	return &CommentHandler{
+		CommentRepo: repositories.NewCommentRepo(db),
+		FileRepo:    repositories.NewFileRepo(db),
+		db:          db,
+	}
+}
+
+// ListComments returns the comment threads of a file, oldest first, optionally only those
+// pinned to file_version_id or only the resolved or unresolved ones.
+func (h *CommentHandler) ListComments(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	var resolved *bool
+	if resolvedStr := c.Query("resolved"); resolvedStr != "" {
+		b, err := strconv.ParseBool(resolvedStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid resolved",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+		resolved = &b
+	}
+	fileVersionID := c.Query("file_version_id")
+
+	comments, err := h.CommentRepo.ListCommentsByFileID(ctx, file.FileID)
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	commentIDs := make([]string, 0, len(comments))
+	for _, comment := range comments {
+		commentIDs = append(commentIDs, comment.CommentID)
+	}
+	mentions, users, err := h.commentContext(ctx, comments, commentIDs)
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	repliesByThread := map[string][]apis.Comment{}
+	for i := range comments {
+		if comments[i].ParentCommentID != "" {
+			repliesByThread[comments[i].ParentCommentID] = append(repliesByThread[comments[i].ParentCommentID], commentResponse(&comments[i], mentions, users))
+		}
+	}
+
+	threads := []apis.Comment{}
+	for i := range comments {
+		comment := &comments[i]
+		if comment.ParentCommentID != "" {
+			continue
+		}
+		if fileVersionID != "" && comment.FileVersionID != fileVersionID {
+			continue
+		}
+		if resolved != nil && (comment.ResolvedAt != nil) != *resolved {
+			continue
+		}
+		replies := repliesByThread[comment.CommentID]
+		// A deleted comment is only kept to hold its replies together.
+		if comment.DeletedAt != nil && len(replies) == 0 {
+			continue
+		}
+
+		thread := commentResponse(comment, mentions, users)
+		thread.Replies = replies
+		threads = append(threads, thread)
+	}
+
+	c.JSON(http.StatusOK, apis.ListCommentsResponse{Threads: threads})
+}
+
+// CreateComment opens a thread on a file or replies in one. Replies to a reply go to the
+// thread of that reply.
+func (h *CommentHandler) CreateComment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var createCommentReq apis.CreateCommentRequest
+	if err := c.BindJSON(&createCommentReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := createCommentReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	now := time.Now()
+	comment := &models.Comment{
+		CommentID:     uuid.New().String(),
+		FileID:        file.FileID,
+		FileVersionID: createCommentReq.FileVersionID,
+		UserID:        userID,
+		Body:          createCommentReq.Body,
+		Annotation:    annotationModel(createCommentReq.Annotation),
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		switch {
+		case createCommentReq.ParentCommentID != "":
+			parent, err := repositories.GetCommentByID(ctx, tx, createCommentReq.ParentCommentID, false)
+			if err != nil {
+				return err
+			}
+			if parent.FileID != file.FileID {
+				return errCommentNotFound
+			}
+			if parent.ParentCommentID != "" {
+				parent, err = repositories.GetCommentByID(ctx, tx, parent.ParentCommentID, false)
+				if err != nil {
+					return err
+				}
+			}
+			comment.ParentCommentID = parent.CommentID
+			comment.FileVersionID = parent.FileVersionID
+		case comment.FileVersionID != "":
+			fileVersion, err := repositories.GetFileVersionByID(ctx, tx, comment.FileVersionID)
+			if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && fileVersion.FileID != file.FileID) {
+				return errFileVersionMismatch
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if !annotationSupported(file, comment.Annotation) {
+			return errAnnotationNotSupported
+		}
+
+		if err := repositories.CreateComment(ctx, tx, comment); err != nil {
+			return err
+		}
+		if err := saveCommentMentions(c, tx, comment); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditCommentCreated, enums.AuditTargetComment, comment.CommentID, map[string]interface{}{
+			"file_id":           comment.FileID,
+			"file_version_id":   comment.FileVersionID,
+			"parent_comment_id": comment.ParentCommentID,
+		}))
+	})
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	h.respondWithComment(c, http.StatusCreated, comment)
+}
+
+// UpdateComment lets the author change the body of a comment and, on a thread, its
+// annotation.
+func (h *CommentHandler) UpdateComment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var updateCommentReq apis.UpdateCommentRequest
+	if err := c.BindJSON(&updateCommentReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := updateCommentReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	var comment *models.Comment
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		comment, err = h.getOwnComment(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+
+		annotation := annotationModel(updateCommentReq.Annotation)
+		if annotation != nil {
+			if comment.ParentCommentID != "" {
+				return errCommentIsReply
+			}
+			file, err := repositories.GetFileByID(ctx, tx, comment.FileID)
+			if err != nil {
+				return err
+			}
+			if !annotationSupported(file, annotation) {
+				return errAnnotationNotSupported
+			}
+		}
+
+		previous := *comment
+		comment.Body = updateCommentReq.Body
+		comment.Annotation = annotation
+		comment.UpdatedAt = time.Now()
+		if err := repositories.UpdateComment(ctx, tx, comment); err != nil {
+			return err
+		}
+		if err := saveCommentMentions(c, tx, comment); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditCommentUpdated, enums.AuditTargetComment, comment.CommentID, auditChanges(commentAuditFields(&previous), commentAuditFields(comment))))
+	})
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	h.respondWithComment(c, http.StatusOK, comment)
+}
+
+// DeleteComment lets the author take back a comment. Its replies stay.
+func (h *CommentHandler) DeleteComment(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		comment, err := h.getOwnComment(ctx, tx, c)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		comment.Body = ""
+		comment.Annotation = nil
+		comment.DeletedAt = &now
+		comment.UpdatedAt = now
+		if err := repositories.UpdateComment(ctx, tx, comment); err != nil {
+			return err
+		}
+		if err := repositories.ReplaceCommentMentions(ctx, tx, comment.CommentID, nil); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditCommentDeleted, enums.AuditTargetComment, comment.CommentID, map[string]interface{}{
+			"file_id": comment.FileID,
+		}))
+	})
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (h *CommentHandler) ResolveComment(c *gin.Context) {
+	h.setResolved(c, true)
+}
+
+func (h *CommentHandler) UnresolveComment(c *gin.Context) {
+	h.setResolved(c, false)
+}
+
+// setResolved marks a thread as resolved or not. The author of the thread and the owner of
+// the file may do so.
+func (h *CommentHandler) setResolved(c *gin.Context, resolved bool) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var comment *models.Comment
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		comment, err = repositories.GetCommentByID(ctx, tx, c.Param("comment_id"), true)
+		if err != nil {
+			return err
+		}
+		if comment.DeletedAt != nil {
+			return errCommentNotFound
+		}
+		if comment.ParentCommentID != "" {
+			return errCommentIsReply
+		}
+
+		if comment.UserID != userID {
+			file, err := repositories.GetFileByID(ctx, tx, comment.FileID)
+			if err != nil {
+				return err
+			}
+			if file.UserID != userID {
+				return errCannotResolveComment
+			}
+		}
+
+		if (comment.ResolvedAt != nil) == resolved {
+			return nil
+		}
+		now := time.Now()
+		comment.ResolvedAt = nil
+		comment.ResolvedBy = ""
+		if resolved {
+			comment.ResolvedAt = &now
+			comment.ResolvedBy = userID
+		}
+		comment.UpdatedAt = now
+		if err := repositories.UpdateComment(ctx, tx, comment); err != nil {
+			return err
+		}
+
+		action := enums.AuditCommentUnresolved
+		if resolved {
+			action = enums.AuditCommentResolved
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, action, enums.AuditTargetComment, comment.CommentID, map[string]interface{}{
+			"file_id": comment.FileID,
+		}))
+	})
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	h.respondWithComment(c, http.StatusOK, comment)
+}
+
+// getOwnComment locks the comment of the request, which the current user must have written.
+func (h *CommentHandler) getOwnComment(ctx context.Context, tx *gorm.DB, c *gin.Context) (*models.Comment, error) {
+	comment, err := repositories.GetCommentByID(ctx, tx, c.Param("comment_id"), true)
+	if err != nil {
+		return nil, err
+	}
+	if comment.DeletedAt != nil {
+		return nil, errCommentNotFound
+	}
+	if comment.UserID != ctx.Value(enums.UserIDCtxKey).(string) {
+		return nil, errNotCommentAuthor
+	}
+	return comment, nil
+}
+
+func (h *CommentHandler) respondWithComment(c *gin.Context, status int, comment *models.Comment) {
+	mentions, users, err := h.commentContext(c.Request.Context(), []models.Comment{*comment}, []string{comment.CommentID})
+	if err != nil {
+		respondWithCommentError(c, err)
+		return
+	}
+
+	c.JSON(status, commentResponse(comment, mentions, users))
+}
+
+// commentContext loads who is mentioned in each of comments, and every user the comments
+// name.
+func (h *CommentHandler) commentContext(ctx context.Context, comments []models.Comment, commentIDs []string) (map[string][]string, map[string]*models.User, error) {
+	commentMentions, err := h.CommentRepo.ListCommentMentions(ctx, commentIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	mentions := map[string][]string{}
+	userIDs := []string{}
+	for _, mention := range commentMentions {
+		mentions[mention.CommentID] = append(mentions[mention.CommentID], mention.UserID)
+		userIDs = append(userIDs, mention.UserID)
+	}
+	for _, comment := range comments {
+		userIDs = append(userIDs, comment.UserID)
+		if comment.ResolvedBy != "" {
+			userIDs = append(userIDs, comment.ResolvedBy)
+		}
+	}
+
+	users, err := usersByID(ctx, h.db, userIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mentions, users, nil
+}
+
+// saveCommentMentions records the existing users the body of comment mentions as @username,
+// and notifies those who were not mentioned in it before.
+func saveCommentMentions(c *gin.Context, tx *gorm.DB, comment *models.Comment) error {
+	ctx := c.Request.Context()
+
+	usernames := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(comment.Body, -1) {
+		// A mention ending a sentence is followed by a period which is not part of it.
+		username := strings.TrimRight(match[1], ".-")
+		if username != "" && !slices.Contains(usernames, username) {
+			usernames = append(usernames, username)
+		}
+	}
+
+	users, err := repositories.ListUsersByUsernames(ctx, tx, usernames)
+	if err != nil {
+		return err
+	}
+
+	userIDs := make([]string, 0, len(users))
+	for _, user := range users {
+		userIDs = append(userIDs, user.UserID)
+	}
+
+	previousMentions, err := repositories.ListCommentMentions(ctx, tx, []string{comment.CommentID})
+	if err != nil {
+		return err
+	}
+	if err := repositories.ReplaceCommentMentions(ctx, tx, comment.CommentID, userIDs); err != nil {
+		return err
+	}
+
+	mentionedIDs := slices.DeleteFunc(userIDs, func(userID string) bool {
+		return slices.ContainsFunc(previousMentions, func(mention models.CommentMention) bool {
+			return mention.UserID == userID
+		})
+	})
+	if len(mentionedIDs) == 0 {
+		return nil
+	}
+	file, err := repositories.GetFileByID(ctx, tx, comment.FileID)
+	if err != nil {
+		return err
+	}
+	notifications := make([]models.Notification, 0, len(mentionedIDs))
+	for _, userID := range mentionedIDs {
+		notifications = append(notifications, newNotification(c, enums.NotificationMentioned, userID, file.FileID, false, map[string]interface{}{
+			"file_name":       file.Name,
+			"file_version_id": comment.FileVersionID,
+			"comment_id":      comment.CommentID,
+		}))
+	}
+	return createNotifications(ctx, tx, notifications)
+}
+
+// annotationSupported reports whether annotation fits the kind of file: regions are drawn
+// on images and time ranges on videos.
+func annotationSupported(file *models.File, annotation *models.CommentAnnotation) bool {
+	switch {
+	case annotation == nil:
+		return true
+	case annotation.Region != nil:
+		return strings.HasPrefix(file.Extension, "image/")
+	default:
+		return strings.HasPrefix(file.Extension, "video/")
+	}
+}
+
+func annotationModel(annotation *apis.CommentAnnotation) *models.CommentAnnotation {
+	if annotation == nil {
+		return nil
+	}
+
+	m := &models.CommentAnnotation{}
+	if r := annotation.Region; r != nil {
+		m.Region = &models.AnnotationRegion{X: r.X, Y: r.Y, Width: r.Width, Height: r.Height}
+	}
+	if t := annotation.TimeRange; t != nil {
+		m.TimeRange = &models.AnnotationTimeRange{Start: t.Start, End: t.End}
+	}
+	return m
+}
+
+func annotationResponse(annotation *models.CommentAnnotation) *apis.CommentAnnotation {
+	if annotation == nil {
+		return nil
+	}
+
+	resp := &apis.CommentAnnotation{}
+	if r := annotation.Region; r != nil {
+		resp.Region = &apis.AnnotationRegion{X: r.X, Y: r.Y, Width: r.Width, Height: r.Height}
+	}
+	if t := annotation.TimeRange; t != nil {
+		resp.TimeRange = &apis.AnnotationTimeRange{Start: t.Start, End: t.End}
+	}
+	return resp
+}
+
+func commentResponse(comment *models.Comment, mentions map[string][]string, users map[string]*models.User) apis.Comment {
+	resp := apis.Comment{
+		CommentID:       comment.CommentID,
+		FileID:          comment.FileID,
+		FileVersionID:   comment.FileVersionID,
+		ParentCommentID: comment.ParentCommentID,
+		Author:          userSummary(comment.UserID, users),
+		Body:            comment.Body,
+		Mentions:        make([]apis.UserSummary, 0, len(mentions[comment.CommentID])),
+		Annotation:      annotationResponse(comment.Annotation),
+		Resolved:        comment.ResolvedAt != nil,
+		ResolvedAt:      comment.ResolvedAt,
+		Deleted:         comment.DeletedAt != nil,
+		CreatedAt:       comment.CreatedAt,
+		UpdatedAt:       comment.UpdatedAt,
+	}
+	for _, userID := range mentions[comment.CommentID] {
+		resp.Mentions = append(resp.Mentions, userSummary(userID, users))
+	}
+	if comment.ResolvedBy != "" {
+		resolvedBy := userSummary(comment.ResolvedBy, users)
+		resp.ResolvedBy = &resolvedBy
+	}
+	return resp
+}
+
+// commentAuditFields returns the fields of comment its author can change, to be compared
+// with auditChanges.
+func commentAuditFields(comment *models.Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"body":       comment.Body,
+		"annotation": annotationResponse(comment.Annotation),
+	}
+}
+
+func respondWithCommentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound), errors.Is(err, errCommentNotFound):
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Comment not found",
+			Code:    enums.CommentNotFoundError,
+		})
+	case errors.Is(err, errFileVersionMismatch):
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "FileVersion not found",
+			Code:    enums.FileVersionNotFoundError,
+		})
+	case errors.Is(err, errNotCommentAuthor), errors.Is(err, errCannotResolveComment):
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InsufficientPermissionError,
+		})
+	case errors.Is(err, errCommentIsReply):
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+	case errors.Is(err, errAnnotationNotSupported):
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.AnnotationNotSupportedError,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+	}
+}
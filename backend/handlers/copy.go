@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"context"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// isSameOrDescendant reports whether directory is ancestor itself or sits somewhere below it.
+func isSameOrDescendant(directory, ancestor *models.Directory) bool {
+	return directory.DirectoryID == ancestor.DirectoryID || strings.HasPrefix(directory.FullPath, ancestor.FullPath+"/")
+}
+
+// copyFile duplicates the metadata of file into destination under name. Only the latest
+// version is copied unless includeVersions is set; copied versions share their blob with
+// the original, so file must belong to userID, whose bucket holds the blob.
+func copyFile(ctx context.Context, tx *gorm.DB, file *models.File, destination *models.Directory, name, userID string, includeVersions bool) (*models.File, error) {
+	now := time.Now()
+	copied := *file
+	copied.FileID = uuid.New().String()
+	copied.Name = name
+	copied.UserID = userID
+	copied.DirectoryID = destination.DirectoryID
+	copied.FullPath = destination.FullPath + "/" + name
+	copied.LatestFileVersionID = ""
+	copied.CreatedAt = now
+	copied.UpdatedAt = now
+	if err := repositories.CreateFile(ctx, tx, &copied); err != nil {
+		return nil, err
+	}
+
+	fileVersions, err := repositories.ListFileVersions(ctx, tx, file.FileID)
+	if err != nil {
+		return nil, err
+	}
+	if !includeVersions {
+		latest := make([]models.FileVersion, 0, 1)
+		for _, fileVersion := range fileVersions {
+			if fileVersion.FileVersionID == file.LatestFileVersionID {
+				latest = append(latest, fileVersion)
+			}
+		}
+		fileVersions = latest
+	}
+
+	// Shared blobs are still charged to the new owner, so that usage always equals the sum
+	// of the versions they own.
+	var size int64
+	for _, fileVersion := range fileVersions {
+		size += fileVersion.Size
+	}
+	if _, err := chargeStorage(ctx, tx, userID, size); err != nil {
+		return nil, err
+	}
+
+	for _, fileVersion := range fileVersions {
+		blobKey := fileVersion.BlobKey
+		if blobKey == "" {
+			blobKey = fileVersion.FileVersionID
+		}
+
+		copiedVersion := fileVersion
+		copiedVersion.FileVersionID = uuid.New().String()
+		copiedVersion.FileID = copied.FileID
+		copiedVersion.BlobKey = blobKey
+		// Approvals were given to the original file, not to the copy.
+		copiedVersion.ReviewStatus = string(enums.ReviewStatusDraft)
+		if err := repositories.CreateFileVersion(ctx, tx, &copiedVersion); err != nil {
+			return nil, err
+		}
+		copied.LatestFileVersionID = copiedVersion.FileVersionID
+	}
+
+	if err := repositories.UpdateFile(ctx, tx, &copied); err != nil {
+		return nil, err
+	}
+	return &copied, nil
+}
+
+// copyDirectory recreates source and the part of its subtree userID owns inside destination
+// under name, giving every directory and file a new ID and recomputing Level and FullPath.
+func copyDirectory(ctx context.Context, tx *gorm.DB, source, destination *models.Directory, name, userID string, includeVersions bool) (*models.Directory, error) {
+	if isSameOrDescendant(destination, source) {
+		return nil, errDirectoryCycle
+	}
+
+	descendants, err := repositories.ListDescendantDirectories(ctx, tx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	directoryIDs := make([]string, 0, len(descendants)+1)
+	directoryIDs = append(directoryIDs, source.DirectoryID)
+	for _, descendant := range descendants {
+		directoryIDs = append(directoryIDs, descendant.DirectoryID)
+	}
+	files, err := repositories.ListFilesByDirectoryIDs(ctx, tx, directoryIDs)
+	if err != nil {
+		return nil, err
+	}
+	descendants, files = ownSubtree(source, descendants, files, userID)
+
+	now := time.Now()
+	newDirectory := func(parent *models.Directory, name string) (*models.Directory, error) {
+		directoryID := uuid.New().String()
+		copied := &models.Directory{
+			DirectoryID:       directoryID,
+			Name:              name,
+			FullPath:          parent.FullPath + "/" + directoryID,
+			UserID:            userID,
+			Level:             parent.Level + 1,
+			ParentDirectoryID: parent.DirectoryID,
+			CreatedAt:         now,
+			UpdatedAt:         now,
+		}
+		return copied, repositories.CreateDirectory(ctx, tx, copied)
+	}
+
+	root, err := newDirectory(destination, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// descendants are ordered by level, so every parent is copied before its children.
+	copies := map[string]*models.Directory{source.DirectoryID: root}
+	for _, descendant := range descendants {
+		copied, err := newDirectory(copies[descendant.ParentDirectoryID], descendant.Name)
+		if err != nil {
+			return nil, err
+		}
+		copies[descendant.DirectoryID] = copied
+	}
+
+	for i := range files {
+		if _, err := copyFile(ctx, tx, &files[i], copies[files[i].DirectoryID], files[i].Name, userID, includeVersions); err != nil {
+			return nil, err
+		}
+	}
+
+	return root, nil
+}
+
+// ownSubtree keeps the descendants of source, ordered by level, and the files in it which
+// belong to userID. A directory of another user is left out with everything below it, since
+// copied files share their blobs with the originals and those live in the owner's bucket.
+func ownSubtree(source *models.Directory, descendants []models.Directory, files []models.File, userID string) ([]models.Directory, []models.File) {
+	kept := map[string]bool{source.DirectoryID: true}
+	ownDescendants := make([]models.Directory, 0, len(descendants))
+	for _, descendant := range descendants {
+		if kept[descendant.ParentDirectoryID] && descendant.UserID == userID {
+			kept[descendant.DirectoryID] = true
+			ownDescendants = append(ownDescendants, descendant)
+		}
+	}
+
+	ownFiles := make([]models.File, 0, len(files))
+	for _, file := range files {
+		if kept[file.DirectoryID] && file.UserID == userID {
+			ownFiles = append(ownFiles, file)
+		}
+	}
+	return ownDescendants, ownFiles
+}
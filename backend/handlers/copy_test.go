@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"dam/models"
+	"slices"
+	"testing"
+)
+
+func TestOwnSubtreeLeavesOutForeignItems(t *testing.T) {
+	source := &models.Directory{DirectoryID: "root", UserID: "ada"}
+	descendants := []models.Directory{
+		{DirectoryID: "own", ParentDirectoryID: "root", UserID: "ada"},
+		{DirectoryID: "foreign", ParentDirectoryID: "root", UserID: "eve"},
+		{DirectoryID: "own-in-own", ParentDirectoryID: "own", UserID: "ada"},
+		{DirectoryID: "own-in-foreign", ParentDirectoryID: "foreign", UserID: "ada"},
+	}
+	files := []models.File{
+		{FileID: "own-file", DirectoryID: "root", UserID: "ada"},
+		{FileID: "foreign-file", DirectoryID: "own", UserID: "eve"},
+		{FileID: "file-in-foreign", DirectoryID: "foreign", UserID: "ada"},
+		{FileID: "deep-file", DirectoryID: "own-in-own", UserID: "ada"},
+	}
+
+	ownDescendants, ownFiles := ownSubtree(source, descendants, files, "ada")
+
+	var directoryIDs, fileIDs []string
+	for _, directory := range ownDescendants {
+		directoryIDs = append(directoryIDs, directory.DirectoryID)
+	}
+	for _, file := range ownFiles {
+		fileIDs = append(fileIDs, file.FileID)
+	}
+	if want := []string{"own", "own-in-own"}; !slices.Equal(directoryIDs, want) {
+		t.Errorf("kept directories %v, want %v", directoryIDs, want)
+	}
+	if want := []string{"own-file", "deep-file"}; !slices.Equal(fileIDs, want) {
+		t.Errorf("kept files %v, want %v", fileIDs, want)
+	}
+}
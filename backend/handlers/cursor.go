@@ -0,0 +1,20 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+)
+
+// Cursors are opaque to clients; they only hand back what the previous page returned.
+func encodeCursor(cursor interface{}) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, cursor interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, cursor)
+}
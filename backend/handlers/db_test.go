@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// newTestDB returns a database with the migrations applied in a schema of its own, which is
+// dropped after the test. Tests needing one are skipped unless DAM_TEST_DB_DSN points at a
+// Postgres server, such as the one of docker-compose.yml:
+//
+//	DAM_TEST_DB_DSN="host=localhost user=root password=password dbname=dam port=5432 sslmode=disable"
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("DAM_TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("DAM_TEST_DB_DSN is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %s", err)
+	}
+	schema := "test_" + uuid.New().String()[:8]
+	if err := admin.Exec(fmt.Sprintf("CREATE SCHEMA %s", schema)).Error; err != nil {
+		t.Fatalf("create schema: %s", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(fmt.Sprintf("DROP SCHEMA %s CASCADE", schema))
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	db, err := gorm.Open(postgres.Open(dsn+" search_path="+schema), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open database: %s", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	migrations, err := filepath.Glob(filepath.Join("..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatalf("list migrations: %s", err)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		sql, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatalf("read migration: %s", err)
+		}
+		if err := db.Exec(string(sql)).Error; err != nil {
+			t.Fatalf("apply %s: %s", filepath.Base(migration), err)
+		}
+	}
+	return db
+}
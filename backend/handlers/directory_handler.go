@@ -5,8 +5,11 @@ import (
 	"dam/enums"
 	"dam/models"
 	"dam/repositories"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,9 +18,10 @@ import (
 )
 
 type DirectoryHandler struct {
-	DirectoryRepo repositories.DirectoryRepoInterface
-	FileRepo      repositories.FileRepoInterface
-	db            *gorm.DB
+	DirectoryRepo    repositories.DirectoryRepoInterface
+	FileRepo         repositories.FileRepoInterface
+	UploadPolicyRepo repositories.UploadPolicyRepoInterface
+	db               *gorm.DB
 }
 
 type DirectoryHandlerInterface interface {
@@ -27,13 +31,20 @@ type DirectoryHandlerInterface interface {
 	GetDirectoryByID(c *gin.Context)
 	ListFilesOrFoldersByDirectoryID(c *gin.Context)
 	MoveDirectories(c *gin.Context)
+	GetDirectoryTree(c *gin.Context)
+	GetUploadPolicy(c *gin.Context)
+	UpdateUploadPolicy(c *gin.Context)
+	CopyDirectories(c *gin.Context)
+	GetDirectoryBreadcrumbs(c *gin.Context)
+	ResolvePath(c *gin.Context)
 }
 
 func NewDirectoryHandler(db *gorm.DB) DirectoryHandlerInterface {
 	return &DirectoryHandler{
-		DirectoryRepo: repositories.NewDirectoryRepo(db),
-		FileRepo:      repositories.NewFileRepo(db),
-		db:            db,
+		DirectoryRepo:    repositories.NewDirectoryRepo(db),
+		FileRepo:         repositories.NewFileRepo(db),
+		UploadPolicyRepo: repositories.NewUploadPolicyRepo(db),
+		db:               db,
 	}
 }
 
@@ -51,6 +62,20 @@ func (h *DirectoryHandler) CreateDirectory(c *gin.Context) {
 		return
 	}
 
+	if errResp := validateName(createDirReq.Name); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	conflictPolicy, err := parseConflictPolicy(createDirReq.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
 	parentDirectory, err := h.DirectoryRepo.GetDirectoryByID(ctx, createDirReq.ParentID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, apis.ErrorResponse{
@@ -60,11 +85,27 @@ func (h *DirectoryHandler) CreateDirectory(c *gin.Context) {
 		return
 	}
 
+	name, _, err := resolveName(ctx, h.db, parentDirectory.DirectoryID, createDirReq.Name, "", true, conflictPolicy)
+	if err != nil {
+		if errors.Is(err, errNameConflict) {
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.NameConflictError,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
 	directionID := uuid.New().String()
 	fullPath := parentDirectory.FullPath + "/" + directionID
 	dir := &models.Directory{
 		DirectoryID:       directionID,
-		Name:              createDirReq.Name,
+		Name:              name,
 		UserID:            userID,
 		FullPath:          fullPath,
 		ParentDirectoryID: createDirReq.ParentID,
@@ -73,7 +114,29 @@ func (h *DirectoryHandler) CreateDirectory(c *gin.Context) {
 		UpdatedAt:         time.Now(),
 	}
 
-	if err := h.DirectoryRepo.CreateDirectory(ctx, dir); err != nil {
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.CreateDirectory(ctx, tx, dir); err != nil {
+			return err
+		}
+		if err := repositories.CreateActivity(ctx, tx, newActivity(c, enums.ActivityCreated, dir.DirectoryID, true, dir.ParentDirectoryID, nil)); err != nil {
+			return err
+		}
+		if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookDirectoryCreated, dir.UserID, dir.ParentDirectoryID, directoryEventData(dir))); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditDirectoryCreated, enums.AuditTargetDirectory, dir.DirectoryID, map[string]interface{}{
+			"name":                dir.Name,
+			"parent_directory_id": dir.ParentDirectoryID,
+		}))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: errNameConflict.Error(),
+				Code:    enums.NameConflictError,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
 			Code:    enums.InternalError,
@@ -100,6 +163,20 @@ func (h *DirectoryHandler) UpdateDirectory(c *gin.Context) {
 		return
 	}
 
+	if errResp := validateName(updateDirReq.Name); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	conflictPolicy, err := parseConflictPolicy(updateDirReq.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
 	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
 	if err != nil {
 		c.JSON(http.StatusNotFound, apis.ErrorResponse{
@@ -117,10 +194,52 @@ func (h *DirectoryHandler) UpdateDirectory(c *gin.Context) {
 		return
 	}
 
-	dir.Name = updateDirReq.Name
+	name, _, err := resolveName(ctx, h.db, dir.ParentDirectoryID, updateDirReq.Name, dir.DirectoryID, true, conflictPolicy)
+	if err != nil {
+		if errors.Is(err, errNameConflict) {
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.NameConflictError,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	previous := *dir
+	dir.Name = name
 	dir.UpdatedAt = time.Now()
 
-	if err := h.DirectoryRepo.UpdateDirectory(ctx, dir); err != nil {
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.UpdateDirectory(ctx, tx, dir); err != nil {
+			return err
+		}
+		if previous.Name != dir.Name {
+			err := repositories.CreateActivity(ctx, tx, newActivity(c, enums.ActivityRenamed, dir.DirectoryID, true, dir.ParentDirectoryID, map[string]interface{}{
+				"from": previous.Name,
+				"to":   dir.Name,
+			}))
+			if err != nil {
+				return err
+			}
+		}
+		if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookDirectoryUpdated, dir.UserID, dir.ParentDirectoryID, directoryEventData(dir))); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditDirectoryUpdated, enums.AuditTargetDirectory, dir.DirectoryID, auditChanges(directoryAuditFields(&previous), directoryAuditFields(dir))))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: errNameConflict.Error(),
+				Code:    enums.NameConflictError,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
 			Code:    enums.InternalError,
@@ -145,16 +264,16 @@ func (h *DirectoryHandler) GetDirectoryDetailsByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, apis.Directory{
-		DirectoryID:       dir.DirectoryID,
-		Name:              dir.Name,
-		FullPath:          dir.FullPath,
-		UserID:            dir.UserID,
-		Level:             dir.Level,
-		ParentDirectoryID: dir.ParentDirectoryID,
-		CreatedAt:         dir.CreatedAt,
-		UpdatedAt:         dir.UpdatedAt,
-	})
+	displayPath, err := directoryDisplayPath(ctx, h.db, dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, directoryResponse(dir, displayPath))
 }
 
 func (h *DirectoryHandler) GetDirectoryByID(c *gin.Context) {
@@ -169,52 +288,80 @@ func (h *DirectoryHandler) GetDirectoryByID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, apis.Directory{
-		DirectoryID:       dir.DirectoryID,
-		Name:              dir.Name,
-		FullPath:          dir.FullPath,
-		UserID:            dir.UserID,
-		Level:             dir.Level,
-		ParentDirectoryID: dir.ParentDirectoryID,
-		CreatedAt:         dir.CreatedAt,
-		UpdatedAt:         dir.UpdatedAt,
-	})
+	displayPath, err := directoryDisplayPath(ctx, h.db, dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, directoryResponse(dir, displayPath))
 }
 
+// maxListLimit bounds the page size of ListFilesOrFoldersByDirectoryID.
+const maxListLimit = 100
+
 func (h *DirectoryHandler) ListFilesOrFoldersByDirectoryID(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	dirID := c.Param("directory_id")
 
-	orderByStr := c.Query("order_by")
-	if orderByStr == "" {
-		orderByStr = "created_at DESC"
+	sortKey := enums.SortKey(c.DefaultQuery("sort", string(enums.SortByCreatedAt)))
+	if !repositories.IsSortKeySupported(sortKey) {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid sort",
+			Code:    enums.InvalidRequestError,
+		})
+		return
 	}
-	limitStr := c.Query("limit")
-	if limitStr == "" {
-		limitStr = "10"
+	sortDirection := enums.SortDirection(strings.ToLower(c.DefaultQuery("order", string(enums.SortDescending))))
+	if sortDirection != enums.SortAscending && sortDirection != enums.SortDescending {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid order",
+			Code:    enums.InvalidRequestError,
+		})
+		return
 	}
-	limit, err := strconv.Atoi(limitStr)
+	directoriesFirst, err := strconv.ParseBool(c.DefaultQuery("directories_first", "false"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
-			Message: "Invalid limit",
+			Message: "Invalid directories_first",
 			Code:    enums.InvalidRequestError,
 		})
 		return
 	}
-	offsetStr := c.Query("offset")
-	if offsetStr == "" {
-		offsetStr = "0"
-	}
-	offset, err := strconv.Atoi(offsetStr)
-	if err != nil {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit < 1 || limit > maxListLimit {
 		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
-			Message: "Invalid offset",
+			Message: "Invalid limit",
 			Code:    enums.InvalidRequestError,
 		})
 		return
 	}
 
+	params := repositories.ListFilesOrFoldersParams{
+		DirectoryID:      dirID,
+		SortKey:          sortKey,
+		SortDirection:    sortDirection,
+		DirectoriesFirst: directoriesFirst,
+		Extension:        c.Query("extension"),
+		MimeType:         c.Query("mime_type"),
+		Tag:              c.Query("tag"),
+		Limit:            limit,
+	}
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.FileOrFolderCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil || !params.After.Matches(&params) {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
 	if _, err := h.DirectoryRepo.GetDirectoryByID(ctx, dirID); err != nil {
 		c.JSON(http.StatusNotFound, apis.ErrorResponse{
 			Message: "Directory not found",
@@ -223,7 +370,7 @@ func (h *DirectoryHandler) ListFilesOrFoldersByDirectoryID(c *gin.Context) {
 		return
 	}
 
-	filesOrFolders, err := h.DirectoryRepo.ListFilesOrFoldersByDirectoryID(ctx, dirID, orderByStr, limit, offset)
+	page, err := h.DirectoryRepo.ListFilesOrFoldersByDirectoryID(ctx, params)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
@@ -232,12 +379,40 @@ func (h *DirectoryHandler) ListFilesOrFoldersByDirectoryID(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, filesOrFolders)
+	resp := apis.ListFilesOrFoldersResponse{
+		Items: make([]apis.FileOrFolder, 0, len(page.Items)),
+		Total: page.Total,
+	}
+	for _, item := range page.Items {
+		resp.Items = append(resp.Items, apis.FileOrFolder{
+			ID:                  item.ID,
+			Name:                item.Name,
+			ParentDirectoryID:   item.ParentDirectoryID,
+			IsDirectory:         item.IsDirectory,
+			FullPath:            item.FullPath,
+			Size:                item.Size,
+			MimeType:            item.MimeType,
+			Tags:                item.Tags,
+			LatestFileVersionID: item.LatestFileVersionID,
+			CreatedAt:           item.CreatedAt,
+			UpdatedAt:           item.UpdatedAt,
+		})
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
 }
 
+// MoveDirectories moves every source directory, with its whole subtree, into the
+// destination directory in a single transaction. Each item runs in its own savepoint, so
+// one failing item does not undo the others.
 func (h *DirectoryHandler) MoveDirectories(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
 	var moveDirReq apis.MoveDirectoriesRequest
 	if err := c.BindJSON(&moveDirReq); err != nil {
 		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
@@ -247,35 +422,574 @@ func (h *DirectoryHandler) MoveDirectories(c *gin.Context) {
 		return
 	}
 
-	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		destinationDirectory, err := h.DirectoryRepo.GetDirectoryByID(ctx, moveDirReq.DestinationDirectoryID)
+	conflictPolicy, err := parseConflictPolicy(moveDirReq.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	results := make([]apis.ItemResult, 0, len(moveDirReq.SourceDirectoryIDs))
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The directories are read after taking the lock, so that a concurrent move cannot
+		// change their paths between the cycle check and the update.
+		if err := repositories.LockDirectoryTree(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		destinationDirectory, err := repositories.GetDirectoryByID(ctx, tx, moveDirReq.DestinationDirectoryID)
 		if err != nil {
 			return err
 		}
+		if destinationDirectory.UserID != userID {
+			return errInsufficientPermission
+		}
 
 		for _, sourceDirectoryID := range moveDirReq.SourceDirectoryIDs {
-			sourceDirectory, err := h.DirectoryRepo.GetDirectoryByID(ctx, sourceDirectoryID)
+			result := apis.ItemResult{SourceID: sourceDirectoryID}
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				sourceDirectory, err := repositories.GetDirectoryByID(ctx, tx, sourceDirectoryID)
+				if err != nil {
+					return err
+				}
+				if sourceDirectory.UserID != userID {
+					return errInsufficientPermission
+				}
+
+				name, _, err := resolveName(ctx, tx, destinationDirectory.DirectoryID, sourceDirectory.Name, sourceDirectory.DirectoryID, true, conflictPolicy)
+				if err != nil {
+					return err
+				}
+
+				previous := *sourceDirectory
+				if err := moveDirectory(ctx, tx, sourceDirectory, destinationDirectory, name); err != nil {
+					return err
+				}
+				if err := checkTreeUploadPolicies(ctx, tx, sourceDirectory); err != nil {
+					return err
+				}
+
+				err = repositories.CreateActivity(ctx, tx, moveActivity(c, sourceDirectory.DirectoryID, true, previous.ParentDirectoryID, previous.Name, sourceDirectory.ParentDirectoryID, sourceDirectory.Name))
+				if err != nil {
+					return err
+				}
+
+				data := directoryEventData(sourceDirectory)
+				data["from_directory_id"] = previous.ParentDirectoryID
+				data["from_name"] = previous.Name
+				err = repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookDirectoryMoved, sourceDirectory.UserID, sourceDirectory.ParentDirectoryID, data))
+				if err != nil {
+					return err
+				}
+
+				err = repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditDirectoryMoved, enums.AuditTargetDirectory, sourceDirectory.DirectoryID, auditChanges(directoryAuditFields(&previous), directoryAuditFields(sourceDirectory))))
+				if err != nil {
+					return err
+				}
+
+				result.ID = sourceDirectory.DirectoryID
+				result.Name = sourceDirectory.Name
+				return nil
+			})
 			if err != nil {
-				return err
+				result.Error = itemError(err, enums.DirectoryNotFoundError)
 			}
+			results = append(results, result)
+		}
 
-			sourceDirectory.UpdatedAt = time.Now()
-			sourceDirectory.ParentDirectoryID = destinationDirectory.DirectoryID
-			if err := h.DirectoryRepo.UpdateDirectory(ctx, sourceDirectory); err != nil {
-				return err
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, apis.ErrorResponse{
+				Message: "Destination directory not found",
+				Code:    enums.DirectoryNotFoundError,
+			})
+		case errors.Is(err, errInsufficientPermission):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Insufficient permission",
+				Code:    enums.InsufficientPermissionError,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.BatchResponse{
+		Results: results,
+	})
+}
+
+// maxTreeDepth bounds the depth a client can ask GetDirectoryTree for.
+const maxTreeDepth = 32
+
+// GetDirectoryTree returns the subdirectories of a directory, nested down to the requested
+// depth, with the recursive file count and byte size of every node.
+func (h *DirectoryHandler) GetDirectoryTree(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	depthStr := c.Query("depth")
+	if depthStr == "" {
+		depthStr = "1"
+	}
+	depth, err := strconv.Atoi(depthStr)
+	if err != nil || depth < 0 || depth > maxTreeDepth {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: fmt.Sprintf("depth must be between 0 and %d", maxTreeDepth),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	if dir.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	nodes, err := h.DirectoryRepo.GetDirectoryTree(ctx, dir, depth)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	// nodes are ordered by level then name, which keeps every child list sorted by name.
+	childIndexes := make(map[string][]int, len(nodes))
+	rootIndex := -1
+	for i, node := range nodes {
+		if node.DirectoryID == dir.DirectoryID {
+			rootIndex = i
+			continue
+		}
+		childIndexes[node.ParentDirectoryID] = append(childIndexes[node.ParentDirectoryID], i)
+	}
+	if rootIndex < 0 {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	var buildNode func(i int) apis.DirectoryTreeNode
+	buildNode = func(i int) apis.DirectoryTreeNode {
+		node := apis.DirectoryTreeNode{
+			DirectoryID:       nodes[i].DirectoryID,
+			Name:              nodes[i].Name,
+			ParentDirectoryID: nodes[i].ParentDirectoryID,
+			Level:             nodes[i].Level,
+			FileCount:         nodes[i].FileCount,
+			TotalSize:         nodes[i].TotalSize,
+			CreatedAt:         nodes[i].CreatedAt,
+			UpdatedAt:         nodes[i].UpdatedAt,
+			Children:          make([]apis.DirectoryTreeNode, 0, len(childIndexes[nodes[i].DirectoryID])),
+		}
+		for _, childIndex := range childIndexes[nodes[i].DirectoryID] {
+			node.Children = append(node.Children, buildNode(childIndex))
+		}
+		return node
+	}
+
+	c.JSON(http.StatusOK, buildNode(rootIndex))
+}
+
+func (h *DirectoryHandler) GetDirectoryBreadcrumbs(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	if dir.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	crumbs, err := breadcrumbs(ctx, h.db, dir.FullPath)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, breadcrumbsResponse(crumbs, displayPath(crumbs)))
+}
+
+// ResolvePath walks a human path such as /Marketing/2024/hero.png from the root
+// directories of the current user and returns the file or directory it points to.
+func (h *DirectoryHandler) ResolvePath(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	names := strings.FieldsFunc(c.Query("path"), func(r rune) bool { return r == '/' })
+	if len(names) == 0 {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "path is required",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	roots, err := h.DirectoryRepo.ListRootDirectoriesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	var current *models.Directory
+	for i := range roots {
+		if nameKey(roots[i].Name) == nameKey(names[0]) {
+			current = &roots[i]
+			break
+		}
+	}
+	if current == nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Path not found",
+			Code:    enums.PathNotFoundError,
+		})
+		return
+	}
+
+	crumbs := []models.Directory{*current}
+	for i, name := range names[1:] {
+		children, err := h.DirectoryRepo.ListChildrenByName(ctx, current.DirectoryID, name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+			return
+		}
+
+		var match *models.FileOrFolder
+		for j := range children {
+			if nameKey(children[j].Name) == nameKey(name) {
+				match = &children[j]
+				break
 			}
+		}
+		isLast := i == len(names)-2
+		if match == nil || (!match.IsDirectory && !isLast) {
+			c.JSON(http.StatusNotFound, apis.ErrorResponse{
+				Message: "Path not found",
+				Code:    enums.PathNotFoundError,
+			})
+			return
+		}
 
-			if err := h.DirectoryRepo.MoveDirectory(ctx, sourceDirectory, destinationDirectory); err != nil {
-				return err
+		if !match.IsDirectory {
+			file, err := h.FileRepo.GetFileByID(ctx, match.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.InternalError,
+				})
+				return
 			}
 
-			if err := h.FileRepo.MoveDirectory(ctx, sourceDirectory, destinationDirectory); err != nil {
-				return err
+			if file.UserID != userID {
+				c.JSON(http.StatusNotFound, apis.ErrorResponse{
+					Message: "Path not found",
+					Code:    enums.PathNotFoundError,
+				})
+				return
 			}
+
+			fileAPI := fileResponse(file, displayPath(crumbs, file.Name))
+			c.JSON(http.StatusOK, apis.ResolvePathResponse{
+				IsDirectory: false,
+				File:        &fileAPI,
+			})
+			return
+		}
+
+		current, err = h.DirectoryRepo.GetDirectoryByID(ctx, match.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+			return
+		}
+		if current.UserID != userID {
+			c.JSON(http.StatusNotFound, apis.ErrorResponse{
+				Message: "Path not found",
+				Code:    enums.PathNotFoundError,
+			})
+			return
+		}
+
+		crumbs = append(crumbs, *current)
+	}
+
+	directoryAPI := directoryResponse(current, displayPath(crumbs))
+	c.JSON(http.StatusOK, apis.ResolvePathResponse{
+		IsDirectory: true,
+		Directory:   &directoryAPI,
+	})
+}
+
+// CopyDirectories copies every source into the destination directory in a single transaction.
+// Each item runs in its own savepoint, so one failing item does not undo the others.
+func (h *DirectoryHandler) CopyDirectories(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	var req apis.CopyDirectoriesRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	conflictPolicy, err := parseConflictPolicy(req.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	results := make([]apis.ItemResult, 0, len(req.SourceDirectoryIDs))
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		destinationDirectory, err := repositories.GetDirectoryByID(ctx, tx, req.DestinationDirectoryID)
+		if err != nil {
+			return err
+		}
+		if destinationDirectory.UserID != userID {
+			return errInsufficientPermission
+		}
+
+		for _, sourceID := range req.SourceDirectoryIDs {
+			result := apis.ItemResult{SourceID: sourceID}
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				source, err := repositories.GetDirectoryByID(ctx, tx, sourceID)
+				if err != nil {
+					return err
+				}
+				if source.UserID != userID {
+					return errInsufficientPermission
+				}
+
+				name, _, err := resolveName(ctx, tx, destinationDirectory.DirectoryID, source.Name, "", true, conflictPolicy)
+				if err != nil {
+					return err
+				}
+
+				copied, err := copyDirectory(ctx, tx, source, destinationDirectory, name, userID, req.IncludeVersions)
+				if err != nil {
+					return err
+				}
+				if err := checkTreeUploadPolicies(ctx, tx, copied); err != nil {
+					return err
+				}
+
+				err = repositories.CreateActivity(ctx, tx, newActivity(c, enums.ActivityCopied, copied.DirectoryID, true, copied.ParentDirectoryID, map[string]interface{}{
+					"source_directory_id": source.DirectoryID,
+				}))
+				if err != nil {
+					return err
+				}
+
+				err = repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditDirectoryCopied, enums.AuditTargetDirectory, copied.DirectoryID, map[string]interface{}{
+					"source_directory_id": source.DirectoryID,
+					"name":                copied.Name,
+					"parent_directory_id": copied.ParentDirectoryID,
+				}))
+				if err != nil {
+					return err
+				}
+
+				data := directoryEventData(copied)
+				data["source_directory_id"] = source.DirectoryID
+				if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookDirectoryCreated, copied.UserID, copied.ParentDirectoryID, data)); err != nil {
+					return err
+				}
+
+				result.ID = copied.DirectoryID
+				result.Name = copied.Name
+				return nil
+			})
+			if err != nil {
+				result.Error = itemError(err, enums.DirectoryNotFoundError)
+			}
+			results = append(results, result)
 		}
 
 		return nil
 	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, apis.ErrorResponse{
+				Message: "Destination directory not found",
+				Code:    enums.DirectoryNotFoundError,
+			})
+		case errors.Is(err, errInsufficientPermission):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Insufficient permission",
+				Code:    enums.InsufficientPermissionError,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.BatchResponse{
+		Results: results,
+	})
+}
+
+func (h *DirectoryHandler) GetUploadPolicy(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	uploadPolicy, err := h.UploadPolicyRepo.GetUploadPolicyByDirectoryID(ctx, dir.DirectoryID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	effective, err := effectiveUploadPolicy(ctx, h.db, dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.UploadPolicyResponse{
+		DirectoryID: dir.DirectoryID,
+		Policy:      uploadPolicyResponse(uploadPolicy),
+		Effective:   uploadPolicyResponse(effective),
+	})
+}
+
+// UpdateUploadPolicy replaces the upload policy set on a directory. Settings left empty
+// are inherited from the parent directories.
+func (h *DirectoryHandler) UpdateUploadPolicy(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	var req apis.UploadPolicy
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	if dir.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	uploadPolicy := &models.UploadPolicy{
+		DirectoryID:       dir.DirectoryID,
+		MaxFileSize:       req.MaxFileSize,
+		AllowedMimeTypes:  req.AllowedMimeTypes,
+		AllowedExtensions: req.AllowedExtensions,
+		MaxFiles:          req.MaxFiles,
+		RequireApproval:   req.RequireApproval,
+		CreatedAt:         time.Now(),
+		UpdatedAt:         time.Now(),
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		previous, err := repositories.GetUploadPolicyByDirectoryID(ctx, tx, dir.DirectoryID)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			previous = nil
+		case err != nil:
+			return err
+		}
+		if err := repositories.SaveUploadPolicy(ctx, tx, uploadPolicy); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditUploadPolicyUpdated, enums.AuditTargetDirectory, dir.DirectoryID,
+			auditChanges(uploadPolicyAuditFields(previous), uploadPolicyAuditFields(uploadPolicy))))
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
@@ -284,5 +998,35 @@ func (h *DirectoryHandler) MoveDirectories(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{})
+	c.JSON(http.StatusOK, apis.UpdateDirectoryResponse{
+		DirectoryID: dir.DirectoryID,
+	})
+}
+
+// directoryAuditFields are the fields of dir whose changes are recorded in the audit log.
+func directoryAuditFields(dir *models.Directory) map[string]interface{} {
+	return map[string]interface{}{
+		"name":                dir.Name,
+		"parent_directory_id": dir.ParentDirectoryID,
+	}
+}
+
+// uploadPolicyAuditFields describes uploadPolicy in the audit log, with every setting
+// empty when there is none.
+func uploadPolicyAuditFields(uploadPolicy *models.UploadPolicy) map[string]interface{} {
+	fields := map[string]interface{}{
+		"max_file_size":      (*int64)(nil),
+		"allowed_mime_types": []string(nil),
+		"allowed_extensions": []string(nil),
+		"max_files":          (*int)(nil),
+		"require_approval":   (*bool)(nil),
+	}
+	if uploadPolicy != nil {
+		fields["max_file_size"] = uploadPolicy.MaxFileSize
+		fields["allowed_mime_types"] = []string(uploadPolicy.AllowedMimeTypes)
+		fields["allowed_extensions"] = []string(uploadPolicy.AllowedExtensions)
+		fields["max_files"] = uploadPolicy.MaxFiles
+		fields["require_approval"] = uploadPolicy.RequireApproval
+	}
+	return fields
 }
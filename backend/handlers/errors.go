@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	errNameConflict            = errors.New("an item with the same name already exists in the directory")
+	errInsufficientPermission  = errors.New("insufficient permission")
+	errDirectoryCycle          = errors.New("a directory cannot be placed inside itself or one of its descendants")
+	errQuotaExceeded           = errors.New("storage quota exceeded")
+	errDirectoryFileLimit      = errors.New("the directory already holds the maximum number of files")
+	errFileTooLarge            = errors.New("file is larger than the directory allows")
+	errFileTypeNotAllowed      = errors.New("file type is not allowed in this directory")
+	errFileExtensionNotAllowed = errors.New("file extension is not allowed in this directory")
+)
+
+// itemError converts the error of one item of a batch request into its API form.
+// notFoundCode is reported when the item itself does not exist.
+func itemError(err error, notFoundCode enums.Error) *apis.ErrorResponse {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return &apis.ErrorResponse{Message: "Not found", Code: notFoundCode}
+	case errors.Is(err, errNameConflict), errors.Is(err, gorm.ErrDuplicatedKey):
+		return &apis.ErrorResponse{Message: errNameConflict.Error(), Code: enums.NameConflictError}
+	case errors.Is(err, errInsufficientPermission):
+		return &apis.ErrorResponse{Message: "Insufficient permission", Code: enums.InsufficientPermissionError}
+	case errors.Is(err, errDirectoryCycle):
+		return &apis.ErrorResponse{Message: err.Error(), Code: enums.DirectoryCycleError}
+	case errors.Is(err, errQuotaExceeded):
+		return &apis.ErrorResponse{Message: err.Error(), Code: enums.QuotaExceededError}
+	case errors.Is(err, errDirectoryFileLimit):
+		return &apis.ErrorResponse{Message: err.Error(), Code: enums.DirectoryFileLimitError}
+	case errors.Is(err, errFileTooLarge):
+		return &apis.ErrorResponse{Message: err.Error(), Code: enums.FileTooLargeError}
+	case errors.Is(err, errFileTypeNotAllowed), errors.Is(err, errFileExtensionNotAllowed):
+		return &apis.ErrorResponse{Message: err.Error(), Code: enums.FileTypeNotAllowedError}
+	default:
+		return &apis.ErrorResponse{Message: err.Error(), Code: enums.InternalError}
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	// eventStreamChannel is the Redis channel events go through from the instance which
+	// publishes them to every instance with clients listening.
+	eventStreamChannel        = "events"
+	eventPublishInterval      = 500 * time.Millisecond
+	eventPublishBatchSize     = 100
+	eventSubscriberBufferSize = 64
+)
+
+// streamEvent is an event of the outbox as it goes through Redis. OwnerID is the owner of
+// the item the event is about, the only user it is sent to.
+type streamEvent struct {
+	Position int64      `json:"position"`
+	OwnerID  string     `json:"owner_id"`
+	Event    apis.Event `json:"event"`
+}
+
+func newStreamEvent(event *models.OutboxEvent) streamEvent {
+	return streamEvent{
+		Position: *event.StreamPosition,
+		OwnerID:  event.OwnerID,
+		Event: apis.Event{
+			EventID:     strconv.FormatInt(event.EventID, 10),
+			Type:        event.EventType,
+			ActorID:     event.ActorID,
+			DirectoryID: event.DirectoryID,
+			CreatedAt:   event.CreatedAt,
+			Data:        json.RawMessage(event.Data),
+		},
+	}
+}
+
+// EventStream pushes the events of the outbox to the clients of GET /events on every
+// instance. One instance at a time gives new events their stream position and publishes
+// them to Redis; every instance relays what comes out of Redis to its own clients.
+type EventStream struct {
+	db       *gorm.DB
+	rdClient *redis.Client
+	logger   *zap.Logger
+
+	mu          sync.Mutex
+	subscribers map[chan streamEvent]struct{}
+	closed      bool
+}
+
+func NewEventStream(db *gorm.DB, rdClient *redis.Client, logger *zap.Logger) *EventStream {
+	return &EventStream{
+		db:          db,
+		rdClient:    rdClient,
+		logger:      logger,
+		subscribers: map[chan streamEvent]struct{}{},
+	}
+}
+
+// Run publishes and relays events until ctx is done, then ends every subscription.
+func (s *EventStream) Run(ctx context.Context) {
+	go s.publishLoop(ctx)
+	s.relay(ctx)
+}
+
+// Subscribe returns a channel receiving every event from now on. It is closed when the
+// subscriber falls too far behind or the stream stops, after which it should resume from
+// the database.
+func (s *EventStream) Subscribe() chan streamEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	events := make(chan streamEvent, eventSubscriberBufferSize)
+	if s.closed {
+		close(events)
+		return events
+	}
+	s.subscribers[events] = struct{}{}
+	return events
+}
+
+func (s *EventStream) Unsubscribe(events chan streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.subscribers[events]; ok {
+		delete(s.subscribers, events)
+		close(events)
+	}
+}
+
+func (s *EventStream) publishLoop(ctx context.Context) {
+	ticker := time.NewTicker(eventPublishInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.publishOutbox(ctx); err != nil {
+			s.logger.Sugar().Errorf("publish outbox events error: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishOutbox gives the events not published yet their stream position and publishes
+// them. Positions are committed before the events are published, so that nothing is
+// published twice, and the publishing lock is held on a connection of its own throughout,
+// so that no other instance can publish later positions first. Events whose publishing
+// fails are replayed from the database by clients, which notice the gap.
+func (s *EventStream) publishOutbox(ctx context.Context) error {
+	return s.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		locked, err := repositories.TryLockEventPublishing(ctx, conn)
+		if err != nil || !locked {
+			return err
+		}
+		defer func() {
+			if err := repositories.UnlockEventPublishing(context.WithoutCancel(ctx), conn); err != nil {
+				s.logger.Sugar().Errorf("unlock event publishing error: %s", err.Error())
+			}
+		}()
+
+		for {
+			var events []models.OutboxEvent
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				var err error
+				events, err = repositories.ListUnpublishedOutboxEvents(ctx, tx, eventPublishBatchSize)
+				if err != nil {
+					return err
+				}
+				for i := range events {
+					if err := repositories.SetOutboxEventStreamPosition(ctx, tx, &events[i]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			for i := range events {
+				// A streamEvent always marshals.
+				payload, _ := json.Marshal(newStreamEvent(&events[i]))
+				if err := s.rdClient.Publish(ctx, eventStreamChannel, payload).Err(); err != nil {
+					return err
+				}
+			}
+			if len(events) < eventPublishBatchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// relay hands the events coming out of Redis to the subscribers of this instance.
+func (s *EventStream) relay(ctx context.Context) {
+	pubsub := s.rdClient.Subscribe(ctx, eventStreamChannel)
+	defer pubsub.Close()
+	defer s.closeSubscribers()
+
+	messages := pubsub.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case message, ok := <-messages:
+			if !ok {
+				return
+			}
+			var event streamEvent
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				s.logger.Sugar().Errorf("decode stream event error: %s", err.Error())
+				continue
+			}
+			s.broadcast(event)
+		}
+	}
+}
+
+// broadcast never blocks: a subscriber whose buffer is full is dropped, and catches up
+// from the database when it resumes.
+func (s *EventStream) broadcast(event streamEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for events := range s.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(s.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+func (s *EventStream) closeSubscribers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	for events := range s.subscribers {
+		delete(s.subscribers, events)
+		close(events)
+	}
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/enums"
+	"dam/repositories"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	eventStreamHeartbeat = 25 * time.Second
+	// maxEventStreamDuration ends streams regularly, so that clients reconnect with a
+	// fresh access token and a revoked session does not keep receiving events.
+	maxEventStreamDuration = 10 * time.Minute
+	// maxEventReplay bounds how many missed events are sent on resume. A client further
+	// behind is sent a reset event and should reload what it shows.
+	maxEventReplay       = 1000
+	eventReplayBatchSize = 100
+)
+
+type EventStreamHandler struct {
+	Stream *EventStream
+	db     *gorm.DB
+}
+
+type EventStreamHandlerInterface interface {
+	StreamEvents(c *gin.Context)
+}
+
+func NewEventStreamHandler(db *gorm.DB, stream *EventStream) EventStreamHandlerInterface {
+	return &EventStreamHandler{
+		Stream: stream,
+		db:     db,
+	}
+}
+
+// StreamEvents pushes changes to the items of the current user as Server-Sent Events,
+// optionally only those in the directories given as directory_id. A client resumes where
+// it left off by sending the ID of the last event it received as the Last-Event-ID header
+// or the last_event_id query.
+//
+// Events go to the owner of the item they are about only, as webhook deliveries do.
+func (h *EventStreamHandler) StreamEvents(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), maxEventStreamDuration)
+	defer cancel()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	// last is the position of the last event handled, -1 until it is known.
+	last := int64(-1)
+	if lastEventID != "" {
+		position, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || position < 0 {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid Last-Event-ID",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+		last = position
+	}
+
+	// Subscribing before replaying leaves no gap between the two.
+	events := h.Stream.Subscribe()
+	defer h.Stream.Unsubscribe(events)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Keeps proxies such as nginx from buffering the stream.
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	w := &eventStreamWriter{c: c, userID: userID, directoryIDs: c.QueryArray("directory_id")}
+	if last >= 0 && !h.replay(ctx, w, &last, math.MaxInt64) {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventStreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if last >= 0 && event.Position > last+1 && !h.replay(ctx, w, &last, event.Position) {
+				return
+			}
+			if last >= 0 && event.Position <= last {
+				continue
+			}
+			if !w.send(event) {
+				return
+			}
+			last = event.Position
+		case <-heartbeat.C:
+			if !w.comment("ping") {
+				return
+			}
+		}
+	}
+}
+
+// replay sends the events after *last and before position from the database, moving
+// *last along. Like live events, those of other users are skipped by w. It returns false
+// when the stream should end.
+func (h *EventStreamHandler) replay(ctx context.Context, w *eventStreamWriter, last *int64, before int64) bool {
+	for replayed := 0; ; {
+		outboxEvents, err := repositories.ListOutboxEventsAfter(ctx, h.db, *last, eventReplayBatchSize)
+		if err != nil {
+			// The status is already sent; the client reconnects and resumes.
+			_ = w.c.Error(err)
+			return false
+		}
+
+		for i := range outboxEvents {
+			event := newStreamEvent(&outboxEvents[i])
+			if event.Position >= before {
+				return true
+			}
+			if replayed == maxEventReplay {
+				*last = -1
+				return w.reset()
+			}
+			if !w.send(event) {
+				return false
+			}
+			*last = event.Position
+			replayed++
+		}
+		if len(outboxEvents) < eventReplayBatchSize {
+			return true
+		}
+	}
+}
+
+type eventStreamWriter struct {
+	c            *gin.Context
+	userID       string
+	directoryIDs []string
+}
+
+// send writes event unless it is about an item of another user or outside the directories
+// asked for, and returns false once the client is gone.
+func (w *eventStreamWriter) send(event streamEvent) bool {
+	if !w.wants(&event) {
+		return true
+	}
+	// An apis.Event always marshals.
+	data, _ := json.Marshal(event.Event)
+	return w.write(fmt.Sprintf("id: %d\nevent: %s\ndata: %s\n\n", event.Position, event.Event.Type, data))
+}
+
+// reset tells the client that it missed too many events to be sent, and should reload
+// what it shows.
+func (w *eventStreamWriter) reset() bool {
+	return w.write("event: reset\ndata: {}\n\n")
+}
+
+func (w *eventStreamWriter) comment(text string) bool {
+	return w.write(": " + text + "\n\n")
+}
+
+func (w *eventStreamWriter) write(s string) bool {
+	if _, err := w.c.Writer.WriteString(s); err != nil {
+		return false
+	}
+	w.c.Writer.Flush()
+	return true
+}
+
+// wants tells whether event is about an item of the user and happened in one of the
+// directories asked for. A move happens in the directory the item left as well.
+func (w *eventStreamWriter) wants(streamEvent *streamEvent) bool {
+	if streamEvent.OwnerID != w.userID {
+		return false
+	}
+	event := &streamEvent.Event
+	if len(w.directoryIDs) == 0 || slices.Contains(w.directoryIDs, event.DirectoryID) {
+		return true
+	}
+	var data struct {
+		FromDirectoryID string `json:"from_directory_id"`
+	}
+	return json.Unmarshal(event.Data, &data) == nil && data.FromDirectoryID != "" && slices.Contains(w.directoryIDs, data.FromDirectoryID)
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"dam/apis"
+	"encoding/json"
+	"testing"
+)
+
+func TestEventStreamWriterWantsOwnEventsOnly(t *testing.T) {
+	w := &eventStreamWriter{userID: "user-1", directoryIDs: []string{"dir-1"}}
+
+	tests := []struct {
+		name  string
+		event streamEvent
+		want  bool
+	}{
+		{
+			name:  "own event in a directory asked for",
+			event: streamEvent{OwnerID: "user-1", Event: apis.Event{DirectoryID: "dir-1"}},
+			want:  true,
+		},
+		{
+			name:  "own move out of a directory asked for",
+			event: streamEvent{OwnerID: "user-1", Event: apis.Event{DirectoryID: "dir-2", Data: json.RawMessage(`{"from_directory_id":"dir-1"}`)}},
+			want:  true,
+		},
+		{
+			name:  "own event elsewhere",
+			event: streamEvent{OwnerID: "user-1", Event: apis.Event{DirectoryID: "dir-2"}},
+			want:  false,
+		},
+		{
+			name:  "event of another user in a directory asked for",
+			event: streamEvent{OwnerID: "user-2", Event: apis.Event{DirectoryID: "dir-1"}},
+			want:  false,
+		},
+	}
+	for _, tt := range tests {
+		if got := w.wants(&tt.event); got != tt.want {
+			t.Errorf("%s: wants = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type FavoriteHandler struct {
+	FavoriteRepo  repositories.FavoriteRepoInterface
+	DirectoryRepo repositories.DirectoryRepoInterface
+	FileRepo      repositories.FileRepoInterface
+	db            *gorm.DB
+}
+
+type FavoriteHandlerInterface interface {
+	FavoriteFile(c *gin.Context)
+	UnfavoriteFile(c *gin.Context)
+	FavoriteDirectory(c *gin.Context)
+	UnfavoriteDirectory(c *gin.Context)
+	ListFavorites(c *gin.Context)
+}
+
+func NewFavoriteHandler(db *gorm.DB) FavoriteHandlerInterface {
+	return &FavoriteHandler{
+		FavoriteRepo:  repositories.NewFavoriteRepo(db),
+		DirectoryRepo: repositories.NewDirectoryRepo(db),
+		FileRepo:      repositories.NewFileRepo(db),
+		db:            db,
+	}
+}
+
+func (h *FavoriteHandler) FavoriteFile(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	if file.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	h.addFavorite(c, userID, file.FileID, false)
+}
+
+func (h *FavoriteHandler) FavoriteDirectory(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	dir, err := h.DirectoryRepo.GetDirectoryByID(ctx, c.Param("directory_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	if dir.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	h.addFavorite(c, userID, dir.DirectoryID, true)
+}
+
+func (h *FavoriteHandler) addFavorite(c *gin.Context, userID, itemID string, isDirectory bool) {
+	err := h.FavoriteRepo.AddFavorite(c.Request.Context(), &models.Favorite{
+		UserID:      userID,
+		ItemID:      itemID,
+		IsDirectory: isDirectory,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (h *FavoriteHandler) UnfavoriteFile(c *gin.Context) {
+	h.removeFavorite(c, c.Param("file_id"))
+}
+
+func (h *FavoriteHandler) UnfavoriteDirectory(c *gin.Context) {
+	h.removeFavorite(c, c.Param("directory_id"))
+}
+
+// removeFavorite unstars an item. It does not look the item up, so that favorites of items
+// which no longer exist can still be cleared.
+func (h *FavoriteHandler) removeFavorite(c *gin.Context, itemID string) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	if err := h.FavoriteRepo.RemoveFavorite(ctx, userID, itemID); err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ListFavorites returns the starred files and directories of the current user, most
+// recently starred first. Items which were removed since they were starred are skipped.
+func (h *FavoriteHandler) ListFavorites(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	favorites, err := h.FavoriteRepo.ListFavoritesByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	fileIDs, directoryIDs := []string{}, []string{}
+	for _, favorite := range favorites {
+		if favorite.IsDirectory {
+			directoryIDs = append(directoryIDs, favorite.ItemID)
+		} else {
+			fileIDs = append(fileIDs, favorite.ItemID)
+		}
+	}
+
+	files, err := repositories.ListFilesByIDs(ctx, h.db, fileIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	dirs, err := repositories.ListDirectoriesByIDs(ctx, h.db, directoryIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	fullPaths := make([]string, 0, len(files)+len(dirs))
+	filesByID := make(map[string]*models.File, len(files))
+	for i := range files {
+		filesByID[files[i].FileID] = &files[i]
+		fullPaths = append(fullPaths, fileDirectoryFullPath(&files[i]))
+	}
+	dirsByID := make(map[string]*models.Directory, len(dirs))
+	for i := range dirs {
+		dirsByID[dirs[i].DirectoryID] = &dirs[i]
+		fullPaths = append(fullPaths, dirs[i].FullPath)
+	}
+
+	directoriesByID, err := pathDirectories(ctx, h.db, fullPaths...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	resp := apis.FavoritesResponse{
+		Files:       []apis.File{},
+		Directories: []apis.Directory{},
+	}
+	for _, favorite := range favorites {
+		if favorite.IsDirectory {
+			dir, ok := dirsByID[favorite.ItemID]
+			if !ok {
+				continue
+			}
+			resp.Directories = append(resp.Directories, directoryResponse(dir, displayPath(breadcrumbsFrom(directoriesByID, dir.FullPath))))
+			continue
+		}
+
+		file, ok := filesByID[favorite.ItemID]
+		if !ok {
+			continue
+		}
+		resp.Files = append(resp.Files, fileResponse(file, displayPath(breadcrumbsFrom(directoriesByID, fileDirectoryFullPath(file)), file.Name)))
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
@@ -1,16 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"dam/apis"
 	"dam/enums"
 	"dam/models"
 	"dam/repositories"
 
 	"errors"
+	"fmt"
+	"mime"
 	"net/http"
-	"strings"
 	"time"
 
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
@@ -22,6 +25,9 @@ type FileHandler struct {
 	DirectoryRepo   repositories.DirectoryRepoInterface
 	FileRepo        repositories.FileRepoInterface
 	FileVersionRepo repositories.FileVersionRepoInterface
+	// RecentActivityRecorder notes which files a user viewed, uploaded or downloaded.
+	RecentActivityRecorder *RecentActivityRecorder
+	db                     *gorm.DB
 }
 
 type FileHandlerInterface interface {
@@ -29,15 +35,21 @@ type FileHandlerInterface interface {
 	GetFile(c *gin.Context)
 	UpdateFile(c *gin.Context)
 	MoveFiles(c *gin.Context)
+	CopyFiles(c *gin.Context)
 	ListFileVersions(c *gin.Context)
+	DownloadFile(c *gin.Context)
+	GetFileBreadcrumbs(c *gin.Context)
 }
 
-func NewFileHandler(db *gorm.DB) FileHandlerInterface {
+func NewFileHandler(db *gorm.DB, recentActivityRecorder *RecentActivityRecorder) FileHandlerInterface {
 	return &FileHandler{
-		UserRepo:        repositories.NewUserRepo(db),
-		DirectoryRepo:   repositories.NewDirectoryRepo(db),
-		FileRepo:        repositories.NewFileRepo(db),
-		FileVersionRepo: repositories.NewFileVersionRepo(db),
+		UserRepo:               repositories.NewUserRepo(db),
+		UserSettingRepo:        repositories.NewUserSettingRepo(db),
+		DirectoryRepo:          repositories.NewDirectoryRepo(db),
+		FileRepo:               repositories.NewFileRepo(db),
+		FileVersionRepo:        repositories.NewFileVersionRepo(db),
+		RecentActivityRecorder: recentActivityRecorder,
+		db:                     db,
 	}
 }
 
@@ -45,8 +57,60 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	ctx := c.Request.Context()
 
 	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	conflictPolicy, err := parseConflictPolicy(c.Query("conflict"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	// Users only upload into their own directories, and other users' items are reported
+	// missing rather than forbidden.
+	directoryID := c.Param("directory_id")
+	directory, err := h.DirectoryRepo.GetDirectoryByID(ctx, directoryID)
+	if err != nil || directory.UserID != userID {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Directory not found",
+			Code:    enums.DirectoryNotFoundError,
+		})
+		return
+	}
+
+	uploadPolicy, err := effectiveUploadPolicy(ctx, h.db, directory)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	// Refuse oversized uploads from Content-Length before reading the body, and bound the
+	// body for clients which do not send it or lie about it.
+	if uploadPolicy.MaxFileSize != nil {
+		maxBodySize := *uploadPolicy.MaxFileSize + multipartOverhead
+		if c.Request.ContentLength > maxBodySize {
+			c.JSON(http.StatusRequestEntityTooLarge, apis.ErrorResponse{
+				Message: fmt.Sprintf("file must be at most %d bytes", *uploadPolicy.MaxFileSize),
+				Code:    enums.FileTooLargeError,
+			})
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
+	}
+
 	fileHeader, err := c.FormFile("file")
 	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, apis.ErrorResponse{
+				Message: fmt.Sprintf("file must be at most %d bytes", *uploadPolicy.MaxFileSize),
+				Code:    enums.FileTooLargeError,
+			})
+			return
+		}
 		c.JSON(400, apis.ErrorResponse{
 			Message: err.Error(),
 			Code:    enums.MissingFileError,
@@ -54,6 +118,16 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 		return
 	}
 
+	if errResp := validateName(fileHeader.Filename); errResp != nil {
+		c.JSON(http.StatusBadRequest, errResp)
+		return
+	}
+
+	if status, errResp := checkUploadPolicy(uploadPolicy, fileHeader); errResp != nil {
+		c.JSON(status, errResp)
+		return
+	}
+
 	file, err := fileHeader.Open()
 	if err != nil {
 		c.JSON(400, apis.ErrorResponse{
@@ -64,87 +138,210 @@ func (h *FileHandler) UploadFile(c *gin.Context) {
 	}
 	defer file.Close()
 
-	directoryID := c.Param("directory_id")
-	directory, err := h.DirectoryRepo.GetDirectoryByID(ctx, directoryID)
-	if err != nil {
-		c.JSON(http.StatusNotFound, apis.ErrorResponse{
-			Message: "Directory not found",
-			Code:    enums.DirectoryNotFoundError,
-		})
-		return
-	}
-
 	fileContentType := fileHeader.Header.Get("Content-Type")
 
 	var fileM *models.File
 
+	fileName := fileHeader.Filename
 	fileID := c.Query("file_id")
-	switch fileID {
-	case "":
-		fileID = uuid.New().String()
-		fileM = &models.File{
-			FileID:      fileID,
-			Name:        fileHeader.Filename,
-			Size:        fileHeader.Size,
-			Extension:   fileContentType,
-			FullPath:    directory.FullPath + "/" + fileHeader.Filename,
-			UserID:      userID,
-			DirectoryID: directoryID,
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-		}
-		if err := h.FileRepo.CreateFile(ctx, fileM); err != nil {
+	if fileID == "" {
+		resolvedName, existing, err := resolveName(ctx, h.db, directoryID, fileName, "", false, conflictPolicy)
+		if err != nil {
+			if errors.Is(err, errNameConflict) {
+				c.JSON(http.StatusConflict, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.NameConflictError,
+				})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 				Message: err.Error(),
 				Code:    enums.InternalError,
 			})
 			return
 		}
-	default:
-		fileM, err = h.FileRepo.GetFileByID(ctx, fileID)
-		if err != nil {
+		if existing != nil {
+			fileID = existing.ID
+		}
+		fileName = resolvedName
+	}
+
+	// A new version is only added to a file of the user in the directory of the request.
+	if fileID != "" {
+		existing, err := h.FileRepo.GetFileByID(ctx, fileID)
+		if err != nil || !uploadTarget(existing, userID, directoryID) {
 			c.JSON(http.StatusNotFound, apis.ErrorResponse{
 				Message: "File not found",
 				Code:    enums.FileNotFoundError,
 			})
 			return
 		}
-		fileID = fileM.FileID
 	}
-
-	fileVersion := &models.FileVersion{
-		FileVersionID: uuid.New().String(),
-		FileID:        fileID,
-		Size:          fileHeader.Size,
-		Extension:     fileContentType,
-		UserID:        userID,
-		CreatedAt:     time.Now(),
-		UpdatedAt:     time.Now(),
+	s3Client, bucket, err := userStorage(ctx, h.db, userID)
+	if err != nil {
+		respondWithStorageError(c, err)
+		return
 	}
-	if err := h.FileVersionRepo.CreateFileVersion(ctx, fileVersion); err != nil {
+
+	// The blob is stored before the version is recorded, so that no version points at a
+	// missing blob, and removed again when the version cannot be recorded.
+	fileVersionID := uuid.New().String()
+	size := fileHeader.Size
+	_, err = s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        &bucket,
+		Key:           &fileVersionID,
+		Body:          file,
+		ContentLength: &size,
+		ContentType:   &fileContentType,
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
-			Message: err.Error(),
+			Message: fmt.Sprintf("store file error: %s", err.Error()),
 			Code:    enums.InternalError,
 		})
 		return
 	}
 
-	fileM.LatestFileVersionID = fileVersion.FileVersionID
-	fileM.Size = fileHeader.Size
-	fileM.UpdatedAt = time.Now()
-	if err := h.FileRepo.UpdateFile(ctx, fileM); err != nil {
-		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
-			Message: err.Error(),
-			Code:    enums.InternalError,
+	var softLimitReached bool
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		activityAction := enums.ActivityVersionUploaded
+		switch fileID {
+		case "":
+			activityAction = enums.ActivityCreated
+			if err := checkFileLimit(ctx, tx, directoryID, uploadPolicy); err != nil {
+				return err
+			}
+
+			fileID = uuid.New().String()
+			fileM = &models.File{
+				FileID:      fileID,
+				Name:        fileName,
+				Size:        fileHeader.Size,
+				Extension:   fileContentType,
+				FullPath:    directory.FullPath + "/" + fileName,
+				UserID:      userID,
+				DirectoryID: directoryID,
+				CreatedAt:   time.Now(),
+				UpdatedAt:   time.Now(),
+			}
+			if err := repositories.CreateFile(ctx, tx, fileM); err != nil {
+				return err
+			}
+		default:
+			fileM, err = repositories.GetFileByID(ctx, tx, fileID)
+			if err != nil {
+				return err
+			}
+			// The file may have been moved since it was checked.
+			if !uploadTarget(fileM, userID, directoryID) {
+				return gorm.ErrRecordNotFound
+			}
+			fileID = fileM.FileID
+		}
+
+		// The uploader owns the file, so the bytes count against them.
+		softLimitReached, err = chargeStorage(ctx, tx, userID, fileHeader.Size)
+		if err != nil {
+			return err
+		}
+
+		fileVersion := &models.FileVersion{
+			FileVersionID: fileVersionID,
+			FileID:        fileID,
+			BlobKey:       fileVersionID,
+			Size:          fileHeader.Size,
+			Extension:     fileContentType,
+			UserID:        userID,
+			ReviewStatus:  string(enums.ReviewStatusDraft),
+			CreatedAt:     time.Now(),
+			UpdatedAt:     time.Now(),
+		}
+		if err := repositories.CreateFileVersion(ctx, tx, fileVersion); err != nil {
+			return err
+		}
+
+		fileM.LatestFileVersionID = fileVersion.FileVersionID
+		fileM.Size = fileHeader.Size
+		fileM.UpdatedAt = time.Now()
+		if err := repositories.UpdateFile(ctx, tx, fileM); err != nil {
+			return err
+		}
+
+		err = repositories.CreateActivity(ctx, tx, newActivity(c, activityAction, fileID, false, fileM.DirectoryID, map[string]interface{}{
+			"file_version_id": fileVersionID,
+		}))
+		if err != nil {
+			return err
+		}
+
+		if activityAction == enums.ActivityCreated {
+			if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookFileCreated, fileM.UserID, fileM.DirectoryID, fileEventData(fileM))); err != nil {
+				return err
+			}
+		}
+		if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookFileVersionCreated, fileM.UserID, fileM.DirectoryID, fileVersionEventData(fileM, fileVersion))); err != nil {
+			return err
+		}
+
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditFileUploaded, enums.AuditTargetFile, fileID, map[string]interface{}{
+			"file_version_id": fileVersionID,
+			"name":            fileM.Name,
+			"directory_id":    fileM.DirectoryID,
+			"size":            fileHeader.Size,
+		}))
+	})
+	if err != nil {
+		// An orphaned blob only costs space, so a failure to remove it is ignored.
+		_, _ = s3Client.DeleteObject(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+			Bucket: &bucket,
+			Key:    &fileVersionID,
 		})
+
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, apis.ErrorResponse{
+				Message: "File not found",
+				Code:    enums.FileNotFoundError,
+			})
+		case errors.Is(err, gorm.ErrDuplicatedKey):
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: errNameConflict.Error(),
+				Code:    enums.NameConflictError,
+			})
+		case errors.Is(err, errQuotaExceeded):
+			c.JSON(http.StatusInsufficientStorage, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.QuotaExceededError,
+			})
+		case errors.Is(err, errDirectoryFileLimit):
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.DirectoryFileLimitError,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+		}
 		return
 	}
 
+	h.RecentActivityRecorder.Record(userID, fileID, enums.RecentActionUploaded)
+
 	c.JSON(http.StatusCreated, apis.UploadFileResponse{
-		FileVersionID: fileVersion.FileVersionID,
+		FileVersionID: fileVersionID,
+		QuotaWarning:  softLimitReached,
 	})
 }
 
+// uploadTarget reports whether a version uploaded by userID into directoryID may be added
+// to file.
+func uploadTarget(file *models.File, userID, directoryID string) bool {
+	return file.UserID == userID && file.DirectoryID == directoryID
+}
+
 func (h *FileHandler) GetFile(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -165,24 +362,121 @@ func (h *FileHandler) GetFile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, apis.File{
-		FileID:      file.FileID,
-		Name:        file.Name,
-		Size:        file.Size,
-		Extension:   file.Extension,
-		UserID:      file.UserID,
-		DirectoryID: file.DirectoryID,
-		FullPath:    file.FullPath,
-		Description: file.Description,
-		Tags:        file.Tags,
-		CreatedAt:   file.CreatedAt,
-		UpdatedAt:   file.UpdatedAt,
-	})
+	displayPath, err := fileDisplayPath(ctx, h.db, file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	h.RecentActivityRecorder.Record(ctx.Value(enums.UserIDCtxKey).(string), file.FileID, enums.RecentActionViewed)
+
+	c.JSON(http.StatusOK, fileResponse(file, displayPath))
+}
+
+// downloadURLExpiry is how long the links handed out by DownloadFile stay valid.
+const downloadURLExpiry = 15 * time.Minute
+
+// DownloadFile redirects to a short-lived link to the content of a file version, the latest
+// one unless file_version_id is given, in the storage configured by the owner of the file.
+func (h *FileHandler) DownloadFile(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	// The link is signed with the credentials of the owner, who alone may hand it out.
+	if file.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	fileVersion, err := h.FileVersionRepo.GetFileVersionByID(ctx, c.DefaultQuery("file_version_id", file.LatestFileVersionID))
+	if err != nil || fileVersion.FileID != file.FileID {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "FileVersion not found",
+			Code:    enums.FileVersionNotFoundError,
+		})
+		return
+	}
+
+	s3Client, bucket, err := userStorage(ctx, h.db, file.UserID)
+	if err != nil {
+		respondWithStorageError(c, err)
+		return
+	}
+
+	blobKey := fileVersion.BlobKey
+	contentDisposition := mime.FormatMediaType("attachment", map[string]string{"filename": file.Name})
+	presigned, err := s3.NewPresignClient(s3Client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     &bucket,
+		Key:                        &blobKey,
+		ResponseContentDisposition: &contentDisposition,
+	}, s3.WithPresignExpires(downloadURLExpiry))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	err = repositories.CreateAuditLog(ctx, h.db, newAuditLog(c, enums.AuditFileDownloaded, enums.AuditTargetFile, file.FileID, map[string]interface{}{
+		"file_version_id": fileVersion.FileVersionID,
+	}))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	h.RecentActivityRecorder.Record(userID, file.FileID, enums.RecentActionDownloaded)
+
+	c.Redirect(http.StatusFound, presigned.URL)
+}
+
+func (h *FileHandler) GetFileBreadcrumbs(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	crumbs, err := breadcrumbs(ctx, h.db, fileDirectoryFullPath(file))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, breadcrumbsResponse(crumbs, displayPath(crumbs, file.Name)))
 }
 
 func (h *FileHandler) UpdateFile(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
 	var req apis.UpdateFileRequest
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
@@ -192,6 +486,15 @@ func (h *FileHandler) UpdateFile(c *gin.Context) {
 		return
 	}
 
+	conflictPolicy, err := parseConflictPolicy(req.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
 	fileID := c.Param("file_id")
 	file, err := h.FileRepo.GetFileByID(ctx, fileID)
 	if err != nil {
@@ -209,11 +512,68 @@ func (h *FileHandler) UpdateFile(c *gin.Context) {
 		return
 	}
 
-	file.Description = req.Description
-	file.Tags = req.Tags
+	if file.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
+	previous := *file
+	if req.Name != nil && *req.Name != file.Name {
+		if errResp := validateName(*req.Name); errResp != nil {
+			c.JSON(http.StatusBadRequest, errResp)
+			return
+		}
+
+		name, _, err := resolveName(ctx, h.db, file.DirectoryID, *req.Name, file.FileID, false, conflictPolicy)
+		if err != nil {
+			if errors.Is(err, errNameConflict) {
+				c.JSON(http.StatusConflict, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.NameConflictError,
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+			return
+		}
+
+		file.Name = name
+		file.FullPath = fileDirectoryFullPath(file) + "/" + name
+	}
+
+	if req.Description != nil {
+		file.Description = *req.Description
+	}
+	if req.Tags != nil {
+		file.Tags = *req.Tags
+	}
 	file.UpdatedAt = time.Now()
 
-	if err := h.FileRepo.UpdateFile(ctx, file); err != nil {
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.UpdateFile(ctx, tx, file); err != nil {
+			return err
+		}
+		for _, activity := range fileUpdateActivities(c, &previous, file) {
+			if err := repositories.CreateActivity(ctx, tx, activity); err != nil {
+				return err
+			}
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditFileUpdated, enums.AuditTargetFile, file.FileID, auditChanges(fileAuditFields(&previous), fileAuditFields(file))))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: errNameConflict.Error(),
+				Code:    enums.NameConflictError,
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
 			Code:    enums.InternalError,
@@ -227,6 +587,8 @@ func (h *FileHandler) UpdateFile(c *gin.Context) {
 func (h *FileHandler) MoveFiles(c *gin.Context) {
 	ctx := c.Request.Context()
 
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
 	var req apis.MoveFilesRequest
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
@@ -236,6 +598,15 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 		return
 	}
 
+	conflictPolicy, err := parseConflictPolicy(req.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
 	destinationDirectory, err := h.DirectoryRepo.GetDirectoryByID(ctx, req.DestinationDirectoryID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, apis.ErrorResponse{
@@ -245,6 +616,14 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 		return
 	}
 
+	if destinationDirectory.UserID != userID {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: "Insufficient permission",
+			Code:    enums.InsufficientPermissionError,
+		})
+		return
+	}
+
 	for _, fileID := range req.SourceFileIDs {
 		file, err := h.FileRepo.GetFileByID(ctx, fileID)
 		if err != nil {
@@ -255,18 +634,90 @@ func (h *FileHandler) MoveFiles(c *gin.Context) {
 			return
 		}
 
-		textNeedReplaced := file.FullPath[0:strings.LastIndex(file.FullPath, "/")]
-		file.FullPath = strings.ReplaceAll(file.FullPath, textNeedReplaced, destinationDirectory.FullPath)
-		file.DirectoryID = destinationDirectory.DirectoryID
-		file.UpdatedAt = time.Now()
-
-		if err := h.FileRepo.UpdateFile(ctx, file); err != nil {
-			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
-				Message: err.Error(),
-				Code:    enums.InternalError,
+		if file.UserID != userID {
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Insufficient permission",
+				Code:    enums.InsufficientPermissionError,
 			})
 			return
 		}
+
+		err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			// The destination is read again under the lock, so that the path of the file
+			// follows a concurrent move of the directory.
+			if err := repositories.LockDirectoryTree(ctx, tx, userID); err != nil {
+				return err
+			}
+			destinationDirectory, err := repositories.GetDirectoryByID(ctx, tx, req.DestinationDirectoryID)
+			if err != nil {
+				return err
+			}
+
+			fileName, _, err := resolveName(ctx, tx, destinationDirectory.DirectoryID, file.Name, file.FileID, false, conflictPolicy)
+			if err != nil {
+				return err
+			}
+
+			previous := *file
+			file.Name = fileName
+			file.FullPath = destinationDirectory.FullPath + "/" + fileName
+			file.DirectoryID = destinationDirectory.DirectoryID
+			file.UpdatedAt = time.Now()
+
+			if previous.DirectoryID != file.DirectoryID {
+				if err := admitFile(ctx, tx, destinationDirectory, &previous, file.Name); err != nil {
+					return err
+				}
+			}
+			if err := repositories.UpdateFile(ctx, tx, file); err != nil {
+				return err
+			}
+			if err := repositories.CreateActivity(ctx, tx, moveActivity(c, file.FileID, false, previous.DirectoryID, previous.Name, file.DirectoryID, file.Name)); err != nil {
+				return err
+			}
+			data := fileEventData(file)
+			data["from_directory_id"] = previous.DirectoryID
+			data["from_name"] = previous.Name
+			if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookFileMoved, file.UserID, file.DirectoryID, data)); err != nil {
+				return err
+			}
+			return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditFileMoved, enums.AuditTargetFile, file.FileID, auditChanges(fileAuditFields(&previous), fileAuditFields(file))))
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, apis.ErrorResponse{
+					Message: "Destination directory not found",
+					Code:    enums.DirectoryNotFoundError,
+				})
+			case errors.Is(err, errNameConflict), errors.Is(err, gorm.ErrDuplicatedKey):
+				c.JSON(http.StatusConflict, apis.ErrorResponse{
+					Message: errNameConflict.Error(),
+					Code:    enums.NameConflictError,
+				})
+			case errors.Is(err, errDirectoryFileLimit):
+				c.JSON(http.StatusConflict, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.DirectoryFileLimitError,
+				})
+			case errors.Is(err, errFileTooLarge):
+				c.JSON(http.StatusRequestEntityTooLarge, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.FileTooLargeError,
+				})
+			case errors.Is(err, errFileTypeNotAllowed), errors.Is(err, errFileExtensionNotAllowed):
+				c.JSON(http.StatusUnsupportedMediaType, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.FileTypeNotAllowedError,
+				})
+			default:
+				c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+					Message: err.Error(),
+					Code:    enums.InternalError,
+				})
+			}
+			return
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{})
@@ -294,20 +745,17 @@ func (h *FileHandler) ListFileVersions(c *gin.Context) {
 		return
 	}
 
+	displayPath, err := fileDisplayPath(ctx, h.db, file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, apis.ListFileVersions{
-		File: apis.File{
-			FileID:      file.FileID,
-			Name:        file.Name,
-			Size:        file.Size,
-			Extension:   file.Extension,
-			UserID:      file.UserID,
-			DirectoryID: file.DirectoryID,
-			FullPath:    file.FullPath,
-			Description: file.Description,
-			Tags:        file.Tags,
-			CreatedAt:   file.CreatedAt,
-			UpdatedAt:   file.UpdatedAt,
-		},
+		File: fileResponse(file, displayPath),
 		FileVersions: func() []apis.FileVersion {
 			fileVersionsAPI := make([]apis.FileVersion, 0, len(fileVersions))
 			for _, fileVersion := range fileVersions {
@@ -317,6 +765,7 @@ func (h *FileHandler) ListFileVersions(c *gin.Context) {
 					Size:          fileVersion.Size,
 					Extension:     fileVersion.Extension,
 					UserID:        fileVersion.UserID,
+					ReviewStatus:  fileVersion.ReviewStatus,
 					CreatedAt:     fileVersion.CreatedAt,
 					UpdatedAt:     fileVersion.UpdatedAt,
 				})
@@ -325,3 +774,132 @@ func (h *FileHandler) ListFileVersions(c *gin.Context) {
 		}(),
 	})
 }
+
+// CopyFiles copies every source into the destination directory in a single transaction.
+// Each item runs in its own savepoint, so one failing item does not undo the others.
+func (h *FileHandler) CopyFiles(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	var req apis.CopyFilesRequest
+	if err := c.BindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	conflictPolicy, err := parseConflictPolicy(req.Conflict, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	results := make([]apis.ItemResult, 0, len(req.SourceFileIDs))
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		destinationDirectory, err := repositories.GetDirectoryByID(ctx, tx, req.DestinationDirectoryID)
+		if err != nil {
+			return err
+		}
+		if destinationDirectory.UserID != userID {
+			return errInsufficientPermission
+		}
+
+		for _, sourceID := range req.SourceFileIDs {
+			result := apis.ItemResult{SourceID: sourceID}
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				source, err := repositories.GetFileByID(ctx, tx, sourceID)
+				if err != nil {
+					return err
+				}
+				if source.UserID != userID {
+					return errInsufficientPermission
+				}
+
+				name, _, err := resolveName(ctx, tx, destinationDirectory.DirectoryID, source.Name, "", false, conflictPolicy)
+				if err != nil {
+					return err
+				}
+				if err := admitFile(ctx, tx, destinationDirectory, source, name); err != nil {
+					return err
+				}
+
+				copied, err := copyFile(ctx, tx, source, destinationDirectory, name, userID, req.IncludeVersions)
+				if err != nil {
+					return err
+				}
+
+				err = repositories.CreateActivity(ctx, tx, newActivity(c, enums.ActivityCopied, copied.FileID, false, copied.DirectoryID, map[string]interface{}{
+					"source_file_id": source.FileID,
+				}))
+				if err != nil {
+					return err
+				}
+
+				err = repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditFileCopied, enums.AuditTargetFile, copied.FileID, map[string]interface{}{
+					"source_file_id": source.FileID,
+					"name":           copied.Name,
+					"directory_id":   copied.DirectoryID,
+				}))
+				if err != nil {
+					return err
+				}
+
+				data := fileEventData(copied)
+				data["source_file_id"] = source.FileID
+				if err := repositories.CreateOutboxEvent(ctx, tx, newOutboxEvent(c, enums.WebhookFileCreated, copied.UserID, copied.DirectoryID, data)); err != nil {
+					return err
+				}
+
+				result.ID = copied.FileID
+				result.Name = copied.Name
+				return nil
+			})
+			if err != nil {
+				result.Error = itemError(err, enums.FileNotFoundError)
+			}
+			results = append(results, result)
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, apis.ErrorResponse{
+				Message: "Destination directory not found",
+				Code:    enums.DirectoryNotFoundError,
+			})
+		case errors.Is(err, errInsufficientPermission):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Insufficient permission",
+				Code:    enums.InsufficientPermissionError,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.BatchResponse{
+		Results: results,
+	})
+}
+
+// fileAuditFields are the fields of file whose changes are recorded in the audit log.
+func fileAuditFields(file *models.File) map[string]interface{} {
+	return map[string]interface{}{
+		"name":         file.Name,
+		"directory_id": file.DirectoryID,
+		"description":  file.Description,
+		"tags":         []string(file.Tags),
+	}
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"dam/models"
+	"dam/repositories"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// moveDirectory makes source a child of destination under name, rewriting the FullPath
+// and Level of every directory and the FullPath of every file in its subtree. All the
+// work happens on tx so that a failure leaves the tree untouched.
+func moveDirectory(ctx context.Context, tx *gorm.DB, source, destination *models.Directory, name string) error {
+	if isSameOrDescendant(destination, source) {
+		return errDirectoryCycle
+	}
+
+	// Both subtree updates compare against the FullPath and Level source had before the move.
+	if err := repositories.MoveDirectoryDescendants(ctx, tx, source, destination); err != nil {
+		return err
+	}
+	if err := repositories.MoveDirectoryFiles(ctx, tx, source, destination); err != nil {
+		return err
+	}
+
+	source.Name = name
+	source.ParentDirectoryID = destination.DirectoryID
+	source.FullPath = destination.FullPath + "/" + source.DirectoryID
+	source.Level = destination.Level + 1
+	source.UpdatedAt = time.Now()
+	return repositories.UpdateDirectory(ctx, tx, source)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"dam/config"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// parseConflictPolicy reads the conflict parameter of a request, defaulting to fail.
+// new_version only makes sense where a file is being written, so callers opt into it.
+func parseConflictPolicy(s string, allowNewVersion bool) (enums.ConflictPolicy, error) {
+	switch policy := enums.ConflictPolicy(s); policy {
+	case "":
+		return enums.ConflictFail, nil
+	case enums.ConflictFail, enums.ConflictRename:
+		return policy, nil
+	case enums.ConflictNewVersion:
+		if allowNewVersion {
+			return policy, nil
+		}
+		return "", fmt.Errorf("conflict %q is not supported here", s)
+	default:
+		return "", fmt.Errorf("conflict %q is invalid", s)
+	}
+}
+
+// resolveName applies policy to name inside directoryID. The item identified by selfID is
+// ignored so that renaming or moving an item never conflicts with itself.
+//
+// It returns the name to write and, when policy is new_version and a file with that name
+// already exists, the existing file which should receive a new version instead.
+func resolveName(ctx context.Context, db *gorm.DB, directoryID, name, selfID string, isDirectory bool, policy enums.ConflictPolicy) (string, *models.FileOrFolder, error) {
+	base, ext := name, ""
+	if !isDirectory {
+		ext = filepath.Ext(name)
+		if ext == name {
+			ext = ""
+		}
+		base = strings.TrimSuffix(name, ext)
+	}
+
+	siblings, err := repositories.ListChildrenByNamePrefix(ctx, db, directoryID, base)
+	if err != nil {
+		return "", nil, err
+	}
+
+	taken := make(map[string]models.FileOrFolder, len(siblings))
+	for _, sibling := range siblings {
+		if sibling.ID == selfID {
+			continue
+		}
+		taken[nameKey(sibling.Name)] = sibling
+	}
+
+	existing, ok := taken[nameKey(name)]
+	if !ok {
+		return name, nil, nil
+	}
+
+	switch policy {
+	case enums.ConflictRename:
+		for i := 2; ; i++ {
+			suffix := fmt.Sprintf(" (%d)%s", i, ext)
+			if len(base)+len(suffix) <= maxNameLength {
+				if _, ok := taken[nameKey(base+suffix)]; !ok {
+					return base + suffix, nil, nil
+				}
+				continue
+			}
+
+			// The base is shortened to keep the name within maxNameLength. Siblings
+			// starting with the shortened base were not all listed above.
+			if len(suffix) >= maxNameLength {
+				return "", nil, errNameConflict
+			}
+			candidate := truncateName(base, maxNameLength-len(suffix)) + suffix
+			free, err := nameFree(ctx, db, directoryID, candidate, selfID)
+			if err != nil {
+				return "", nil, err
+			}
+			if free {
+				return candidate, nil, nil
+			}
+		}
+	case enums.ConflictNewVersion:
+		if !existing.IsDirectory {
+			return name, &existing, nil
+		}
+	}
+
+	return "", nil, errNameConflict
+}
+
+func nameKey(name string) string {
+	if config.Cfg.Application.CaseInsensitiveNames {
+		return strings.ToLower(name)
+	}
+	return name
+}
+
+// nameFree reports whether no item but selfID is named name inside directoryID.
+func nameFree(ctx context.Context, db *gorm.DB, directoryID, name, selfID string) (bool, error) {
+	siblings, err := repositories.ListChildrenByName(ctx, db, directoryID, name)
+	if err != nil {
+		return false, err
+	}
+	for _, sibling := range siblings {
+		if sibling.ID != selfID && nameKey(sibling.Name) == nameKey(name) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// truncateName cuts name to at most n bytes without splitting a UTF-8 sequence.
+func truncateName(name string, n int) string {
+	if len(name) <= n {
+		return name
+	}
+	for n > 0 && !utf8.RuneStart(name[n]) {
+		n--
+	}
+	return name[:n]
+}
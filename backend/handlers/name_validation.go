@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxNameLength matches the size of the name columns of the files and directories tables.
+const maxNameLength = 255
+
+// reservedNames cannot be used as a file or directory name, with or without an extension,
+// because they have a special meaning on common file systems.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// validateName checks a file or directory name given by a client. It returns nil when
+// the name is acceptable and the error to send back otherwise.
+func validateName(name string) *apis.ErrorResponse {
+	if strings.TrimSpace(name) == "" {
+		return &apis.ErrorResponse{
+			Message: "name is required",
+			Code:    enums.EmptyNameError,
+		}
+	}
+
+	if len(name) > maxNameLength {
+		return &apis.ErrorResponse{
+			Message: fmt.Sprintf("name must be at most %d bytes", maxNameLength),
+			Code:    enums.NameTooLongError,
+		}
+	}
+
+	if strings.ContainsAny(name, `/\`) {
+		return &apis.ErrorResponse{
+			Message: "name must not contain path separators",
+			Code:    enums.NameContainsSeparatorError,
+		}
+	}
+
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return &apis.ErrorResponse{
+			Message: "name must not contain control characters",
+			Code:    enums.NameContainsControlCharError,
+		}
+	}
+
+	stem, _, _ := strings.Cut(name, ".")
+	if name == "." || name == ".." || reservedNames[strings.ToUpper(strings.TrimSpace(stem))] {
+		return &apis.ErrorResponse{
+			Message: fmt.Sprintf("%q is a reserved name", name),
+			Code:    enums.ReservedNameError,
+		}
+	}
+
+	return nil
+}
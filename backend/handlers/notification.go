@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"context"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// newNotification tells userID about a change by the user making the request to an item,
+// to be stored with createNotifications.
+func newNotification(c *gin.Context, notificationType enums.NotificationType, userID, itemID string, isDirectory bool, details map[string]interface{}) models.Notification {
+	// Details only holds strings, which always marshal.
+	rawDetails, _ := json.Marshal(details)
+
+	return models.Notification{
+		NotificationID: uuid.New().String(),
+		UserID:         userID,
+		Type:           string(notificationType),
+		ActorID:        c.Request.Context().Value(enums.UserIDCtxKey).(string),
+		ItemID:         itemID,
+		IsDirectory:    isDirectory,
+		Details:        string(rawDetails),
+		CreatedAt:      time.Now(),
+	}
+}
+
+// createNotifications stores notifications in the transaction making the change, flagging
+// those whose user wants their type emailed. Users are not notified of their own doings.
+func createNotifications(ctx context.Context, tx *gorm.DB, notifications []models.Notification) error {
+	notifications = slices.DeleteFunc(notifications, func(notification models.Notification) bool {
+		return notification.UserID == notification.ActorID
+	})
+
+	userIDs := make([]string, 0, len(notifications))
+	for _, notification := range notifications {
+		userIDs = append(userIDs, notification.UserID)
+	}
+	userSettings, err := repositories.ListUserSettingsByUserIDs(ctx, tx, userIDs)
+	if err != nil {
+		return err
+	}
+	emailTypes := make(map[string][]string, len(userSettings))
+	for _, userSetting := range userSettings {
+		if userSetting.NotificationPreferences != nil {
+			emailTypes[userSetting.UserID] = userSetting.NotificationPreferences.EmailTypes
+		}
+	}
+
+	for i := range notifications {
+		notifications[i].EmailPending = slices.Contains(emailTypes[notifications[i].UserID], notifications[i].Type)
+	}
+	return repositories.CreateNotifications(ctx, tx, notifications)
+}
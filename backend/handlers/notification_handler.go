@@ -0,0 +1,295 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type NotificationHandler struct {
+	NotificationRepo repositories.NotificationRepoInterface
+	UserSettingRepo  repositories.UserSettingRepoInterface
+	db               *gorm.DB
+}
+
+type NotificationHandlerInterface interface {
+	ListNotifications(c *gin.Context)
+	ReadNotification(c *gin.Context)
+	ReadNotifications(c *gin.Context)
+	GetNotificationPreferences(c *gin.Context)
+	UpdateNotificationPreferences(c *gin.Context)
+}
+
+func NewNotificationHandler(db *gorm.DB) NotificationHandlerInterface {
+	return &NotificationHandler{
+		NotificationRepo: repositories.NewNotificationRepo(db),
+		UserSettingRepo:  repositories.NewUserSettingRepo(db),
+		db:               db,
+	}
+}
+
+// ListNotifications returns the notifications of the current user, newest first, optionally
+// only the unread ones, along with how many are unread.
+func (h *NotificationHandler) ListNotifications(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid limit",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+	params := repositories.ListNotificationsParams{UserID: userID, Limit: limit}
+
+	if unread := c.Query("unread"); unread != "" {
+		params.UnreadOnly, err = strconv.ParseBool(unread)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid unread",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.NotificationCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	page, err := h.NotificationRepo.ListNotifications(ctx, params)
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+	unreadCount, err := h.NotificationRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+
+	actorIDs := make([]string, 0, len(page.Notifications))
+	for _, notification := range page.Notifications {
+		actorIDs = append(actorIDs, notification.ActorID)
+	}
+	users, err := usersByID(ctx, h.db, actorIDs)
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+
+	resp := apis.ListNotificationsResponse{
+		Notifications: make([]apis.Notification, 0, len(page.Notifications)),
+		UnreadCount:   unreadCount,
+	}
+	for i := range page.Notifications {
+		resp.Notifications = append(resp.Notifications, notificationResponse(&page.Notifications[i], users))
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ReadNotification marks a notification of the current user read. Reading it again keeps
+// the time it was first read.
+func (h *NotificationHandler) ReadNotification(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	notification, err := repositories.MarkNotificationRead(ctx, h.db, userID, c.Param("notification_id"), time.Now())
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+
+	users, err := usersByID(ctx, h.db, []string{notification.ActorID})
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notificationResponse(notification, users))
+}
+
+// ReadNotifications marks the given notifications of the current user read, or all of
+// them. IDs of notifications which are unknown or read already are skipped.
+func (h *NotificationHandler) ReadNotifications(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var readNotificationsReq apis.ReadNotificationsRequest
+	if err := c.BindJSON(&readNotificationsReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := readNotificationsReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var notificationIDs []string
+	if !readNotificationsReq.All {
+		notificationIDs = readNotificationsReq.NotificationIDs
+	}
+	marked, err := repositories.MarkNotificationsRead(ctx, h.db, userID, notificationIDs, time.Now())
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+	unreadCount, err := h.NotificationRepo.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.ReadNotificationsResponse{
+		Marked:      marked,
+		UnreadCount: unreadCount,
+	})
+}
+
+// GetNotificationPreferences returns which notification types the current user has
+// emailed. None are until they choose.
+func (h *NotificationHandler) GetNotificationPreferences(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	userSetting, err := h.UserSettingRepo.GetUserSettingsByUserID(ctx, userID, false)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		respondWithNotificationError(c, err)
+		return
+	}
+	if err != nil {
+		userSetting = &models.UserSetting{}
+	}
+
+	c.JSON(http.StatusOK, notificationPreferencesResponse(userSetting.NotificationPreferences))
+}
+
+// UpdateNotificationPreferences replaces the notification types the current user has
+// emailed. It applies to notifications created from then on.
+func (h *NotificationHandler) UpdateNotificationPreferences(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var preferencesReq apis.NotificationPreferences
+	if err := c.BindJSON(&preferencesReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := preferencesReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	emailTypes := slices.Clone(preferencesReq.Email)
+	slices.Sort(emailTypes)
+	preferences := &models.NotificationPreferences{EmailTypes: slices.Compact(emailTypes)}
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		userSetting, err := repositories.GetUserSettingsByUserID(ctx, tx, userID, true)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// The settings are created without storage, which CreateUserSetting fills in
+			// later.
+			userSetting = &models.UserSetting{
+				UserSettingID:           uuid.New().String(),
+				UserID:                  userID,
+				NotificationPreferences: preferences,
+				CreatedAt:               now,
+				UpdatedAt:               now,
+			}
+			err = repositories.CreateUserSetting(ctx, tx, userSetting)
+		case err == nil:
+			userSetting.NotificationPreferences = preferences
+			userSetting.UpdatedAt = now
+			err = repositories.UpdateUserSetting(ctx, tx, userSetting)
+		}
+		if err != nil {
+			return err
+		}
+
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditNotificationPreferencesUpdated, enums.AuditTargetUserSetting, userSetting.UserSettingID, map[string]interface{}{
+			"email": preferences.EmailTypes,
+		}))
+	})
+	if err != nil {
+		respondWithNotificationError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notificationPreferencesResponse(preferences))
+}
+
+func respondWithNotificationError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Notification not found",
+			Code:    enums.NotificationNotFoundError,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+		Message: err.Error(),
+		Code:    enums.InternalError,
+	})
+}
+
+func notificationResponse(notification *models.Notification, users map[string]*models.User) apis.Notification {
+	return apis.Notification{
+		NotificationID: notification.NotificationID,
+		Type:           notification.Type,
+		Actor:          userSummary(notification.ActorID, users),
+		ItemID:         notification.ItemID,
+		IsDirectory:    notification.IsDirectory,
+		Details:        json.RawMessage(notification.Details),
+		Read:           notification.ReadAt != nil,
+		ReadAt:         notification.ReadAt,
+		CreatedAt:      notification.CreatedAt,
+	}
+}
+
+func notificationPreferencesResponse(preferences *models.NotificationPreferences) apis.NotificationPreferences {
+	resp := apis.NotificationPreferences{Email: []string{}}
+	if preferences != nil && preferences.EmailTypes != nil {
+		resp.Email = preferences.EmailTypes
+	}
+	return resp
+}
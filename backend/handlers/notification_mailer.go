@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"dam/config"
+	"dam/enums"
+	"dam/mail"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	notificationMailInterval  = 10 * time.Second
+	notificationMailBatchSize = 50
+)
+
+// NotificationMailer emails the notifications whose users asked for their type to be
+// emailed. Notifications are flagged in the transaction creating them and emailed from
+// here, so that a rolled back change sends nothing and a slow mail server does not delay
+// requests. Every instance runs one; notifications are claimed with SKIP LOCKED.
+type NotificationMailer struct {
+	db     *gorm.DB
+	sender mail.Sender
+	logger *zap.Logger
+}
+
+func NewNotificationMailer(db *gorm.DB, sender mail.Sender, logger *zap.Logger) *NotificationMailer {
+	return &NotificationMailer{
+		db:     db,
+		sender: sender,
+		logger: logger,
+	}
+}
+
+// Run emails pending notifications every notificationMailInterval until ctx is done.
+func (m *NotificationMailer) Run(ctx context.Context) {
+	ticker := time.NewTicker(notificationMailInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.sendPending(ctx); err != nil {
+			m.logger.Sugar().Errorf("email notifications error: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *NotificationMailer) sendPending(ctx context.Context) error {
+	for {
+		notifications, err := repositories.ClaimPendingNotificationEmails(ctx, m.db, notificationMailBatchSize)
+		if err != nil || len(notifications) == 0 {
+			return err
+		}
+
+		userIDs := make([]string, 0, 2*len(notifications))
+		for _, notification := range notifications {
+			userIDs = append(userIDs, notification.UserID, notification.ActorID)
+		}
+		users, err := usersByID(ctx, m.db, userIDs)
+		if err != nil {
+			return err
+		}
+
+		for i := range notifications {
+			notification := &notifications[i]
+			user, ok := users[notification.UserID]
+			// Only verified addresses of active users are emailed.
+			if !ok || user.EmailVerifiedAt == nil || user.DisabledAt != nil {
+				continue
+			}
+			message := notificationMessage(notification, user, users[notification.ActorID])
+			if err := m.sender.Send(ctx, message); err != nil {
+				m.logger.Sugar().Errorf("send notification %s to user %s error: %s", notification.NotificationID, user.UserID, err.Error())
+			}
+		}
+
+		if len(notifications) < notificationMailBatchSize {
+			return nil
+		}
+	}
+}
+
+// notificationMessage words notification for an email to user. Actor is nil for a user
+// who is gone.
+func notificationMessage(notification *models.Notification, user, actor *models.User) *mail.Message {
+	actorName := "Someone"
+	if actor != nil {
+		actorName = actor.Name
+		if actorName == "" {
+			actorName = actor.Username
+		}
+	}
+	var details struct {
+		FileName string `json:"file_name"`
+		Decision string `json:"decision"`
+	}
+	// Details are stored as JSON by newNotification.
+	_ = json.Unmarshal([]byte(notification.Details), &details)
+
+	var summary string
+	switch enums.NotificationType(notification.Type) {
+	case enums.NotificationReviewRequested:
+		summary = fmt.Sprintf("%s asked you to review %s", actorName, details.FileName)
+	case enums.NotificationReviewDecided:
+		if details.Decision == string(enums.ReviewDecisionApproved) {
+			summary = fmt.Sprintf("%s approved %s", actorName, details.FileName)
+		} else {
+			summary = fmt.Sprintf("%s requested changes to %s", actorName, details.FileName)
+		}
+	case enums.NotificationMentioned:
+		summary = fmt.Sprintf("%s mentioned you in a comment on %s", actorName, details.FileName)
+	default:
+		summary = fmt.Sprintf("%s did something which concerns you", actorName)
+	}
+
+	return &mail.Message{
+		To:      user.Email,
+		Subject: summary,
+		Body: fmt.Sprintf("Hi %s,\n\n%s.\n\n%s\n\nYou can choose which notifications are emailed to you in your notification preferences.\n",
+			user.Name, summary, config.Cfg.Application.PublicURL),
+	}
+}
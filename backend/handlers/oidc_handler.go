@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxUsernameLength matches the users.username column.
+const maxUsernameLength = 20
+
+var (
+	errOIDCMissingEmail     = errors.New("the identity provider did not share an email address")
+	errUnverifiedEmailInUse = errors.New("an account already uses this email address, which the identity provider has not verified")
+	errNoUsernameAvailable  = errors.New("no username available")
+)
+
+type OIDCHandler struct {
+	Provider       *auth.OIDCProvider
+	TokenManager   *auth.TokenManager
+	SessionStore   *auth.SessionStore
+	ChallengeStore *auth.TwoFactorChallengeStore
+	db             *gorm.DB
+}
+
+type OIDCHandlerInterface interface {
+	StartLogin(c *gin.Context)
+	Callback(c *gin.Context)
+}
+
+func NewOIDCHandler(db *gorm.DB, provider *auth.OIDCProvider, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore, challengeStore *auth.TwoFactorChallengeStore) OIDCHandlerInterface {
+	return &OIDCHandler{
+		Provider:       provider,
+		TokenManager:   tokenManager,
+		SessionStore:   sessionStore,
+		ChallengeStore: challengeStore,
+		db:             db,
+	}
+}
+
+// StartLogin sends the user to the identity provider.
+func (h *OIDCHandler) StartLogin(c *gin.Context) {
+	authURL, err := h.Provider.StartLogin(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.OIDCLoginError,
+		})
+		return
+	}
+
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback is where the identity provider sends the user back to. It logs in the user
+// owning the identity, provisioning or linking an account on first login. The identity
+// provider stands in for the password only, so a second factor is asked for as on Login.
+func (h *OIDCHandler) Callback(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: strings.TrimSpace(providerErr + " " + c.Query("error_description")),
+			Code:    enums.OIDCLoginError,
+		})
+		return
+	}
+
+	code, state := c.Query("code"), c.Query("state")
+	if code == "" || state == "" {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "code and state are required",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	claims, err := h.Provider.FinishLogin(ctx, code, state)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrInvalidOIDCState):
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InvalidOIDCStateError,
+			})
+		case errors.Is(err, auth.ErrInvalidIDToken):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.OIDCLoginError,
+			})
+		default:
+			c.JSON(http.StatusBadGateway, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.OIDCLoginError,
+			})
+		}
+		return
+	}
+
+	var user *models.User
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = provisionOIDCUser(ctx, tx, claims)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCMissingEmail):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.OIDCLoginError,
+			})
+		case errors.Is(err, errUnverifiedEmailInUse):
+			c.JSON(http.StatusConflict, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.AccountLinkConflictError,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+		}
+		return
+	}
+
+	if user.DisabledAt != nil {
+		respondWithAccountDisabled(c)
+		return
+	}
+
+	finishLogin(c, h.db, h.TokenManager, h.SessionStore, h.ChallengeStore, user, "")
+}
+
+// provisionOIDCUser returns the user claims identify. An unknown identity is linked to the
+// account with the same email address when the provider verified that address, otherwise
+// a new account is created.
+func provisionOIDCUser(ctx context.Context, tx *gorm.DB, claims *auth.IDTokenClaims) (*models.User, error) {
+	identity, err := repositories.GetUserIdentity(ctx, tx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return repositories.GetUserByID(ctx, tx, identity.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if claims.Email == "" {
+		return nil, errOIDCMissingEmail
+	}
+
+	user, err := repositories.GetUserByEmail(ctx, tx, claims.Email)
+	switch {
+	case err == nil:
+		// Linking on an unverified address would let anyone able to register it at the
+		// provider take over the account.
+		if !claims.EmailVerified {
+			return nil, errUnverifiedEmailInUse
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user, err = createOIDCUser(ctx, tx, claims)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	err = repositories.CreateUserIdentity(ctx, tx, &models.UserIdentity{
+		Issuer:    claims.Issuer,
+		Subject:   claims.Subject,
+		UserID:    user.UserID,
+		Email:     claims.Email,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// createOIDCUser creates an account without a password, so that it can only be used
+// through the identity provider.
+func createOIDCUser(ctx context.Context, tx *gorm.DB, claims *auth.IDTokenClaims) (*models.User, error) {
+	username, err := availableUsername(ctx, tx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = username
+	}
+
+	now := time.Now()
+	user := &models.User{
+		UserID:    uuid.New().String(),
+		Username:  username,
+		Email:     claims.Email,
+		Name:      name,
+		Role:      string(enums.RoleUser),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if claims.EmailVerified {
+		user.EmailVerifiedAt = &now
+	}
+	return user, repositories.CreateUser(ctx, tx, user)
+}
+
+// availableUsername derives a free username from the preferred username or the email
+// address, appending a number when it is taken.
+func availableUsername(ctx context.Context, tx *gorm.DB, claims *auth.IDTokenClaims) (string, error) {
+	base := sanitizeUsername(claims.PreferredUsername)
+	if base == "" {
+		base = sanitizeUsername(strings.SplitN(claims.Email, "@", 2)[0])
+	}
+	if base == "" {
+		base = "user"
+	}
+
+	for i := 1; i <= 100; i++ {
+		candidate := base
+		if i > 1 {
+			suffix := fmt.Sprint(i)
+			candidate = base[:min(len(base), maxUsernameLength-len(suffix))] + suffix
+		}
+
+		_, err := repositories.GetUserByUsername(ctx, tx, candidate)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", errNoUsernameAvailable
+}
+
+func sanitizeUsername(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '.' || r == '_' || r == '-' {
+			b.WriteRune(r)
+		}
+		if b.Len() == maxUsernameLength {
+			break
+		}
+	}
+	return b.String()
+}
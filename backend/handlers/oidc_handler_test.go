@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"context"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const testIssuer = "https://idp.example"
+
+func createTestUser(t *testing.T, db *gorm.DB, username, email string) *models.User {
+	t.Helper()
+
+	now := time.Now()
+	user := &models.User{
+		UserID:    uuid.New().String(),
+		Username:  username,
+		Email:     email,
+		Name:      username,
+		Role:      string(enums.RoleUser),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := repositories.CreateUser(context.Background(), db, user); err != nil {
+		t.Fatalf("create user: %s", err)
+	}
+	return user
+}
+
+func provisionInTx(db *gorm.DB, claims *auth.IDTokenClaims) (*models.User, error) {
+	var user *models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = provisionOIDCUser(context.Background(), tx, claims)
+		return err
+	})
+	return user, err
+}
+
+func TestProvisionOIDCUserCreatesUser(t *testing.T) {
+	db := newTestDB(t)
+	createTestUser(t, db, "ada.l", "someone@example.com")
+
+	claims := &auth.IDTokenClaims{
+		Issuer:            testIssuer,
+		Subject:           "subject-1",
+		Email:             "ada@example.com",
+		EmailVerified:     true,
+		Name:              "Ada Lovelace",
+		PreferredUsername: "Ada.L",
+	}
+	user, err := provisionInTx(db, claims)
+	if err != nil {
+		t.Fatalf("provisionOIDCUser: %s", err)
+	}
+	if user.Username != "ada.l2" || user.Email != claims.Email || user.Name != claims.Name {
+		t.Errorf("provisioned %+v", user)
+	}
+	if user.PasswordHash != "" {
+		t.Error("a provisioned user has a password")
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("the verified email of a provisioned user is not marked verified")
+	}
+
+	// The next login finds the user through the identity.
+	again, err := provisionInTx(db, claims)
+	if err != nil {
+		t.Fatalf("provisionOIDCUser: %s", err)
+	}
+	if again.UserID != user.UserID {
+		t.Errorf("second login returned user %s, want %s", again.UserID, user.UserID)
+	}
+}
+
+func TestProvisionOIDCUserLinksVerifiedEmail(t *testing.T) {
+	db := newTestDB(t)
+	existing := createTestUser(t, db, "ada", "ada@example.com")
+
+	user, err := provisionInTx(db, &auth.IDTokenClaims{
+		Issuer:        testIssuer,
+		Subject:       "subject-1",
+		Email:         "ada@example.com",
+		EmailVerified: true,
+	})
+	if err != nil {
+		t.Fatalf("provisionOIDCUser: %s", err)
+	}
+	if user.UserID != existing.UserID {
+		t.Fatalf("linked user %s, want %s", user.UserID, existing.UserID)
+	}
+
+	identity, err := repositories.GetUserIdentity(context.Background(), db, testIssuer, "subject-1")
+	if err != nil {
+		t.Fatalf("GetUserIdentity: %s", err)
+	}
+	if identity.UserID != existing.UserID {
+		t.Errorf("identity belongs to %s, want %s", identity.UserID, existing.UserID)
+	}
+}
+
+func TestProvisionOIDCUserRejectsUnverifiedEmailInUse(t *testing.T) {
+	db := newTestDB(t)
+	createTestUser(t, db, "ada", "ada@example.com")
+
+	_, err := provisionInTx(db, &auth.IDTokenClaims{
+		Issuer:  testIssuer,
+		Subject: "subject-1",
+		Email:   "ada@example.com",
+	})
+	if !errors.Is(err, errUnverifiedEmailInUse) {
+		t.Fatalf("provisionOIDCUser returned %v, want %v", err, errUnverifiedEmailInUse)
+	}
+
+	_, err = repositories.GetUserIdentity(context.Background(), db, testIssuer, "subject-1")
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("GetUserIdentity returned %v, want no identity", err)
+	}
+}
+
+func TestProvisionOIDCUserRequiresEmail(t *testing.T) {
+	db := newTestDB(t)
+
+	_, err := provisionInTx(db, &auth.IDTokenClaims{Issuer: testIssuer, Subject: "subject-1"})
+	if !errors.Is(err, errOIDCMissingEmail) {
+		t.Fatalf("provisionOIDCUser returned %v, want %v", err, errOIDCMissingEmail)
+	}
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	tests := map[string]string{
+		"Ada.Lovelace":                  "ada.lovelace",
+		"ada lovelace!":                 "adalovelace",
+		"Ädä":                           "d",
+		"a_very-long.username_indeed42": "a_very-long.username",
+		"":                              "",
+	}
+	for in, want := range tests {
+		if got := sanitizeUsername(in); got != want {
+			t.Errorf("sanitizeUsername(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/models"
+	"dam/repositories"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// breadcrumbs returns the directories making up fullPath, ordered from the root down.
+// FullPath is a chain of directory IDs, so the names have to be looked up.
+func breadcrumbs(ctx context.Context, db *gorm.DB, fullPath string) ([]models.Directory, error) {
+	directoriesByID, err := pathDirectories(ctx, db, fullPath)
+	if err != nil {
+		return nil, err
+	}
+	return breadcrumbsFrom(directoriesByID, fullPath), nil
+}
+
+// pathDirectories loads every directory appearing in fullPaths with a single query, so that
+// the display paths of a whole list of items can be built at once.
+func pathDirectories(ctx context.Context, db *gorm.DB, fullPaths ...string) (map[string]models.Directory, error) {
+	directoryIDs := []string{}
+	for _, fullPath := range fullPaths {
+		directoryIDs = append(directoryIDs, strings.FieldsFunc(fullPath, isPathSeparator)...)
+	}
+
+	directories, err := repositories.ListDirectoriesByIDs(ctx, db, directoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	directoriesByID := make(map[string]models.Directory, len(directories))
+	for _, directory := range directories {
+		directoriesByID[directory.DirectoryID] = directory
+	}
+	return directoriesByID, nil
+}
+
+func breadcrumbsFrom(directoriesByID map[string]models.Directory, fullPath string) []models.Directory {
+	directoryIDs := strings.FieldsFunc(fullPath, isPathSeparator)
+	crumbs := make([]models.Directory, 0, len(directoryIDs))
+	for _, directoryID := range directoryIDs {
+		if directory, ok := directoriesByID[directoryID]; ok {
+			crumbs = append(crumbs, directory)
+		}
+	}
+	return crumbs
+}
+
+func isPathSeparator(r rune) bool {
+	return r == '/'
+}
+
+// fileDirectoryFullPath returns the FullPath of the directory holding file.
+func fileDirectoryFullPath(file *models.File) string {
+	idx := strings.LastIndex(file.FullPath, "/")
+	if idx < 0 {
+		return ""
+	}
+	return file.FullPath[:idx]
+}
+
+func displayPath(crumbs []models.Directory, names ...string) string {
+	parts := make([]string, 0, len(crumbs)+len(names))
+	for _, crumb := range crumbs {
+		parts = append(parts, crumb.Name)
+	}
+	parts = append(parts, names...)
+	return "/" + strings.Join(parts, "/")
+}
+
+func directoryDisplayPath(ctx context.Context, db *gorm.DB, directory *models.Directory) (string, error) {
+	crumbs, err := breadcrumbs(ctx, db, directory.FullPath)
+	if err != nil {
+		return "", err
+	}
+	return displayPath(crumbs), nil
+}
+
+func fileDisplayPath(ctx context.Context, db *gorm.DB, file *models.File) (string, error) {
+	crumbs, err := breadcrumbs(ctx, db, fileDirectoryFullPath(file))
+	if err != nil {
+		return "", err
+	}
+	return displayPath(crumbs, file.Name), nil
+}
+
+func breadcrumbsResponse(crumbs []models.Directory, displayPath string) apis.BreadcrumbsResponse {
+	items := make([]apis.Breadcrumb, 0, len(crumbs))
+	for _, crumb := range crumbs {
+		items = append(items, apis.Breadcrumb{
+			DirectoryID: crumb.DirectoryID,
+			Name:        crumb.Name,
+		})
+	}
+	return apis.BreadcrumbsResponse{
+		Breadcrumbs: items,
+		DisplayPath: displayPath,
+	}
+}
+
+func fileResponse(file *models.File, displayPath string) apis.File {
+	return apis.File{
+		FileID:      file.FileID,
+		Name:        file.Name,
+		Size:        file.Size,
+		Extension:   file.Extension,
+		UserID:      file.UserID,
+		DirectoryID: file.DirectoryID,
+		FullPath:    file.FullPath,
+		DisplayPath: displayPath,
+		Description: file.Description,
+		Tags:        file.Tags,
+		CreatedAt:   file.CreatedAt,
+		UpdatedAt:   file.UpdatedAt,
+	}
+}
+
+func directoryResponse(dir *models.Directory, displayPath string) apis.Directory {
+	return apis.Directory{
+		DirectoryID:       dir.DirectoryID,
+		Name:              dir.Name,
+		FullPath:          dir.FullPath,
+		DisplayPath:       displayPath,
+		UserID:            dir.UserID,
+		Level:             dir.Level,
+		ParentDirectoryID: dir.ParentDirectoryID,
+		CreatedAt:         dir.CreatedAt,
+		UpdatedAt:         dir.UpdatedAt,
+	}
+}
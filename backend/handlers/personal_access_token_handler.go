@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type PersonalAccessTokenHandler struct {
+	PersonalAccessTokenRepo repositories.PersonalAccessTokenRepoInterface
+	db                      *gorm.DB
+}
+
+type PersonalAccessTokenHandlerInterface interface {
+	CreatePersonalAccessToken(c *gin.Context)
+	ListPersonalAccessTokens(c *gin.Context)
+	RevokePersonalAccessToken(c *gin.Context)
+}
+
+func NewPersonalAccessTokenHandler(db *gorm.DB) PersonalAccessTokenHandlerInterface {
+	return &PersonalAccessTokenHandler{
+		PersonalAccessTokenRepo: repositories.NewPersonalAccessTokenRepo(db),
+		db:                      db,
+	}
+}
+
+// CreatePersonalAccessToken returns the new token once; only its hash is stored.
+func (h *PersonalAccessTokenHandler) CreatePersonalAccessToken(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var createTokenReq apis.CreatePersonalAccessTokenRequest
+	if err := c.BindJSON(&createTokenReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := createTokenReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	tokenStr, tokenHash, err := auth.NewPersonalAccessToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	scopes := slices.Clone(createTokenReq.Scopes)
+	slices.Sort(scopes)
+	token := models.PersonalAccessToken{
+		PersonalAccessTokenID: uuid.New().String(),
+		UserID:                ctx.Value(enums.UserIDCtxKey).(string),
+		Name:                  createTokenReq.Name,
+		TokenHash:             tokenHash,
+		Scopes:                slices.Compact(scopes),
+		ExpiresAt:             createTokenReq.ExpiresAt,
+		CreatedAt:             time.Now(),
+	}
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.CreatePersonalAccessToken(ctx, tx, &token); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditAccessTokenCreated, enums.AuditTargetPersonalAccessToken, token.PersonalAccessTokenID, map[string]interface{}{
+			"name":   token.Name,
+			"scopes": []string(token.Scopes),
+		}))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, apis.CreatePersonalAccessTokenResponse{
+		PersonalAccessToken: personalAccessTokenResponse(&token),
+		Token:               tokenStr,
+	})
+}
+
+func (h *PersonalAccessTokenHandler) ListPersonalAccessTokens(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	tokens, err := h.PersonalAccessTokenRepo.ListPersonalAccessTokensByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	items := make([]apis.PersonalAccessToken, 0, len(tokens))
+	for i := range tokens {
+		items = append(items, personalAccessTokenResponse(&tokens[i]))
+	}
+
+	c.JSON(http.StatusOK, apis.ListPersonalAccessTokensResponse{Tokens: items})
+}
+
+func (h *PersonalAccessTokenHandler) RevokePersonalAccessToken(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	tokenID := c.Param("token_id")
+	var revoked bool
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		revoked, err = repositories.RevokePersonalAccessToken(ctx, tx, userID, tokenID)
+		if err != nil || !revoked {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditAccessTokenRevoked, enums.AuditTargetPersonalAccessToken, tokenID, nil))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	if !revoked {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Personal access token not found",
+			Code:    enums.PersonalAccessTokenNotFoundError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func personalAccessTokenResponse(token *models.PersonalAccessToken) apis.PersonalAccessToken {
+	return apis.PersonalAccessToken{
+		PersonalAccessTokenID: token.PersonalAccessTokenID,
+		Name:                  token.Name,
+		Scopes:                token.Scopes,
+		ExpiresAt:             token.ExpiresAt,
+		LastUsedAt:            token.LastUsedAt,
+		CreatedAt:             token.CreatedAt,
+	}
+}
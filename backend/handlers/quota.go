@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/config"
+	"dam/models"
+	"dam/repositories"
+
+	"gorm.io/gorm"
+)
+
+// storageLimits returns the soft and hard limit of usage in bytes, falling back to the
+// configured defaults. Zero means unlimited.
+func storageLimits(usage *models.StorageUsage) (softLimit, hardLimit int64) {
+	softLimit, hardLimit = config.Cfg.Quota.DefaultSoftLimit, config.Cfg.Quota.DefaultHardLimit
+	if usage.SoftLimitBytes != nil {
+		softLimit = *usage.SoftLimitBytes
+	}
+	if usage.HardLimitBytes != nil {
+		hardLimit = *usage.HardLimitBytes
+	}
+	return softLimit, hardLimit
+}
+
+// chargeStorage adds size bytes to the usage of userID. It fails with errQuotaExceeded when
+// that would cross the hard limit of the user or of the workspace, and reports whether the
+// user is over their soft limit afterwards. The usage row, and the workspace total when it
+// is limited, stay locked until tx ends.
+func chargeStorage(ctx context.Context, tx *gorm.DB, userID string, size int64) (bool, error) {
+	usage, err := repositories.GetStorageUsageByUserID(ctx, tx, userID, true)
+	if err != nil {
+		return false, err
+	}
+
+	softLimit, hardLimit := storageLimits(usage)
+	if hardLimit > 0 && usage.UsedBytes+size > hardLimit {
+		return false, errQuotaExceeded
+	}
+
+	if workspaceLimit := config.Cfg.Quota.WorkspaceHardLimit; workspaceLimit > 0 {
+		// Taken after the usage row, always in this order, so that charges do not deadlock.
+		if err := repositories.LockWorkspaceStorage(ctx, tx); err != nil {
+			return false, err
+		}
+		total, err := repositories.GetTotalStorageUsage(ctx, tx)
+		if err != nil {
+			return false, err
+		}
+		if total+size > workspaceLimit {
+			return false, errQuotaExceeded
+		}
+	}
+
+	if err := repositories.AddStorageUsage(ctx, tx, userID, size); err != nil {
+		return false, err
+	}
+	return softLimit > 0 && usage.UsedBytes+size > softLimit, nil
+}
+
+func storageUsageResponse(usage *models.StorageUsage, byDirectory, byMimeFamily []models.StorageUsageBreakdown) apis.StorageUsageResponse {
+	toAPI := func(breakdowns []models.StorageUsageBreakdown) []apis.StorageUsageBreakdown {
+		breakdownsAPI := make([]apis.StorageUsageBreakdown, 0, len(breakdowns))
+		for _, breakdown := range breakdowns {
+			breakdownsAPI = append(breakdownsAPI, apis.StorageUsageBreakdown{
+				Key:       breakdown.Key,
+				Name:      breakdown.Name,
+				UsedBytes: breakdown.UsedBytes,
+			})
+		}
+		return breakdownsAPI
+	}
+
+	softLimit, hardLimit := storageLimits(usage)
+	return apis.StorageUsageResponse{
+		UsedBytes:        usage.UsedBytes,
+		SoftLimitBytes:   softLimit,
+		HardLimitBytes:   hardLimit,
+		SoftLimitReached: softLimit > 0 && usage.UsedBytes > softLimit,
+		ByDirectory:      toAPI(byDirectory),
+		ByMimeFamily:     toAPI(byMimeFamily),
+	}
+}
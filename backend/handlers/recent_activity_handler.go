@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultRecentActivitiesLimit = 20
+	maxRecentActivitiesLimit     = 100
+)
+
+type RecentActivityHandler struct {
+	RecentActivityRepo repositories.RecentActivityRepoInterface
+	db                 *gorm.DB
+}
+
+type RecentActivityHandlerInterface interface {
+	ListRecentActivities(c *gin.Context)
+}
+
+func NewRecentActivityHandler(db *gorm.DB) RecentActivityHandlerInterface {
+	return &RecentActivityHandler{
+		RecentActivityRepo: repositories.NewRecentActivityRepo(db),
+		db:                 db,
+	}
+}
+
+// ListRecentActivities returns the files the current user most recently viewed, downloaded
+// or uploaded, each with the latest of those actions.
+func (h *RecentActivityHandler) ListRecentActivities(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	limit := defaultRecentActivitiesLimit
+	if s := c.Query("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 || n > maxRecentActivitiesLimit {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "limit must be between 1 and 100",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+		limit = n
+	}
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	recentActivities, err := h.RecentActivityRepo.ListRecentActivitiesByUserID(ctx, userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	fileIDs := make([]string, 0, len(recentActivities))
+	for _, recentActivity := range recentActivities {
+		fileIDs = append(fileIDs, recentActivity.FileID)
+	}
+
+	files, err := repositories.ListFilesByIDs(ctx, h.db, fileIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	fullPaths := make([]string, 0, len(files))
+	filesByID := make(map[string]*models.File, len(files))
+	for i := range files {
+		filesByID[files[i].FileID] = &files[i]
+		fullPaths = append(fullPaths, fileDirectoryFullPath(&files[i]))
+	}
+
+	directoriesByID, err := pathDirectories(ctx, h.db, fullPaths...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	items := make([]apis.RecentActivity, 0, len(recentActivities))
+	for _, recentActivity := range recentActivities {
+		file, ok := filesByID[recentActivity.FileID]
+		if !ok {
+			continue
+		}
+		items = append(items, apis.RecentActivity{
+			Action:     recentActivity.Action,
+			AccessedAt: recentActivity.AccessedAt,
+			File:       fileResponse(file, displayPath(breadcrumbsFrom(directoriesByID, fileDirectoryFullPath(file)), file.Name)),
+		})
+	}
+
+	c.JSON(http.StatusOK, apis.ListRecentActivitiesResponse{Items: items})
+}
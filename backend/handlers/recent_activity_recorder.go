@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"context"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	recentActivityBufferSize   = 1024
+	recentActivityWriteTimeout = 5 * time.Second
+)
+
+// RecentActivityRecorder writes the recent activity of users in the background so that
+// recording never delays the request it comes from. When the buffer is full new events
+// are dropped: recent activity is a convenience, not a record.
+type RecentActivityRecorder struct {
+	recentActivityRepo repositories.RecentActivityRepoInterface
+	logger             *zap.Logger
+	events             chan models.RecentActivity
+}
+
+func NewRecentActivityRecorder(db *gorm.DB, logger *zap.Logger) *RecentActivityRecorder {
+	recorder := &RecentActivityRecorder{
+		recentActivityRepo: repositories.NewRecentActivityRepo(db),
+		logger:             logger,
+		events:             make(chan models.RecentActivity, recentActivityBufferSize),
+	}
+	go recorder.run()
+	return recorder
+}
+
+func (r *RecentActivityRecorder) Record(userID, fileID string, action enums.RecentAction) {
+	select {
+	case r.events <- models.RecentActivity{
+		UserID:     userID,
+		FileID:     fileID,
+		Action:     string(action),
+		AccessedAt: time.Now(),
+	}:
+	default:
+		r.logger.Sugar().Warnf("recent activity buffer full, dropping %s of file %s", action, fileID)
+	}
+}
+
+func (r *RecentActivityRecorder) run() {
+	for event := range r.events {
+		ctx, cancel := context.WithTimeout(context.Background(), recentActivityWriteTimeout)
+		if err := r.recentActivityRepo.SaveRecentActivity(ctx, &event); err != nil {
+			r.logger.Sugar().Errorf("save recent activity error: %s", err.Error())
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	errReviewNotFound        = errors.New("review not found")
+	errCannotRequestReview   = errors.New("only the owner of the file or the uploader of the version can submit it for review")
+	errCannotViewReviews     = errors.New("only the owner of the file, the uploader of the version and its reviewers can see its reviews")
+	errReviewerNotFound      = errors.New("reviewer not found")
+	errSelfReview            = errors.New("a version cannot be reviewed by whoever submits it")
+	errVersionNotReviewable  = errors.New("only a draft or rejected version can be submitted for review")
+	errVersionNotInReview    = errors.New("the version is not in review")
+	errReviewAlreadyDecided  = errors.New("the review is already decided")
+	errReviewVersionMismatch = errors.New("file version not found")
+)
+
+type ReviewHandler struct {
+	FileRepo          repositories.FileRepoInterface
+	VersionReviewRepo repositories.VersionReviewRepoInterface
+	db                *gorm.DB
+}
+
+type ReviewHandlerInterface interface {
+	RequestReview(c *gin.Context)
+	ListReviews(c *gin.Context)
+	DecideReview(c *gin.Context)
+	ListMyPendingReviews(c *gin.Context)
+}
+
+func NewReviewHandler(db *gorm.DB) ReviewHandlerInterface {
+	return &ReviewHandler{
+		FileRepo:          repositories.NewFileRepo(db),
+		VersionReviewRepo: repositories.NewVersionReviewRepo(db),
+		db:                db,
+	}
+}
+
+// RequestReview submits a draft or rejected file version to reviewers, replacing the
+// reviews of any previous round.
+func (h *ReviewHandler) RequestReview(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var requestReviewReq apis.RequestReviewRequest
+	if err := c.BindJSON(&requestReviewReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := requestReviewReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	reviewerIDs := slices.Clone(requestReviewReq.ReviewerIDs)
+	slices.Sort(reviewerIDs)
+	reviewerIDs = slices.Compact(reviewerIDs)
+	if slices.Contains(reviewerIDs, userID) {
+		respondWithReviewError(c, errSelfReview)
+		return
+	}
+
+	var file *models.File
+	var fileVersion *models.FileVersion
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		file, fileVersion, err = lockFileVersion(ctx, tx, c.Param("file_id"), c.Param("file_version_id"))
+		if err != nil {
+			return err
+		}
+		if file.UserID != userID && fileVersion.UserID != userID {
+			return errCannotRequestReview
+		}
+		if fileVersion.ReviewStatus != string(enums.ReviewStatusDraft) && fileVersion.ReviewStatus != string(enums.ReviewStatusRejected) {
+			return errVersionNotReviewable
+		}
+
+		reviewers, err := repositories.ListUsersByIDs(ctx, tx, reviewerIDs)
+		if err != nil {
+			return err
+		}
+		if len(reviewers) != len(reviewerIDs) {
+			return errReviewerNotFound
+		}
+
+		now := time.Now()
+		reviews := make([]models.VersionReview, 0, len(reviewerIDs))
+		for _, reviewerID := range reviewerIDs {
+			reviews = append(reviews, models.VersionReview{
+				FileVersionID: fileVersion.FileVersionID,
+				ReviewerID:    reviewerID,
+				RequestedBy:   userID,
+				Decision:      string(enums.ReviewDecisionPending),
+				RequestedAt:   now,
+			})
+		}
+		if err := repositories.ReplaceVersionReviews(ctx, tx, fileVersion.FileVersionID, reviews); err != nil {
+			return err
+		}
+		fileVersion.ReviewStatus = string(enums.ReviewStatusInReview)
+		fileVersion.UpdatedAt = now
+		if err := repositories.UpdateFileVersionReviewStatus(ctx, tx, fileVersion.FileVersionID, fileVersion.ReviewStatus, now); err != nil {
+			return err
+		}
+
+		if err := repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditReviewRequested, enums.AuditTargetFileVersion, fileVersion.FileVersionID, map[string]interface{}{
+			"file_id":      file.FileID,
+			"reviewer_ids": reviewerIDs,
+		})); err != nil {
+			return err
+		}
+		if err := repositories.CreateActivity(ctx, tx, newActivity(c, enums.ActivityReviewRequested, file.FileID, false, file.DirectoryID, map[string]interface{}{
+			"file_version_id": fileVersion.FileVersionID,
+			"reviewer_ids":    reviewerIDs,
+		})); err != nil {
+			return err
+		}
+
+		notifications := make([]models.Notification, 0, len(reviewerIDs))
+		for _, reviewerID := range reviewerIDs {
+			notifications = append(notifications, newNotification(c, enums.NotificationReviewRequested, reviewerID, file.FileID, false, map[string]interface{}{
+				"file_name":       file.Name,
+				"file_version_id": fileVersion.FileVersionID,
+			}))
+		}
+		return createNotifications(ctx, tx, notifications)
+	})
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	h.respondWithReviews(c, http.StatusCreated, fileVersion)
+}
+
+// ListReviews returns the review status of a file version and the reviews of its latest
+// round to the owner of the file, the uploader of the version and its reviewers.
+func (h *ReviewHandler) ListReviews(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+
+	file, err := h.FileRepo.GetFileByID(ctx, c.Param("file_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+		return
+	}
+
+	fileVersion, err := repositories.GetFileVersionByID(ctx, h.db, c.Param("file_version_id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && fileVersion.FileID != file.FileID) {
+		err = errReviewVersionMismatch
+	}
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	if file.UserID != userID && fileVersion.UserID != userID {
+		reviews, err := h.VersionReviewRepo.ListVersionReviews(ctx, fileVersion.FileVersionID)
+		if err != nil {
+			respondWithReviewError(c, err)
+			return
+		}
+		if !slices.ContainsFunc(reviews, func(review models.VersionReview) bool { return review.ReviewerID == userID }) {
+			respondWithReviewError(c, errCannotViewReviews)
+			return
+		}
+	}
+
+	h.respondWithReviews(c, http.StatusOK, fileVersion)
+}
+
+// DecideReview lets a reviewer approve a version in review or request changes to it. A
+// single request for changes rejects the version; it is approved once every reviewer
+// approved it.
+func (h *ReviewHandler) DecideReview(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var decideReviewReq apis.DecideReviewRequest
+	if err := c.BindJSON(&decideReviewReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := decideReviewReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	var fileVersion *models.FileVersion
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		file, lockedVersion, err := lockFileVersion(ctx, tx, c.Param("file_id"), c.Param("file_version_id"))
+		if err != nil {
+			return err
+		}
+		fileVersion = lockedVersion
+
+		reviews, err := repositories.ListVersionReviews(ctx, tx, fileVersion.FileVersionID)
+		if err != nil {
+			return err
+		}
+		i := slices.IndexFunc(reviews, func(review models.VersionReview) bool {
+			return review.ReviewerID == userID
+		})
+		if i < 0 {
+			return errReviewNotFound
+		}
+		if fileVersion.ReviewStatus != string(enums.ReviewStatusInReview) {
+			return errVersionNotInReview
+		}
+		review := &reviews[i]
+		if review.Decision != string(enums.ReviewDecisionPending) {
+			return errReviewAlreadyDecided
+		}
+
+		now := time.Now()
+		review.Decision = decideReviewReq.Decision
+		review.Comment = decideReviewReq.Comment
+		review.DecidedAt = &now
+		if err := repositories.DecideVersionReview(ctx, tx, review); err != nil {
+			return err
+		}
+
+		reviewStatus := reviewStatusOf(reviews)
+		if reviewStatus != fileVersion.ReviewStatus {
+			fileVersion.ReviewStatus = reviewStatus
+			fileVersion.UpdatedAt = now
+			if err := repositories.UpdateFileVersionReviewStatus(ctx, tx, fileVersion.FileVersionID, reviewStatus, now); err != nil {
+				return err
+			}
+		}
+
+		if err := repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditReviewDecided, enums.AuditTargetFileVersion, fileVersion.FileVersionID, map[string]interface{}{
+			"file_id":       file.FileID,
+			"decision":      review.Decision,
+			"review_status": fileVersion.ReviewStatus,
+		})); err != nil {
+			return err
+		}
+		if err := repositories.CreateActivity(ctx, tx, newActivity(c, enums.ActivityReviewDecided, file.FileID, false, file.DirectoryID, map[string]interface{}{
+			"file_version_id": fileVersion.FileVersionID,
+			"decision":        review.Decision,
+			"review_status":   fileVersion.ReviewStatus,
+		})); err != nil {
+			return err
+		}
+		return createNotifications(ctx, tx, []models.Notification{
+			newNotification(c, enums.NotificationReviewDecided, review.RequestedBy, file.FileID, false, map[string]interface{}{
+				"file_name":       file.Name,
+				"file_version_id": fileVersion.FileVersionID,
+				"decision":        review.Decision,
+				"review_status":   fileVersion.ReviewStatus,
+			}),
+		})
+	})
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	h.respondWithReviews(c, http.StatusOK, fileVersion)
+}
+
+// ListMyPendingReviews returns the reviews the current user has yet to answer, newest first.
+func (h *ReviewHandler) ListMyPendingReviews(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid limit",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+	params := repositories.ListPendingReviewsParams{ReviewerID: userID, Limit: limit}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.PendingReviewCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	page, err := h.VersionReviewRepo.ListPendingReviews(ctx, params)
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	fileVersionIDs := make([]string, 0, len(page.Reviews))
+	for _, review := range page.Reviews {
+		fileVersionIDs = append(fileVersionIDs, review.FileVersionID)
+	}
+	fileVersions, err := repositories.ListFileVersionsByIDs(ctx, h.db, fileVersionIDs)
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+	fileVersionsByID := make(map[string]*models.FileVersion, len(fileVersions))
+	fileIDs := make([]string, 0, len(fileVersions))
+	userIDs := make([]string, 0, 2*len(fileVersions))
+	for i := range fileVersions {
+		fileVersionsByID[fileVersions[i].FileVersionID] = &fileVersions[i]
+		fileIDs = append(fileIDs, fileVersions[i].FileID)
+		userIDs = append(userIDs, fileVersions[i].UserID)
+	}
+	files, err := h.FileRepo.ListFilesByIDs(ctx, fileIDs)
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+	fileNames := make(map[string]string, len(files))
+	for _, file := range files {
+		fileNames[file.FileID] = file.Name
+	}
+	for _, review := range page.Reviews {
+		userIDs = append(userIDs, review.RequestedBy)
+	}
+	users, err := usersByID(ctx, h.db, userIDs)
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	resp := apis.ListPendingReviewsResponse{Reviews: make([]apis.PendingReview, 0, len(page.Reviews))}
+	for _, review := range page.Reviews {
+		fileVersion, ok := fileVersionsByID[review.FileVersionID]
+		if !ok {
+			continue
+		}
+		resp.Reviews = append(resp.Reviews, apis.PendingReview{
+			FileID:        fileVersion.FileID,
+			FileName:      fileNames[fileVersion.FileID],
+			FileVersionID: fileVersion.FileVersionID,
+			Uploader:      userSummary(fileVersion.UserID, users),
+			RequestedBy:   userSummary(review.RequestedBy, users),
+			RequestedAt:   review.RequestedAt,
+		})
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// lockFileVersion reads a version of a file and locks it, so that its review status does
+// not change under the transaction tx is in.
+func lockFileVersion(ctx context.Context, tx *gorm.DB, fileID, fileVersionID string) (*models.File, *models.FileVersion, error) {
+	file, err := repositories.GetFileByID(ctx, tx, fileID)
+	if err != nil {
+		return nil, nil, err
+	}
+	fileVersion, err := repositories.GetFileVersionForUpdate(ctx, tx, fileVersionID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && fileVersion.FileID != file.FileID) {
+		return nil, nil, errReviewVersionMismatch
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, fileVersion, nil
+}
+
+// reviewStatusOf tells where a version in review stands given the reviews of its round.
+func reviewStatusOf(reviews []models.VersionReview) string {
+	approved := true
+	for _, review := range reviews {
+		switch enums.ReviewDecision(review.Decision) {
+		case enums.ReviewDecisionChangesRequested:
+			return string(enums.ReviewStatusRejected)
+		case enums.ReviewDecisionPending:
+			approved = false
+		}
+	}
+	if approved {
+		return string(enums.ReviewStatusApproved)
+	}
+	return string(enums.ReviewStatusInReview)
+}
+
+func (h *ReviewHandler) respondWithReviews(c *gin.Context, status int, fileVersion *models.FileVersion) {
+	ctx := c.Request.Context()
+
+	reviews, err := h.VersionReviewRepo.ListVersionReviews(ctx, fileVersion.FileVersionID)
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	userIDs := make([]string, 0, 2*len(reviews))
+	for _, review := range reviews {
+		userIDs = append(userIDs, review.ReviewerID, review.RequestedBy)
+	}
+	users, err := usersByID(ctx, h.db, userIDs)
+	if err != nil {
+		respondWithReviewError(c, err)
+		return
+	}
+
+	resp := apis.VersionReviewsResponse{
+		FileID:        fileVersion.FileID,
+		FileVersionID: fileVersion.FileVersionID,
+		ReviewStatus:  fileVersion.ReviewStatus,
+		Reviews:       make([]apis.VersionReview, 0, len(reviews)),
+	}
+	for _, review := range reviews {
+		resp.Reviews = append(resp.Reviews, apis.VersionReview{
+			Reviewer:    userSummary(review.ReviewerID, users),
+			RequestedBy: userSummary(review.RequestedBy, users),
+			Decision:    review.Decision,
+			Comment:     review.Comment,
+			RequestedAt: review.RequestedAt,
+			DecidedAt:   review.DecidedAt,
+		})
+	}
+
+	c.JSON(status, resp)
+}
+
+func respondWithReviewError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "File not found",
+			Code:    enums.FileNotFoundError,
+		})
+	case errors.Is(err, errReviewVersionMismatch):
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "FileVersion not found",
+			Code:    enums.FileVersionNotFoundError,
+		})
+	case errors.Is(err, errReviewNotFound):
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Review not found",
+			Code:    enums.ReviewNotFoundError,
+		})
+	case errors.Is(err, errReviewerNotFound):
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.UserNotFoundError,
+		})
+	case errors.Is(err, errSelfReview):
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+	case errors.Is(err, errCannotRequestReview), errors.Is(err, errCannotViewReviews):
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InsufficientPermissionError,
+		})
+	case errors.Is(err, errVersionNotReviewable), errors.Is(err, errVersionNotInReview), errors.Is(err, errReviewAlreadyDecided):
+		c.JSON(http.StatusConflict, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidReviewStateError,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// finishLogin logs in user, who has proven who they are. Users with a second factor, or
+// required to have one, get a challenge instead of tokens and finish logging in through
+// TwoFactorHandler.VerifyLogin.
+func finishLogin(c *gin.Context, db *gorm.DB, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore, challengeStore *auth.TwoFactorChallengeStore, user *models.User, device string) {
+	ctx := c.Request.Context()
+
+	twoFactor, err := repositories.GetTwoFactorByUserID(ctx, db, user.UserID, false)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+	enabled := err == nil && twoFactor.EnabledAt != nil
+	if enabled || twoFactorRequired(user) {
+		challengeToken, err := challengeStore.CreateChallenge(ctx, &auth.TwoFactorChallenge{
+			UserID:     user.UserID,
+			Device:     device,
+			Enrollment: !enabled,
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.RedisError,
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, apis.TwoFactorChallengeResponse{
+			TwoFactorRequired:  true,
+			EnrollmentRequired: !enabled,
+			ChallengeToken:     challengeToken,
+			ExpiresIn:          int(challengeStore.TTL().Seconds()),
+		})
+		return
+	}
+
+	startSession(c, db, tokenManager, sessionStore, user.UserID, device)
+}
+
+// startSession logs userID in from the device making the request and responds with the
+// tokens of the new session.
+func startSession(c *gin.Context, db *gorm.DB, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore, userID, device string) {
+	if loginResp, ok := createSession(c, db, tokenManager, sessionStore, userID, device); ok {
+		c.JSON(http.StatusOK, loginResp)
+	}
+}
+
+// createSession logs userID in from the device making the request, records the login in
+// the audit log and returns the tokens of the new session. On failure it responds with the
+// error and returns false.
+func createSession(c *gin.Context, db *gorm.DB, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore, userID, device string) (*apis.LoginResponse, bool) {
+	ctx := c.Request.Context()
+
+	session := &auth.Session{
+		UserID:    userID,
+		Device:    device,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	refreshToken, err := sessionStore.CreateSession(ctx, session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return nil, false
+	}
+
+	entry := newAuditLog(c, enums.AuditLoginSucceeded, enums.AuditTargetUser, userID, map[string]interface{}{
+		"session_id": session.SessionID,
+		"device":     device,
+	})
+	entry.ActorID = userID
+	if err := repositories.CreateAuditLog(ctx, db, entry); err != nil {
+		// A login missing from the audit log must not be handed out.
+		if err := sessionStore.DeleteSession(ctx, userID, session.SessionID); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.RedisError,
+			})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return nil, false
+	}
+
+	return loginResponse(c, tokenManager, session, refreshToken)
+}
+
+func respondWithAccountDisabled(c *gin.Context) {
+	c.JSON(http.StatusForbidden, apis.ErrorResponse{
+		Message: "Account is disabled",
+		Code:    enums.AccountDisabledError,
+	})
+}
+
+func respondWithTokens(c *gin.Context, tokenManager *auth.TokenManager, session *auth.Session, refreshToken string) {
+	if loginResp, ok := loginResponse(c, tokenManager, session, refreshToken); ok {
+		c.JSON(http.StatusOK, loginResp)
+	}
+}
+
+func loginResponse(c *gin.Context, tokenManager *auth.TokenManager, session *auth.Session, refreshToken string) (*apis.LoginResponse, bool) {
+	tokenString, err := tokenManager.IssueAccessToken(session)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return nil, false
+	}
+
+	return &apis.LoginResponse{
+		Token:        tokenString,
+		Type:         "Bearer",
+		ExpiresIn:    int(tokenManager.AccessTokenTTL().Seconds()),
+		RefreshToken: refreshToken,
+		SessionID:    session.SessionID,
+	}, true
+}
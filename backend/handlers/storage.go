@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/enums"
+	"dam/repositories"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errStorageNotConfigured = errors.New("storage is not configured for the owner of the file")
+
+func newS3Client(ctx context.Context, region, accessKey, secretKey string) (*s3.Client, error) {
+	sdkConfig, err := config.LoadDefaultConfig(
+		ctx,
+		config.WithRegion(region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			accessKey,
+			secretKey,
+			""),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load default config error: %w", err)
+	}
+
+	return s3.NewFromConfig(sdkConfig), nil
+}
+
+// userStorage returns a client for the storage of userID, where the blobs of their files
+// live, and the bucket to use. It fails with errStorageNotConfigured for users without one.
+func userStorage(ctx context.Context, db *gorm.DB, userID string) (*s3.Client, string, error) {
+	userSetting, err := repositories.GetUserSettingsByUserID(ctx, db, userID, false)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && userSetting.StorageVendor != string(enums.StorageAmazonS3)) {
+		return nil, "", errStorageNotConfigured
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	s3Client, err := newS3Client(ctx, userSetting.StorageInformations.AWSS3Region, userSetting.StorageCredentials.AWSS3AccessKeyID, userSetting.StorageCredentials.AWSS3SecretAccessKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return s3Client, userSetting.StorageInformations.AWSS3BucketName, nil
+}
+
+func respondWithStorageError(c *gin.Context, err error) {
+	if errors.Is(err, errStorageNotConfigured) {
+		c.JSON(http.StatusConflict, apis.ErrorResponse{
+			Message: "Storage is not configured for the owner of the file",
+			Code:    enums.StorageNotConfiguredError,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+		Message: err.Error(),
+		Code:    enums.InternalError,
+	})
+}
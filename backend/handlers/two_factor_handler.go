@@ -0,0 +1,524 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/auth"
+	"dam/config"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount is how many recovery codes a user gets at once.
+const recoveryCodeCount = 10
+
+var (
+	errTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	errTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	errTwoFactorNotEnrolled    = errors.New("two-factor authentication has not been set up, enroll first")
+	errInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+)
+
+type TwoFactorHandler struct {
+	UserRepo       repositories.UserRepoInterface
+	TwoFactorRepo  repositories.TwoFactorRepoInterface
+	ChallengeStore *auth.TwoFactorChallengeStore
+	TokenManager   *auth.TokenManager
+	SessionStore   *auth.SessionStore
+	db             *gorm.DB
+}
+
+type TwoFactorHandlerInterface interface {
+	GetTwoFactorStatus(c *gin.Context)
+	EnrollTOTP(c *gin.Context)
+	ConfirmTOTP(c *gin.Context)
+	DisableTOTP(c *gin.Context)
+	RegenerateRecoveryCodes(c *gin.Context)
+	EnrollLoginTOTP(c *gin.Context)
+	VerifyLogin(c *gin.Context)
+}
+
+func NewTwoFactorHandler(db *gorm.DB, challengeStore *auth.TwoFactorChallengeStore, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore) TwoFactorHandlerInterface {
+	return &TwoFactorHandler{
+		UserRepo:       repositories.NewUserRepo(db),
+		TwoFactorRepo:  repositories.NewTwoFactorRepo(db),
+		ChallengeStore: challengeStore,
+		TokenManager:   tokenManager,
+		SessionStore:   sessionStore,
+		db:             db,
+	}
+}
+
+// twoFactorRequired reports whether the configured policy forces user to log in with a
+// second factor.
+func twoFactorRequired(user *models.User) bool {
+	switch enums.TwoFactorPolicy(config.Cfg.TwoFactor.Policy) {
+	case enums.TwoFactorRequiredAll:
+		return true
+	case enums.TwoFactorRequiredAdmins:
+		return user.Role == string(enums.RoleAdmin)
+	default:
+		return false
+	}
+}
+
+func (h *TwoFactorHandler) GetTwoFactorStatus(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	user, err := h.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	twoFactor, err := h.TwoFactorRepo.GetTwoFactorByUserID(ctx, userID, false)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+	enabled := err == nil && twoFactor.EnabledAt != nil
+
+	recoveryCodesLeft, err := h.TwoFactorRepo.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.TwoFactorStatusResponse{
+		Enabled:           enabled,
+		Required:          twoFactorRequired(user),
+		RecoveryCodesLeft: recoveryCodesLeft,
+	})
+}
+
+// EnrollTOTP starts setting up an authenticator app for the current user. The second
+// factor is only enabled once a code of the app is confirmed.
+func (h *TwoFactorHandler) EnrollTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	h.enroll(c, userID)
+}
+
+// ConfirmTOTP enables the second factor being set up by checking a code of the
+// authenticator app, and returns the recovery codes.
+func (h *TwoFactorHandler) ConfirmTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var confirmReq apis.ConfirmTOTPRequest
+	if err := c.BindJSON(&confirmReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	var recoveryCodes []string
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		recoveryCodes, err = confirmTOTP(ctx, tx, userID, confirmReq.Code)
+		if err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditTwoFactorEnabled, enums.AuditTargetUser, userID, nil))
+	})
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// DisableTOTP turns off the second factor of the current user, unless the policy requires
+// one.
+func (h *TwoFactorHandler) DisableTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var verificationReq apis.TwoFactorVerificationRequest
+	if err := c.BindJSON(&verificationReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := verificationReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	user, err := h.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	if twoFactorRequired(user) {
+		c.JSON(http.StatusForbidden, apis.ErrorResponse{
+			Message: "Two-factor authentication is required for this account",
+			Code:    enums.TwoFactorRequiredError,
+		})
+		return
+	}
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(ctx, tx, userID, &verificationReq); err != nil {
+			return err
+		}
+		if err := repositories.DeleteTwoFactor(ctx, tx, userID); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditTwoFactorDisabled, enums.AuditTargetUser, userID, nil))
+	})
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes of the current user, used or not.
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var verificationReq apis.TwoFactorVerificationRequest
+	if err := c.BindJSON(&verificationReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := verificationReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	var recoveryCodes []string
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(ctx, tx, userID, &verificationReq); err != nil {
+			return err
+		}
+		var err error
+		recoveryCodes, err = replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+}
+
+// EnrollLoginTOTP sets up an authenticator app during a login which requires a second
+// factor the user does not have yet. The code of the app is then sent to VerifyLogin.
+func (h *TwoFactorHandler) EnrollLoginTOTP(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var enrollReq apis.EnrollLoginTOTPRequest
+	if err := c.BindJSON(&enrollReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	challenge, err := h.ChallengeStore.GetChallenge(ctx, enrollReq.ChallengeToken)
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	if !challenge.Enrollment {
+		c.JSON(http.StatusConflict, apis.ErrorResponse{
+			Message: errTwoFactorAlreadyEnabled.Error(),
+			Code:    enums.TwoFactorAlreadyEnabledError,
+		})
+		return
+	}
+
+	h.enroll(c, challenge.UserID)
+}
+
+// VerifyLogin finishes a login which passed its password by checking the second factor,
+// or by confirming the one set up through EnrollLoginTOTP.
+func (h *TwoFactorHandler) VerifyLogin(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var verifyReq apis.VerifyLoginTwoFactorRequest
+	if err := c.BindJSON(&verifyReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := verifyReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	challenge, err := h.ChallengeStore.GetChallenge(ctx, verifyReq.ChallengeToken)
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	// The user may have been disabled since the password was checked.
+	user, err := h.UserRepo.GetUserByID(ctx, challenge.UserID)
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+	if user.DisabledAt != nil {
+		respondWithAccountDisabled(c)
+		return
+	}
+
+	var recoveryCodes []string
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if !challenge.Enrollment {
+			return verifySecondFactor(ctx, tx, challenge.UserID, &verifyReq.TwoFactorVerificationRequest)
+		}
+		if verifyReq.Code == "" {
+			return errInvalidTwoFactorCode
+		}
+		var err error
+		recoveryCodes, err = confirmTOTP(ctx, tx, challenge.UserID, verifyReq.Code)
+		if err != nil {
+			return err
+		}
+		entry := newAuditLog(c, enums.AuditTwoFactorEnabled, enums.AuditTargetUser, challenge.UserID, nil)
+		entry.ActorID = challenge.UserID
+		return repositories.CreateAuditLog(ctx, tx, entry)
+	})
+	if errors.Is(err, errInvalidTwoFactorCode) {
+		if err := h.ChallengeStore.RecordFailedAttempt(ctx, verifyReq.ChallengeToken); err != nil {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.RedisError,
+			})
+			return
+		}
+	}
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	if err := h.ChallengeStore.DeleteChallenge(ctx, verifyReq.ChallengeToken); err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	loginResp, ok := createSession(c, h.db, h.TokenManager, h.SessionStore, challenge.UserID, challenge.Device)
+	if !ok {
+		return
+	}
+	loginResp.RecoveryCodes = recoveryCodes
+	c.JSON(http.StatusOK, loginResp)
+}
+
+// enroll gives userID a new, not yet enabled, TOTP secret.
+func (h *TwoFactorHandler) enroll(c *gin.Context, userID string) {
+	ctx := c.Request.Context()
+
+	user, err := h.UserRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	secret, err := auth.NewTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		twoFactor, err := repositories.GetTwoFactorByUserID(ctx, tx, userID, true)
+		switch {
+		case err == nil && twoFactor.EnabledAt != nil:
+			return errTwoFactorAlreadyEnabled
+		case err != nil && !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		}
+
+		now := time.Now()
+		return repositories.SaveTwoFactor(ctx, tx, &models.TwoFactor{
+			UserID:    userID,
+			Secret:    secret,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	})
+	if err != nil {
+		respondWithTwoFactorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, apis.EnrollTOTPResponse{
+		Secret: secret,
+		URI:    auth.TOTPURI(config.Cfg.TwoFactor.Issuer, user.Email, secret),
+	})
+}
+
+// confirmTOTP enables the pending second factor of userID when code matches it, and
+// returns its recovery codes.
+func confirmTOTP(ctx context.Context, tx *gorm.DB, userID, code string) ([]string, error) {
+	twoFactor, err := repositories.GetTwoFactorByUserID(ctx, tx, userID, true)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errTwoFactorNotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if twoFactor.EnabledAt != nil {
+		return nil, errTwoFactorAlreadyEnabled
+	}
+
+	now := time.Now()
+	step, ok := auth.ValidateTOTP(twoFactor.Secret, code, now, twoFactor.LastUsedStep)
+	if !ok {
+		return nil, errInvalidTwoFactorCode
+	}
+
+	twoFactor.EnabledAt = &now
+	twoFactor.LastUsedStep = step
+	twoFactor.UpdatedAt = now
+	if err := repositories.SaveTwoFactor(ctx, tx, twoFactor); err != nil {
+		return nil, err
+	}
+	return replaceRecoveryCodes(ctx, tx, userID)
+}
+
+// verifySecondFactor checks the code or recovery code of verificationReq against the
+// enabled second factor of userID, consuming it so that it cannot be used twice.
+func verifySecondFactor(ctx context.Context, tx *gorm.DB, userID string, verificationReq *apis.TwoFactorVerificationRequest) error {
+	twoFactor, err := repositories.GetTwoFactorByUserID(ctx, tx, userID, true)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errTwoFactorNotEnabled
+	}
+	if err != nil {
+		return err
+	}
+	if twoFactor.EnabledAt == nil {
+		return errTwoFactorNotEnabled
+	}
+
+	if verificationReq.RecoveryCode != "" {
+		used, err := repositories.UseRecoveryCode(ctx, tx, userID, auth.HashRecoveryCode(verificationReq.RecoveryCode))
+		if err != nil {
+			return err
+		}
+		if !used {
+			return errInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	now := time.Now()
+	step, ok := auth.ValidateTOTP(twoFactor.Secret, verificationReq.Code, now, twoFactor.LastUsedStep)
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+
+	twoFactor.LastUsedStep = step
+	twoFactor.UpdatedAt = now
+	return repositories.SaveTwoFactor(ctx, tx, twoFactor)
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *gorm.DB, userID string) ([]string, error) {
+	recoveryCodes, err := auth.NewRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	codeHashes := make([]string, 0, len(recoveryCodes))
+	for _, code := range recoveryCodes {
+		codeHashes = append(codeHashes, auth.HashRecoveryCode(code))
+	}
+	if err := repositories.ReplaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return nil, err
+	}
+	return recoveryCodes, nil
+}
+
+func respondWithTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, auth.ErrInvalidTwoFactorChallenge):
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidTwoFactorChallengeError,
+		})
+	case errors.Is(err, errInvalidTwoFactorCode):
+		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidTwoFactorCodeError,
+		})
+	case errors.Is(err, errTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.TwoFactorAlreadyEnabledError,
+		})
+	case errors.Is(err, errTwoFactorNotEnabled), errors.Is(err, errTwoFactorNotEnrolled):
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.TwoFactorNotEnabledError,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+	}
+}
@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// multipartOverhead is how many bytes beyond the file itself an upload request may carry
+// for the multipart boundaries, headers and other form fields.
+const multipartOverhead = 1 << 20
+
+// effectiveUploadPolicy merges the upload policies set on directory and its ancestors.
+// Every setting comes from the closest directory that sets it, so a subdirectory can
+// tighten or relax what it inherits. Empty allow-lists inherit too.
+func effectiveUploadPolicy(ctx context.Context, db *gorm.DB, directory *models.Directory) (*models.UploadPolicy, error) {
+	uploadPoliciesByDirectoryID, err := uploadPoliciesByDirectoryID(ctx, db, directoryPathIDs(directory))
+	if err != nil {
+		return nil, err
+	}
+	return mergeUploadPolicies(directory, uploadPoliciesByDirectoryID), nil
+}
+
+// directoryPathIDs returns the IDs of the ancestors of directory, root first, then its own.
+func directoryPathIDs(directory *models.Directory) []string {
+	directoryIDs := strings.FieldsFunc(directory.FullPath, func(r rune) bool { return r == '/' })
+	return append(directoryIDs, directory.DirectoryID)
+}
+
+func uploadPoliciesByDirectoryID(ctx context.Context, db *gorm.DB, directoryIDs []string) (map[string]models.UploadPolicy, error) {
+	uploadPolicies, err := repositories.ListUploadPoliciesByDirectoryIDs(ctx, db, directoryIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byDirectoryID := make(map[string]models.UploadPolicy, len(uploadPolicies))
+	for _, uploadPolicy := range uploadPolicies {
+		byDirectoryID[uploadPolicy.DirectoryID] = uploadPolicy
+	}
+	return byDirectoryID, nil
+}
+
+// mergeUploadPolicies computes the effective upload policy of directory from the policies
+// of its path, which uploadPolicies must all hold.
+func mergeUploadPolicies(directory *models.Directory, uploadPolicies map[string]models.UploadPolicy) *models.UploadPolicy {
+	effective := &models.UploadPolicy{DirectoryID: directory.DirectoryID}
+	for _, directoryID := range directoryPathIDs(directory) {
+		uploadPolicy, ok := uploadPolicies[directoryID]
+		if !ok {
+			continue
+		}
+		if uploadPolicy.MaxFileSize != nil {
+			effective.MaxFileSize = uploadPolicy.MaxFileSize
+		}
+		if len(uploadPolicy.AllowedMimeTypes) > 0 {
+			effective.AllowedMimeTypes = uploadPolicy.AllowedMimeTypes
+		}
+		if len(uploadPolicy.AllowedExtensions) > 0 {
+			effective.AllowedExtensions = uploadPolicy.AllowedExtensions
+		}
+		if uploadPolicy.MaxFiles != nil {
+			effective.MaxFiles = uploadPolicy.MaxFiles
+		}
+		if uploadPolicy.RequireApproval != nil {
+			effective.RequireApproval = uploadPolicy.RequireApproval
+		}
+	}
+	return effective
+}
+
+// checkUploadPolicy verifies the size and type of an uploaded file against policy. It
+// returns the status and error to send back, or a nil error when the file is accepted.
+func checkUploadPolicy(policy *models.UploadPolicy, fileHeader *multipart.FileHeader) (int, *apis.ErrorResponse) {
+	err := checkFilePolicy(policy, fileHeader.Filename, fileHeader.Size, fileHeader.Header.Get("Content-Type"))
+	switch {
+	case errors.Is(err, errFileTooLarge):
+		return http.StatusRequestEntityTooLarge, &apis.ErrorResponse{
+			Message: fmt.Sprintf("file must be at most %d bytes", *policy.MaxFileSize),
+			Code:    enums.FileTooLargeError,
+		}
+	case err != nil:
+		return http.StatusUnsupportedMediaType, &apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.FileTypeNotAllowedError,
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// checkFilePolicy verifies the size and type of a file named name against policy.
+func checkFilePolicy(policy *models.UploadPolicy, name string, size int64, mimeType string) error {
+	if policy.MaxFileSize != nil && size > *policy.MaxFileSize {
+		return errFileTooLarge
+	}
+	if len(policy.AllowedMimeTypes) > 0 && !mimeTypeAllowed(policy.AllowedMimeTypes, mimeType) {
+		return errFileTypeNotAllowed
+	}
+	if len(policy.AllowedExtensions) > 0 && !extensionAllowed(policy.AllowedExtensions, name) {
+		return errFileExtensionNotAllowed
+	}
+	return nil
+}
+
+// checkFileLimit verifies that directoryID has room for one more file under policy. The
+// directory stays locked until tx ends, so that concurrent additions are counted one after
+// the other.
+func checkFileLimit(ctx context.Context, tx *gorm.DB, directoryID string, policy *models.UploadPolicy) error {
+	if policy.MaxFiles == nil {
+		return nil
+	}
+	if err := repositories.LockDirectory(ctx, tx, directoryID); err != nil {
+		return err
+	}
+	count, err := repositories.CountFilesByDirectoryID(ctx, tx, directoryID)
+	if err != nil {
+		return err
+	}
+	if count >= int64(*policy.MaxFiles) {
+		return errDirectoryFileLimit
+	}
+	return nil
+}
+
+// admitFile checks file, about to be moved or copied into directory under name, against
+// the upload policy of directory.
+func admitFile(ctx context.Context, tx *gorm.DB, directory *models.Directory, file *models.File, name string) error {
+	policy, err := effectiveUploadPolicy(ctx, tx, directory)
+	if err != nil {
+		return err
+	}
+	if err := checkFilePolicy(policy, name, file.Size, file.Extension); err != nil {
+		return err
+	}
+	return checkFileLimit(ctx, tx, directory.DirectoryID, policy)
+}
+
+// checkTreeUploadPolicies checks the files below root, which was just moved or copied, against
+// the upload policies their directories have in the new place.
+func checkTreeUploadPolicies(ctx context.Context, tx *gorm.DB, root *models.Directory) error {
+	descendants, err := repositories.ListDescendantDirectories(ctx, tx, root)
+	if err != nil {
+		return err
+	}
+	directories := append([]models.Directory{*root}, descendants...)
+	directoryIDs := make([]string, 0, len(directories))
+	for _, directory := range directories {
+		directoryIDs = append(directoryIDs, directory.DirectoryID)
+	}
+
+	// The path of every directory of the tree is the path of root followed by the tree.
+	uploadPolicies, err := uploadPoliciesByDirectoryID(ctx, tx, append(directoryPathIDs(root), directoryIDs...))
+	if err != nil {
+		return err
+	}
+	files, err := repositories.ListFilesByDirectoryIDs(ctx, tx, directoryIDs)
+	if err != nil {
+		return err
+	}
+
+	policies := make(map[string]*models.UploadPolicy, len(directories))
+	for i := range directories {
+		policies[directories[i].DirectoryID] = mergeUploadPolicies(&directories[i], uploadPolicies)
+	}
+	counts := map[string]int{}
+	for _, file := range files {
+		policy := policies[file.DirectoryID]
+		if err := checkFilePolicy(policy, file.Name, file.Size, file.Extension); err != nil {
+			return err
+		}
+		counts[file.DirectoryID]++
+		if policy.MaxFiles != nil && counts[file.DirectoryID] > *policy.MaxFiles {
+			return errDirectoryFileLimit
+		}
+	}
+	return nil
+}
+
+// mimeTypeAllowed matches mimeType against entries such as "image/png" or "image/*".
+func mimeTypeAllowed(allowed []string, mimeType string) bool {
+	mimeType = strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
+	for _, entry := range allowed {
+		entry = strings.ToLower(entry)
+		if family, ok := strings.CutSuffix(entry, "/*"); ok {
+			if strings.HasPrefix(mimeType, family+"/") {
+				return true
+			}
+			continue
+		}
+		if entry == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// extensionAllowed matches the extension of name against entries written with or without
+// the leading dot.
+func extensionAllowed(allowed []string, name string) bool {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, entry := range allowed {
+		if strings.ToLower(strings.TrimPrefix(entry, ".")) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+func uploadPolicyResponse(uploadPolicy *models.UploadPolicy) apis.UploadPolicy {
+	return apis.UploadPolicy{
+		MaxFileSize:       uploadPolicy.MaxFileSize,
+		AllowedMimeTypes:  uploadPolicy.AllowedMimeTypes,
+		AllowedExtensions: uploadPolicy.AllowedExtensions,
+		MaxFiles:          uploadPolicy.MaxFiles,
+		RequireApproval:   uploadPolicy.RequireApproval,
+	}
+}
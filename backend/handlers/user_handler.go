@@ -2,39 +2,61 @@ package handlers
 
 import (
 	"dam/apis"
+	"dam/auth"
+	"dam/config"
 	"dam/enums"
 	"dam/models"
 	"dam/repositories"
+	"errors"
+	"math"
 	"net/http"
-	"strings"
-	"time"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
-
-	"github.com/dgrijalva/jwt-go"
 )
 
+// dummyPasswordHash is compared against when there is no password to check.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dam-dummy-password"), bcrypt.DefaultCost)
+
 type UserHandler struct {
-	UserRepo repositories.UserRepoInterface
-	RdClient *redis.Client
+	UserRepo         repositories.UserRepoInterface
+	StorageUsageRepo repositories.StorageUsageRepoInterface
+	TwoFactorRepo    repositories.TwoFactorRepoInterface
+	TokenManager     *auth.TokenManager
+	SessionStore     *auth.SessionStore
+	ChallengeStore   *auth.TwoFactorChallengeStore
+	AccountMailer    *AccountMailer
+	LoginThrottle    *auth.LoginThrottle
+	db               *gorm.DB
 }
 
 type UserHandlerInterface interface {
 	Login(c *gin.Context)
 	Logout(c *gin.Context)
+	RefreshToken(c *gin.Context)
+	ListSessions(c *gin.Context)
+	DeleteSession(c *gin.Context)
+	DeleteAllSessions(c *gin.Context)
 	GetCurrentUser(c *gin.Context)
 	CreateUser(c *gin.Context)
 	UpdateUser(c *gin.Context)
+	GetCurrentUserUsage(c *gin.Context)
 }
 
-func NewUserHandler(db *gorm.DB, rdClient *redis.Client) UserHandlerInterface {
+func NewUserHandler(db *gorm.DB, tokenManager *auth.TokenManager, sessionStore *auth.SessionStore, challengeStore *auth.TwoFactorChallengeStore, accountMailer *AccountMailer, loginThrottle *auth.LoginThrottle) UserHandlerInterface {
 	return &UserHandler{
-		UserRepo: repositories.NewUserRepo(db),
-		RdClient: rdClient,
+		UserRepo:         repositories.NewUserRepo(db),
+		StorageUsageRepo: repositories.NewStorageUsageRepo(db),
+		TwoFactorRepo:    repositories.NewTwoFactorRepo(db),
+		TokenManager:     tokenManager,
+		SessionStore:     sessionStore,
+		ChallengeStore:   challengeStore,
+		AccountMailer:    accountMailer,
+		LoginThrottle:    loginThrottle,
+		db:               db,
 	}
 }
 
@@ -50,93 +72,281 @@ func (h *UserHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, err := h.UserRepo.GetUserByEmail(ctx, loginReq.Email)
+	retryAfter, err := h.LoginThrottle.Allow(ctx, c.ClientIP(), loginReq.Email)
+	if errors.Is(err, auth.ErrLoginThrottled) {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+		c.JSON(http.StatusTooManyRequests, apis.ErrorResponse{
+			Message: "Too many login attempts, try again later",
+			Code:    enums.TooManyLoginAttemptsError,
+		})
+		return
+	}
 	if err != nil {
-		if err == gorm.ErrRecordNotFound {
-			c.JSON(http.StatusNotFound, apis.ErrorResponse{
-				Message: "user not found",
-				Code:    enums.UserNotFoundError,
-			})
-			return
-		}
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
-			Code:    enums.InternalError,
+			Code:    enums.RedisError,
 		})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(loginReq.Password)); err != nil {
+	user, err := h.UserRepo.GetUserByEmail(ctx, loginReq.Email)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		user = nil
+	case err != nil:
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
-			Message: "wrong password",
-			Code:    enums.InvalidRequestError,
+			Message: err.Error(),
+			Code:    enums.InternalError,
 		})
 		return
 	}
 
-	// Create a new token object
-	token := jwt.New(jwt.SigningMethodHS256)
+	// Unknown addresses and accounts without a password are checked against a dummy hash,
+	// so that how long a login takes does not tell whether the account exists.
+	hasPassword := user != nil && user.PasswordHash != ""
+	passwordHash := dummyPasswordHash
+	if hasPassword {
+		passwordHash = []byte(user.PasswordHash)
+	}
+	if err := bcrypt.CompareHashAndPassword(passwordHash, []byte(loginReq.Password)); err != nil || !hasPassword {
+		h.rejectLogin(c, loginReq.Email, user)
+		return
+	}
 
-	// Set the claims for the token
-	claims := token.Claims.(jwt.MapClaims)
-	claims["userID"] = user.UserID
-	claims["exp"] = time.Now().Add(time.Hour).Unix() // Token expires in 1 hour
+	if err := h.LoginThrottle.RecordSuccess(ctx, loginReq.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
 
-	// Generate the token string
-	tokenString, err := token.SignedString([]byte("your-secret-key"))
-	if err != nil {
+	if user.DisabledAt != nil {
+		respondWithAccountDisabled(c)
 		return
 	}
 
-	if err := h.RdClient.Set(ctx, tokenString, user.UserID, time.Hour).Err(); err != nil {
+	finishLogin(c, h.db, h.TokenManager, h.SessionStore, h.ChallengeStore, user, loginReq.Device)
+}
+
+// rejectLogin answers a wrong email or password the same way, counting it against the
+// account and recording it in the audit log.
+func (h *UserHandler) rejectLogin(c *gin.Context, email string, user *models.User) {
+	ctx := c.Request.Context()
+
+	locked, err := h.LoginThrottle.RecordFailure(ctx, email)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
-			Code:    enums.InternalError,
+			Code:    enums.RedisError,
 		})
 		return
 	}
 
-	c.JSON(http.StatusOK, apis.LoginResponse{
-		Token:     tokenString,
-		Type:      "Bearer",
-		ExpiresIn: 3600,
+	targetID, reason := "", "unknown_email"
+	if user != nil {
+		targetID, reason = user.UserID, "wrong_password"
+	}
+	entries := []*models.AuditLog{
+		newAuditLog(c, enums.AuditLoginFailed, enums.AuditTargetUser, targetID, map[string]interface{}{
+			"email":  email,
+			"reason": reason,
+		}),
+	}
+	if locked {
+		entries = append(entries, newAuditLog(c, enums.AuditLoginLocked, enums.AuditTargetUser, targetID, map[string]interface{}{
+			"email":    email,
+			"duration": config.Cfg.Login.LockoutDuration.String(),
+		}))
+	}
+	for _, entry := range entries {
+		if err := repositories.CreateAuditLog(ctx, h.db, entry); err != nil {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+		Message: "Invalid email or password",
+		Code:    enums.InvalidCredentialsError,
 	})
 }
 
-func (h *UserHandler) Logout(c *gin.Context) {
+// RefreshToken exchanges a refresh token for a new access token and refresh token. Each
+// refresh token works once; reusing one revokes its session.
+func (h *UserHandler) RefreshToken(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
-			Message: "Authorization header is required",
-			Code:    enums.AuthorizationHeaderRequiredError,
+	var refreshTokenReq apis.RefreshTokenRequest
+	if err := c.BindJSON(&refreshTokenReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
 		})
 		return
 	}
 
-	authParts := strings.Split(authHeader, " ")
-	if len(authParts) != 2 || strings.ToLower(authParts[0]) != "bearer" {
-		c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
-			Message: "Invalid authorization header",
-			Code:    enums.InvalidAuthorizationHeaderError,
+	session, refreshToken, err := h.SessionStore.RotateRefreshToken(ctx, refreshTokenReq.RefreshToken, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Refresh token was already used, the session has been revoked",
+				Code:    enums.RefreshTokenReusedError,
+			})
+		case errors.Is(err, auth.ErrInvalidRefreshToken):
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Invalid refresh token",
+				Code:    enums.InvalidRefreshTokenError,
+			})
+		default:
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.RedisError,
+			})
+		}
+		return
+	}
+
+	respondWithTokens(c, h.TokenManager, session, refreshToken)
+}
+
+// Logout revokes the session of the access token it is called with.
+func (h *UserHandler) Logout(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	sessionID, ok := ctx.Value(enums.SessionIDCtxKey).(string)
+	if !ok {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Personal access tokens are revoked, not logged out",
+			Code:    enums.InvalidRequestError,
 		})
 		return
 	}
 
-	token := authParts[1]
+	var revokeErr error
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditLoggedOut, enums.AuditTargetSession, sessionID, nil)); err != nil {
+			return err
+		}
+		// The session is revoked last, as that cannot be rolled back.
+		if err := h.SessionStore.DeleteSession(ctx, userID, sessionID); err != nil && !errors.Is(err, auth.ErrSessionNotFound) {
+			revokeErr = err
+		}
+		return revokeErr
+	})
+	if err != nil {
+		respondWithRevocationError(c, revokeErr, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+func (h *UserHandler) ListSessions(c *gin.Context) {
+	ctx := c.Request.Context()
 
-	if err := h.RdClient.Del(ctx, token).Err(); err != nil {
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	sessions, err := h.SessionStore.ListSessions(ctx, userID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
-			Code:    enums.InternalError,
+			Code:    enums.RedisError,
+		})
+		return
+	}
+
+	currentSessionID, _ := ctx.Value(enums.SessionIDCtxKey).(string)
+	items := make([]apis.Session, 0, len(sessions))
+	for _, session := range sessions {
+		items = append(items, apis.Session{
+			SessionID:    session.SessionID,
+			Device:       session.Device,
+			IP:           session.IP,
+			UserAgent:    session.UserAgent,
+			Current:      session.SessionID == currentSessionID,
+			Impersonated: session.ImpersonatorID != "",
+			CreatedAt:    session.CreatedAt,
+			LastSeenAt:   session.LastSeenAt,
+			ExpiresAt:    session.ExpiresAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, apis.ListSessionsResponse{Sessions: items})
+}
+
+func (h *UserHandler) DeleteSession(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	sessionID := c.Param("session_id")
+	var revokeErr error
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditSessionRevoked, enums.AuditTargetSession, sessionID, nil)); err != nil {
+			return err
+		}
+		// The session is revoked last, as that cannot be rolled back.
+		revokeErr = h.SessionStore.DeleteSession(ctx, userID, sessionID)
+		return revokeErr
+	})
+	if errors.Is(revokeErr, auth.ErrSessionNotFound) {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Session not found",
+			Code:    enums.SessionNotFoundError,
 		})
 		return
 	}
+	if err != nil {
+		respondWithRevocationError(c, revokeErr, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// DeleteAllSessions logs the current user out everywhere, including the session making the
+// request.
+func (h *UserHandler) DeleteAllSessions(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var revokeErr error
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditSessionsRevoked, enums.AuditTargetUser, userID, nil)); err != nil {
+			return err
+		}
+		// The sessions are revoked last, as that cannot be rolled back.
+		revokeErr = h.SessionStore.DeleteUserSessions(ctx, userID)
+		return revokeErr
+	})
+	if err != nil {
+		respondWithRevocationError(c, revokeErr, err)
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{})
 }
 
+// respondWithRevocationError answers a failure to revoke sessions in the session store,
+// revokeErr, or otherwise to record it in the audit log.
+func respondWithRevocationError(c *gin.Context, revokeErr, err error) {
+	if revokeErr != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: revokeErr.Error(),
+			Code:    enums.RedisError,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+		Message: err.Error(),
+		Code:    enums.InternalError,
+	})
+}
+
 func (h *UserHandler) CreateUser(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -172,6 +382,7 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		PasswordHash: string(passwordHash),
 		Email:        createUserReq.Email,
 		Name:         createUserReq.Name,
+		Role:         string(enums.RoleUser),
 	}
 
 	if err := h.UserRepo.CreateUser(ctx, &user); err != nil {
@@ -182,6 +393,8 @@ func (h *UserHandler) CreateUser(c *gin.Context) {
 		return
 	}
 
+	h.AccountMailer.SendEmailVerification(user)
+
 	c.JSON(http.StatusCreated, apis.CreateUserResponse{
 		UserID: user.UserID,
 	})
@@ -208,10 +421,11 @@ func (h *UserHandler) GetCurrentUser(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, apis.GetUserResponse{
-		UserID:   user.UserID,
-		Username: user.Username,
-		Email:    user.Email,
-		Name:     user.Name,
+		UserID:        user.UserID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Name:          user.Name,
 	})
 }
 
@@ -244,9 +458,19 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	previousName := user.Name
 	user.Name = updateUserReq.Name
 
-	if err := h.UserRepo.UpdateUser(ctx, user); err != nil {
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.UpdateUser(ctx, tx, user); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditProfileUpdated, enums.AuditTargetUser, user.UserID, auditChanges(
+			map[string]interface{}{"name": previousName},
+			map[string]interface{}{"name": user.Name},
+		)))
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
 			Message: err.Error(),
 			Code:    enums.InternalError,
@@ -258,3 +482,37 @@ func (h *UserHandler) UpdateUser(c *gin.Context) {
 		UserID: user.UserID,
 	})
 }
+
+func (h *UserHandler) GetCurrentUserUsage(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	usage, err := h.StorageUsageRepo.GetStorageUsageByUserID(ctx, userID, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	byDirectory, err := h.StorageUsageRepo.ListStorageUsageByTopLevelDirectory(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	byMimeFamily, err := h.StorageUsageRepo.ListStorageUsageByMimeFamily(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, storageUsageResponse(usage, byDirectory, byMimeFamily))
+}
@@ -5,12 +5,11 @@ import (
 	"dam/enums"
 	"dam/models"
 	"dam/repositories"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -57,45 +56,60 @@ func (h *UserSettingHandler) CreateUserSetting(c *gin.Context) {
 
 	userSettingID := uuid.New().String()
 	err := h.db.Transaction(func(tx *gorm.DB) error {
-		if _, err := repositories.GetUserSettingsByUserID(ctx, tx, userID, true); err == nil {
+		// Settings holding only notification preferences are filled in.
+		userSetting, err := repositories.GetUserSettingsByUserID(ctx, tx, userID, true)
+		exists := err == nil
+		switch {
+		case exists && userSetting.StorageVendor != "":
 			return fmt.Errorf("user setting already exists")
+		case exists:
+			userSettingID = userSetting.UserSettingID
+		case !errors.Is(err, gorm.ErrRecordNotFound):
+			return err
+		default:
+			userSetting = &models.UserSetting{
+				UserSettingID: userSettingID,
+				UserID:        userID,
+				CreatedAt:     time.Now(),
+			}
 		}
 
-		userSetting := &models.UserSetting{
-			UserSettingID: userSettingID,
-			UserID:        userID,
-			StorageVendor: createUserSettingReq.StorageVendor,
-			StorageCredentials: &models.StorageCredentials{
-				AWSS3AccessKeyID:     createUserSettingReq.AWSS3AccessKey,
-				AWSS3SecretAccessKey: createUserSettingReq.AWSS3SecretKey,
-			},
-			StorageInformations: &models.StorageInformations{
-				AWSS3BucketName: createUserSettingReq.AWSS3BucketName,
-				AWSS3Region:     createUserSettingReq.AWSS3Region,
-			},
-			CreatedAt: time.Now(),
-			UpdatedAt: time.Now(),
+		userSetting.StorageVendor = createUserSettingReq.StorageVendor
+		userSetting.StorageCredentials = &models.StorageCredentials{
+			AWSS3AccessKeyID:     createUserSettingReq.AWSS3AccessKey,
+			AWSS3SecretAccessKey: createUserSettingReq.AWSS3SecretKey,
+		}
+		userSetting.StorageInformations = &models.StorageInformations{
+			AWSS3BucketName: createUserSettingReq.AWSS3BucketName,
+			AWSS3Region:     createUserSettingReq.AWSS3Region,
+		}
+		userSetting.UpdatedAt = time.Now()
+		if exists {
+			err = repositories.UpdateUserSetting(ctx, tx, userSetting)
+		} else {
+			err = repositories.CreateUserSetting(ctx, tx, userSetting)
 		}
-		if err := repositories.CreateUserSetting(ctx, tx, userSetting); err != nil {
+		if err != nil {
+			return err
+		}
+
+		// Credentials stay out of the audit log.
+		err = repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditUserSettingCreated, enums.AuditTargetUserSetting, userSettingID, map[string]interface{}{
+			"storage_vendor": userSetting.StorageVendor,
+			"bucket_name":    userSetting.StorageInformations.AWSS3BucketName,
+			"region":         userSetting.StorageInformations.AWSS3Region,
+		}))
+		if err != nil {
 			return err
 		}
 
 		if createUserSettingReq.StorageVendor == string(enums.StorageAmazonS3) {
-			sdkConfig, err := config.LoadDefaultConfig(
-				ctx,
-				config.WithRegion(createUserSettingReq.AWSS3Region),
-				config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
-					createUserSettingReq.AWSS3AccessKey,
-					createUserSettingReq.AWSS3SecretKey,
-					""),
-				),
-			)
+			s3Client, err := newS3Client(ctx, createUserSettingReq.AWSS3Region, createUserSettingReq.AWSS3AccessKey, createUserSettingReq.AWSS3SecretKey)
 			if err != nil {
-				return fmt.Errorf("load default config error: %w", err)
+				return err
 			}
 
 			// Create S3 bucket
-			s3Client := s3.NewFromConfig(sdkConfig)
 			_, err = s3Client.CreateBucket(ctx, &s3.CreateBucketInput{
 				Bucket: &createUserSettingReq.AWSS3BucketName,
 			})
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"dam/apis"
+	"dam/models"
+	"dam/repositories"
+
+	"gorm.io/gorm"
+)
+
+// usersByID loads the users with the given IDs, which may repeat, to name them in a response.
+func usersByID(ctx context.Context, db *gorm.DB, userIDs []string) (map[string]*models.User, error) {
+	users, err := repositories.ListUsersByIDs(ctx, db, userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]*models.User, len(users))
+	for i := range users {
+		byID[users[i].UserID] = &users[i]
+	}
+	return byID, nil
+}
+
+// userSummary names userID using users, falling back to the bare ID for a user who is gone.
+func userSummary(userID string, users map[string]*models.User) apis.UserSummary {
+	summary := apis.UserSummary{UserID: userID}
+	if user, ok := users[userID]; ok {
+		summary.Username = user.Username
+		summary.Name = user.Name
+	}
+	return summary
+}
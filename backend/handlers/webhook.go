@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"dam/enums"
+	"dam/models"
+	"encoding/json"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newOutboxEvent describes a change by the user making the request to an item of ownerID in
+// directoryID, to be stored with repositories.CreateOutboxEvent in the transaction making
+// the change.
+func newOutboxEvent(c *gin.Context, eventType enums.WebhookEvent, ownerID, directoryID string, data map[string]interface{}) *models.OutboxEvent {
+	// Data only holds strings, numbers and slices of strings, which always marshal.
+	rawData, _ := json.Marshal(data)
+
+	return &models.OutboxEvent{
+		EventType:   string(eventType),
+		ActorID:     c.Request.Context().Value(enums.UserIDCtxKey).(string),
+		OwnerID:     ownerID,
+		DirectoryID: directoryID,
+		Data:        string(rawData),
+		CreatedAt:   time.Now(),
+	}
+}
+
+func fileEventData(file *models.File) map[string]interface{} {
+	return map[string]interface{}{
+		"file_id":                file.FileID,
+		"name":                   file.Name,
+		"directory_id":           file.DirectoryID,
+		"size":                   file.Size,
+		"extension":              file.Extension,
+		"user_id":                file.UserID,
+		"latest_file_version_id": file.LatestFileVersionID,
+	}
+}
+
+func fileVersionEventData(file *models.File, fileVersion *models.FileVersion) map[string]interface{} {
+	return map[string]interface{}{
+		"file_id":         file.FileID,
+		"name":            file.Name,
+		"directory_id":    file.DirectoryID,
+		"file_version_id": fileVersion.FileVersionID,
+		"size":            fileVersion.Size,
+		"extension":       fileVersion.Extension,
+		"user_id":         fileVersion.UserID,
+	}
+}
+
+func directoryEventData(dir *models.Directory) map[string]interface{} {
+	return map[string]interface{}{
+		"directory_id":        dir.DirectoryID,
+		"name":                dir.Name,
+		"parent_directory_id": dir.ParentDirectoryID,
+		"user_id":             dir.UserID,
+	}
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"dam/apis"
+	"dam/auth"
+	"dam/config"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	outboxBatchSize          = 100
+	webhookDeliveryBatchSize = 20
+	// webhookLeaseMargin is how long after the timeout of an attempt a claimed delivery is
+	// left alone by other instances.
+	webhookLeaseMargin = time.Minute
+	// maxWebhookResponseBody is how much of a response is kept in the delivery log.
+	maxWebhookResponseBody = 1024
+)
+
+var (
+	errPrivateWebhookTarget = errors.New("webhooks cannot post to loopback or private addresses")
+	errWebhookInactive      = errors.New("the webhook was turned off")
+)
+
+// WebhookDispatcher turns the events of the outbox into deliveries for the webhooks
+// subscribed to them and posts those, retrying failures with exponential backoff. Every
+// instance runs one; rows are claimed with SKIP LOCKED so that they share the work.
+type WebhookDispatcher struct {
+	db     *gorm.DB
+	config *config.WebhookConfig
+	client *http.Client
+	logger *zap.Logger
+}
+
+func NewWebhookDispatcher(db *gorm.DB, cfg *config.WebhookConfig, logger *zap.Logger) *WebhookDispatcher {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateTargets {
+		dialer.Control = refusePrivateAddress
+	}
+	return &WebhookDispatcher{
+		db:     db,
+		config: cfg,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: cfg.Timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+			Timeout: cfg.Timeout,
+			// A redirect could point anywhere, including back inside the network.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		logger: logger,
+	}
+}
+
+// Run dispatches events and attempts due deliveries every PollInterval until ctx is done.
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.dispatchOutbox(ctx); err != nil {
+			d.logger.Sugar().Errorf("dispatch outbox events error: %s", err.Error())
+		}
+		if err := d.deliverDue(ctx); err != nil {
+			d.logger.Sugar().Errorf("deliver webhooks error: %s", err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// dispatchOutbox creates a delivery of every event of the outbox for each active webhook
+// subscribed to it whose user owns the item which changed.
+func (d *WebhookDispatcher) dispatchOutbox(ctx context.Context) error {
+	for {
+		var dispatched int
+		err := d.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			events, err := repositories.LockUndispatchedOutboxEvents(ctx, tx, outboxBatchSize)
+			if err != nil || len(events) == 0 {
+				return err
+			}
+			dispatched = len(events)
+
+			webhooks, err := repositories.ListActiveWebhooks(ctx, tx)
+			if err != nil {
+				return err
+			}
+
+			now := time.Now()
+			deliveries := []models.WebhookDelivery{}
+			eventIDs := make([]int64, 0, len(events))
+			for i := range events {
+				event := &events[i]
+				eventIDs = append(eventIDs, event.EventID)
+				payload := webhookPayload(strconv.FormatInt(event.EventID, 10), event.EventType, event.ActorID, event.CreatedAt, event.Data)
+				for _, webhook := range webhooks {
+					if webhook.UserID != event.OwnerID || !slices.Contains(webhook.Events, event.EventType) {
+						continue
+					}
+					deliveries = append(deliveries, models.WebhookDelivery{
+						WebhookDeliveryID: uuid.New().String(),
+						WebhookID:         webhook.WebhookID,
+						EventType:         event.EventType,
+						Payload:           payload,
+						Status:            string(enums.WebhookDeliveryPending),
+						NextAttemptAt:     &now,
+						CreatedAt:         now,
+						UpdatedAt:         now,
+					})
+				}
+			}
+
+			if err := repositories.CreateWebhookDeliveries(ctx, tx, deliveries); err != nil {
+				return err
+			}
+			return repositories.MarkOutboxEventsDispatched(ctx, tx, eventIDs, now)
+		})
+		if err != nil || dispatched < outboxBatchSize {
+			return err
+		}
+	}
+}
+
+// deliverDue attempts the pending deliveries whose time has come, concurrently.
+func (d *WebhookDispatcher) deliverDue(ctx context.Context) error {
+	for {
+		now := time.Now()
+		deliveries, err := repositories.ClaimDueWebhookDeliveries(ctx, d.db, now, now.Add(d.config.Timeout+webhookLeaseMargin), webhookDeliveryBatchSize)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		webhooks, err := repositories.ListActiveWebhooks(ctx, d.db)
+		if err != nil {
+			return err
+		}
+		webhooksByID := make(map[string]*models.Webhook, len(webhooks))
+		for i := range webhooks {
+			webhooksByID[webhooks[i].WebhookID] = &webhooks[i]
+		}
+
+		var wg sync.WaitGroup
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				webhook, ok := webhooksByID[delivery.WebhookID]
+				if ok {
+					d.attempt(ctx, webhook, delivery, true)
+				} else {
+					delivery.Status = string(enums.WebhookDeliveryFailed)
+					delivery.NextAttemptAt = nil
+					delivery.Error = errWebhookInactive.Error()
+					delivery.UpdatedAt = time.Now()
+				}
+				// The outcome is recorded even when ctx is done, so that a shutdown does
+				// not cost an attempt.
+				saveCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+				defer cancel()
+				if err := repositories.UpdateWebhookDelivery(saveCtx, d.db, delivery); err != nil {
+					d.logger.Sugar().Errorf("save webhook delivery %s error: %s", delivery.WebhookDeliveryID, err.Error())
+				}
+			}()
+		}
+		wg.Wait()
+
+		if len(deliveries) < webhookDeliveryBatchSize || ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// Test posts a webhook.test event to webhook right away and records the delivery, which
+// is not retried.
+func (d *WebhookDispatcher) Test(ctx context.Context, webhook *models.Webhook) (*models.WebhookDelivery, error) {
+	now := time.Now()
+	deliveryID := uuid.New().String()
+	data, _ := json.Marshal(map[string]interface{}{"webhook_id": webhook.WebhookID})
+	delivery := &models.WebhookDelivery{
+		WebhookDeliveryID: deliveryID,
+		WebhookID:         webhook.WebhookID,
+		EventType:         string(enums.WebhookTest),
+		Payload:           webhookPayload(deliveryID, string(enums.WebhookTest), webhook.UserID, now, string(data)),
+		Status:            string(enums.WebhookDeliveryPending),
+		CreatedAt:         now,
+		UpdatedAt:         now,
+	}
+
+	d.attempt(ctx, webhook, delivery, false)
+	return delivery, repositories.CreateWebhookDeliveries(ctx, d.db, []models.WebhookDelivery{*delivery})
+}
+
+// attempt posts delivery to webhook and records the outcome in delivery. A failure is
+// scheduled for another attempt when retry is set and attempts are left.
+func (d *WebhookDispatcher) attempt(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery, retry bool) {
+	delivery.Attempts++
+	status, body, err := d.post(ctx, webhook, delivery)
+
+	now := time.Now()
+	delivery.UpdatedAt = now
+	delivery.ResponseStatus = status
+	delivery.ResponseBody = body
+	delivery.Error = ""
+	delivery.NextAttemptAt = nil
+	switch {
+	case err == nil:
+		delivery.Status = string(enums.WebhookDeliverySucceeded)
+	case retry && int64(delivery.Attempts) < d.config.MaxAttempts:
+		delivery.Error = err.Error()
+		next := now.Add(d.retryDelay(delivery.Attempts))
+		delivery.NextAttemptAt = &next
+	default:
+		delivery.Error = err.Error()
+		delivery.Status = string(enums.WebhookDeliveryFailed)
+	}
+}
+
+// post sends the payload of delivery, signed, and returns the response status and the
+// start of the response body. Anything but a 2xx status is an error.
+func (d *WebhookDispatcher) post(ctx context.Context, webhook *models.Webhook, delivery *models.WebhookDelivery) (*int, string, error) {
+	payload := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, "", err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "DAM-Webhooks")
+	req.Header.Set("X-DAM-Event", delivery.EventType)
+	req.Header.Set("X-DAM-Delivery", delivery.WebhookDeliveryID)
+	req.Header.Set("X-DAM-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-DAM-Signature", "sha256="+auth.SignWebhookPayload(webhook.Secret, timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxWebhookResponseBody))
+	// The rest is drained, up to a point, so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*maxWebhookResponseBody))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &resp.StatusCode, string(body), fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return &resp.StatusCode, string(body), nil
+}
+
+// retryDelay is how long to wait after the given number of failed attempts.
+func (d *WebhookDispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.config.BaseDelay
+	for i := 1; i < attempts && delay < d.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, d.config.MaxDelay)
+}
+
+func webhookPayload(eventID, eventType, actorID string, createdAt time.Time, data string) string {
+	// Data comes from the database as JSON, and the rest always marshals.
+	payload, _ := json.Marshal(apis.WebhookPayload{
+		EventID:   eventID,
+		Type:      eventType,
+		ActorID:   actorID,
+		CreatedAt: createdAt,
+		Data:      json.RawMessage(data),
+	})
+	return string(payload)
+}
+
+// refusePrivateAddress keeps webhooks from reaching into the network the server runs in.
+// It is checked on the resolved address, so that DNS cannot be used to get around it.
+func refusePrivateAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() {
+		return errPrivateWebhookTarget
+	}
+	return nil
+}
@@ -0,0 +1,364 @@
+package handlers
+
+import (
+	"dam/apis"
+	"dam/auth"
+	"dam/enums"
+	"dam/models"
+	"dam/repositories"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type WebhookHandler struct {
+	WebhookRepo         repositories.WebhookRepoInterface
+	WebhookDeliveryRepo repositories.WebhookDeliveryRepoInterface
+	Dispatcher          *WebhookDispatcher
+	db                  *gorm.DB
+}
+
+type WebhookHandlerInterface interface {
+	CreateWebhook(c *gin.Context)
+	ListWebhooks(c *gin.Context)
+	GetWebhook(c *gin.Context)
+	UpdateWebhook(c *gin.Context)
+	DeleteWebhook(c *gin.Context)
+	ListWebhookDeliveries(c *gin.Context)
+	TestWebhook(c *gin.Context)
+}
+
+func NewWebhookHandler(db *gorm.DB, dispatcher *WebhookDispatcher) WebhookHandlerInterface {
+	return &WebhookHandler{
+		WebhookRepo:         repositories.NewWebhookRepo(db),
+		WebhookDeliveryRepo: repositories.NewWebhookDeliveryRepo(db),
+		Dispatcher:          dispatcher,
+		db:                  db,
+	}
+}
+
+// CreateWebhook subscribes a URL to events on the items of the current user. The secret
+// deliveries are signed with is only returned here.
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var webhookReq apis.WebhookRequest
+	if err := c.BindJSON(&webhookReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := webhookReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	secret, err := auth.NewWebhookSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	now := time.Now()
+	webhook := &models.Webhook{
+		WebhookID: uuid.New().String(),
+		UserID:    ctx.Value(enums.UserIDCtxKey).(string),
+		Secret:    secret,
+		CreatedAt: now,
+	}
+	applyWebhookRequest(webhook, &webhookReq, now)
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := repositories.CreateWebhook(ctx, tx, webhook); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditWebhookCreated, enums.AuditTargetWebhook, webhook.WebhookID, webhookAuditFields(webhook)))
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, apis.CreateWebhookResponse{
+		Webhook: webhookResponse(webhook),
+		Secret:  secret,
+	})
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	webhooks, err := h.WebhookRepo.ListWebhooksByUserID(ctx, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	items := make([]apis.Webhook, 0, len(webhooks))
+	for i := range webhooks {
+		items = append(items, webhookResponse(&webhooks[i]))
+	}
+
+	c.JSON(http.StatusOK, apis.ListWebhooksResponse{Webhooks: items})
+}
+
+func (h *WebhookHandler) GetWebhook(c *gin.Context) {
+	webhook, ok := h.getOwnWebhook(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookResponse(webhook))
+}
+
+// UpdateWebhook replaces the URL, events, description and state of a webhook. Deliveries
+// already made keep the URL they were made to.
+func (h *WebhookHandler) UpdateWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	var webhookReq apis.WebhookRequest
+	if err := c.BindJSON(&webhookReq); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.BindJSONError,
+		})
+		return
+	}
+
+	if err := webhookReq.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	var webhook *models.Webhook
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		webhook, err = repositories.GetWebhookByID(ctx, tx, userID, c.Param("webhook_id"))
+		if err != nil {
+			return err
+		}
+
+		previous := *webhook
+		applyWebhookRequest(webhook, &webhookReq, time.Now())
+		if err := repositories.UpdateWebhook(ctx, tx, webhook); err != nil {
+			return err
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditWebhookUpdated, enums.AuditTargetWebhook, webhook.WebhookID, auditChanges(webhookAuditFields(&previous), webhookAuditFields(webhook))))
+	})
+	if err != nil {
+		respondWithWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookResponse(webhook))
+}
+
+// DeleteWebhook deletes a webhook along with its delivery log. Pending deliveries are
+// dropped.
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	webhookID := c.Param("webhook_id")
+	err := h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		deleted, err := repositories.DeleteWebhook(ctx, tx, userID, webhookID)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			return gorm.ErrRecordNotFound
+		}
+		return repositories.CreateAuditLog(ctx, tx, newAuditLog(c, enums.AuditWebhookDeleted, enums.AuditTargetWebhook, webhookID, nil))
+	})
+	if err != nil {
+		respondWithWebhookError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{})
+}
+
+// ListWebhookDeliveries returns the delivery log of a webhook, newest first, optionally
+// only the deliveries in one status.
+func (h *WebhookHandler) ListWebhookDeliveries(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	webhook, ok := h.getOwnWebhook(c)
+	if !ok {
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > maxListLimit {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid limit",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+	params := repositories.ListWebhookDeliveriesParams{WebhookID: webhook.WebhookID, Limit: limit}
+
+	params.Status = c.Query("status")
+	validStatuses := []enums.WebhookDeliveryStatus{enums.WebhookDeliveryPending, enums.WebhookDeliverySucceeded, enums.WebhookDeliveryFailed}
+	if params.Status != "" && !slices.Contains(validStatuses, enums.WebhookDeliveryStatus(params.Status)) {
+		c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+			Message: "Invalid status",
+			Code:    enums.InvalidRequestError,
+		})
+		return
+	}
+
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		params.After = &repositories.WebhookDeliveryCursor{}
+		if err := decodeCursor(cursorStr, params.After); err != nil {
+			c.JSON(http.StatusBadRequest, apis.ErrorResponse{
+				Message: "Invalid cursor",
+				Code:    enums.InvalidRequestError,
+			})
+			return
+		}
+	}
+
+	page, err := h.WebhookDeliveryRepo.ListWebhookDeliveries(ctx, params)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	resp := apis.ListWebhookDeliveriesResponse{Deliveries: make([]apis.WebhookDelivery, 0, len(page.Deliveries))}
+	for i := range page.Deliveries {
+		resp.Deliveries = append(resp.Deliveries, webhookDeliveryResponse(&page.Deliveries[i]))
+	}
+	if page.NextCursor != nil {
+		resp.NextCursor = encodeCursor(page.NextCursor)
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// TestWebhook posts a webhook.test event to a webhook, even a turned off one, and returns
+// how the delivery went.
+func (h *WebhookHandler) TestWebhook(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	webhook, ok := h.getOwnWebhook(c)
+	if !ok {
+		return
+	}
+
+	delivery, err := h.Dispatcher.Test(ctx, webhook)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+			Message: err.Error(),
+			Code:    enums.InternalError,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookDeliveryResponse(delivery))
+}
+
+// getOwnWebhook reads the webhook of the path, which must belong to the current user. On
+// failure it responds with the error and returns false.
+func (h *WebhookHandler) getOwnWebhook(c *gin.Context) (*models.Webhook, bool) {
+	ctx := c.Request.Context()
+
+	userID := ctx.Value(enums.UserIDCtxKey).(string)
+	webhook, err := h.WebhookRepo.GetWebhookByID(ctx, userID, c.Param("webhook_id"))
+	if err != nil {
+		respondWithWebhookError(c, err)
+		return nil, false
+	}
+	return webhook, true
+}
+
+func applyWebhookRequest(webhook *models.Webhook, webhookReq *apis.WebhookRequest, now time.Time) {
+	events := slices.Clone(webhookReq.Events)
+	slices.Sort(events)
+
+	webhook.URL = webhookReq.URL
+	webhook.Events = slices.Compact(events)
+	webhook.Description = webhookReq.Description
+	webhook.Active = webhookReq.Active == nil || *webhookReq.Active
+	webhook.UpdatedAt = now
+}
+
+func webhookAuditFields(webhook *models.Webhook) map[string]interface{} {
+	return map[string]interface{}{
+		"url":         webhook.URL,
+		"events":      []string(webhook.Events),
+		"description": webhook.Description,
+		"active":      webhook.Active,
+	}
+}
+
+func respondWithWebhookError(c *gin.Context, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, apis.ErrorResponse{
+			Message: "Webhook not found",
+			Code:    enums.WebhookNotFoundError,
+		})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+		Message: err.Error(),
+		Code:    enums.InternalError,
+	})
+}
+
+func webhookResponse(webhook *models.Webhook) apis.Webhook {
+	return apis.Webhook{
+		WebhookID:   webhook.WebhookID,
+		URL:         webhook.URL,
+		Events:      webhook.Events,
+		Description: webhook.Description,
+		Active:      webhook.Active,
+		CreatedAt:   webhook.CreatedAt,
+		UpdatedAt:   webhook.UpdatedAt,
+	}
+}
+
+func webhookDeliveryResponse(delivery *models.WebhookDelivery) apis.WebhookDelivery {
+	return apis.WebhookDelivery{
+		WebhookDeliveryID: delivery.WebhookDeliveryID,
+		EventType:         delivery.EventType,
+		Payload:           json.RawMessage(delivery.Payload),
+		Status:            delivery.Status,
+		Attempts:          delivery.Attempts,
+		NextAttemptAt:     delivery.NextAttemptAt,
+		ResponseStatus:    delivery.ResponseStatus,
+		ResponseBody:      delivery.ResponseBody,
+		Error:             delivery.Error,
+		CreatedAt:         delivery.CreatedAt,
+		UpdatedAt:         delivery.UpdatedAt,
+	}
+}
@@ -0,0 +1,15 @@
+package mail
+
+import "context"
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails. SMTPSender is used in production, MemorySender keeps messages
+// around for tests and local development.
+type Sender interface {
+	Send(ctx context.Context, message *Message) error
+}
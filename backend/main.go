@@ -7,10 +7,15 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"dam/auth"
 	"dam/config"
+	"dam/enums"
 	"dam/handlers"
+	"dam/mail"
 	"dam/middlewares"
+	"dam/repositories"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
@@ -26,43 +31,172 @@ func main() {
 	}
 
 	config.LoadConfig()
-	db, err := gorm.Open(postgres.Open(config.Cfg.Database.DSN()), &gorm.Config{})
+	db, err := gorm.Open(postgres.Open(config.Cfg.Database.DSN()), &gorm.Config{TranslateError: true})
 	if err != nil {
 		logger.Sugar().Errorf("connect database error: %s", err.Error())
 		return
 	}
+	if config.Cfg.Application.CaseInsensitiveNames {
+		if err := repositories.EnsureCaseInsensitiveNameIndexes(context.Background(), db); err != nil {
+			logger.Sugar().Errorf("create case-insensitive name indexes error: %s", err.Error())
+			return
+		}
+	}
 	rdClient := redis.NewClient(&redis.Options{Addr: config.Cfg.Redis.Addr()})
+	tokenManager, err := auth.NewTokenManager(config.Cfg.Auth)
+	if err != nil {
+		logger.Sugar().Errorf("create token manager error: %s", err.Error())
+		return
+	}
 
 	// gracefull shutdown
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	userHandler := handlers.NewUserHandler(db, rdClient)
+	authHandler := handlers.NewAuthHandler(tokenManager)
+	sessionStore := auth.NewSessionStore(rdClient, config.Cfg.Auth.RefreshTokenTTL)
+	userRepo := repositories.NewUserRepo(db)
+	authentication := middlewares.Authentication(tokenManager, sessionStore, repositories.NewPersonalAccessTokenRepo(db), userRepo)
+	var mailSender mail.Sender
+	if config.Cfg.Mail.Host != "" {
+		mailSender = mail.NewSMTPSender(config.Cfg.Mail)
+	} else {
+		logger.Sugar().Warn("DAM_SMTP_HOST is not set, emails are kept in memory and never delivered")
+		mailSender = mail.NewMemorySender()
+	}
+	accountMailer := handlers.NewAccountMailer(db, mailSender, logger)
+	challengeStore := auth.NewTwoFactorChallengeStore(rdClient, config.Cfg.TwoFactor.ChallengeTTL)
+	loginThrottle := auth.NewLoginThrottle(rdClient, config.Cfg.Login)
+	userHandler := handlers.NewUserHandler(db, tokenManager, sessionStore, challengeStore, accountMailer, loginThrottle)
+	passwordResetThrottle := auth.NewPasswordResetThrottle(rdClient, config.Cfg.PasswordReset)
+	accountHandler := handlers.NewAccountHandler(db, accountMailer, sessionStore, passwordResetThrottle)
+	twoFactorHandler := handlers.NewTwoFactorHandler(db, challengeStore, tokenManager, sessionStore)
 	directoryHandler := handlers.NewDirectoryHandler(db)
-	fileHandler := handlers.NewFileHandler(db)
+	recentActivityRecorder := handlers.NewRecentActivityRecorder(db, logger)
+	fileHandler := handlers.NewFileHandler(db, recentActivityRecorder)
+	favoriteHandler := handlers.NewFavoriteHandler(db)
+	recentActivityHandler := handlers.NewRecentActivityHandler(db)
 	userSettingHandler := handlers.NewUserSettingHandler(db)
+	personalAccessTokenHandler := handlers.NewPersonalAccessTokenHandler(db)
+	adminHandler := handlers.NewAdminHandler(db, tokenManager, sessionStore)
+	auditHandler := handlers.NewAuditHandler(db)
+	activityHandler := handlers.NewActivityHandler(db)
+	commentHandler := handlers.NewCommentHandler(db)
+	reviewHandler := handlers.NewReviewHandler(db)
+	webhookDispatcher := handlers.NewWebhookDispatcher(db, config.Cfg.Webhook, logger)
+	go webhookDispatcher.Run(ctx)
+	webhookHandler := handlers.NewWebhookHandler(db, webhookDispatcher)
+	eventStream := handlers.NewEventStream(db, rdClient, logger)
+	go eventStream.Run(ctx)
+	eventStreamHandler := handlers.NewEventStreamHandler(db, eventStream)
+	notificationMailer := handlers.NewNotificationMailer(db, mailSender, logger)
+	go notificationMailer.Run(ctx)
+	notificationHandler := handlers.NewNotificationHandler(db)
 
 	router := gin.Default()
 
+	router.GET("/.well-known/jwks.json", authHandler.GetJWKS)
+
 	router.POST("/users/login", userHandler.Login)
-	router.POST("/users/logout", userHandler.Logout)
+	router.POST("/users/login/2fa", twoFactorHandler.VerifyLogin)
+	router.POST("/users/login/2fa/enroll", twoFactorHandler.EnrollLoginTOTP)
+	router.POST("/users/logout", authentication, userHandler.Logout)
+	router.POST("/users/token/refresh", userHandler.RefreshToken)
 	router.POST("/users", userHandler.CreateUser)
-	router.GET("/users/me", middlewares.Authentication(rdClient), userHandler.GetCurrentUser)
-	router.PUT("/users/me", middlewares.Authentication(rdClient), userHandler.UpdateUser)
-
-	router.POST("/users/settings", middlewares.Authentication(rdClient), userSettingHandler.CreateUserSetting)
-
-	router.POST("/directories", middlewares.Authentication(rdClient), directoryHandler.CreateDirectory)
-	router.PUT("/directories/:directory_id", middlewares.Authentication(rdClient), directoryHandler.UpdateDirectory)
-	router.GET("/directories/:directory_id/details", middlewares.Authentication(rdClient), directoryHandler.GetDirectoryByID)
-	router.POST("/directories/:directory_id/files", middlewares.Authentication(rdClient), fileHandler.UploadFile)
-	router.GET("/directories/:directory_id", middlewares.Authentication(rdClient), directoryHandler.ListFilesOrFoldersByDirectoryID)
-	router.POST("/directories/move", middlewares.Authentication(rdClient), directoryHandler.MoveDirectories)
-
-	router.POST("/files/move", middlewares.Authentication(rdClient), fileHandler.MoveFiles)
-	router.GET("/files/:file_id", middlewares.Authentication(rdClient), fileHandler.GetFile)
-	router.PUT("/files/:file_id", middlewares.Authentication(rdClient), fileHandler.UpdateFile)
-	router.GET("/files/:file_id/versions", middlewares.Authentication(rdClient), fileHandler.ListFileVersions)
+	router.POST("/users/email/verify", accountHandler.VerifyEmail)
+	router.POST("/users/password/forgot", accountHandler.ForgotPassword)
+	router.POST("/users/password/reset", accountHandler.ResetPassword)
+	if config.Cfg.OIDC.IssuerURL != "" {
+		oidcProvider := auth.NewOIDCProvider(config.Cfg.OIDC, rdClient, &http.Client{Timeout: 10 * time.Second})
+		oidcHandler := handlers.NewOIDCHandler(db, oidcProvider, tokenManager, sessionStore, challengeStore)
+		router.GET("/users/oidc/login", oidcHandler.StartLogin)
+		router.GET("/users/oidc/callback", oidcHandler.Callback)
+	}
+	router.GET("/users/me", authentication, middlewares.RequireScope(enums.ScopeRead), userHandler.GetCurrentUser)
+	router.PUT("/users/me", authentication, middlewares.RequireScope(enums.ScopeAdmin), userHandler.UpdateUser)
+	router.POST("/users/me/email/verification", authentication, middlewares.RequireScope(enums.ScopeAdmin), accountHandler.ResendEmailVerification)
+	router.PUT("/users/me/password", authentication, middlewares.RequireScope(enums.ScopeAdmin), accountHandler.ChangePassword)
+	router.GET("/users/me/sessions", authentication, middlewares.RequireScope(enums.ScopeAdmin), userHandler.ListSessions)
+	router.DELETE("/users/me/sessions", authentication, middlewares.RequireScope(enums.ScopeAdmin), userHandler.DeleteAllSessions)
+	router.DELETE("/users/me/sessions/:session_id", authentication, middlewares.RequireScope(enums.ScopeAdmin), userHandler.DeleteSession)
+	router.GET("/users/me/2fa", authentication, middlewares.RequireScope(enums.ScopeAdmin), twoFactorHandler.GetTwoFactorStatus)
+	router.POST("/users/me/2fa/totp", authentication, middlewares.RequireScope(enums.ScopeAdmin), twoFactorHandler.EnrollTOTP)
+	router.POST("/users/me/2fa/totp/confirm", authentication, middlewares.RequireScope(enums.ScopeAdmin), twoFactorHandler.ConfirmTOTP)
+	router.POST("/users/me/2fa/totp/disable", authentication, middlewares.RequireScope(enums.ScopeAdmin), twoFactorHandler.DisableTOTP)
+	router.POST("/users/me/2fa/recovery-codes", authentication, middlewares.RequireScope(enums.ScopeAdmin), twoFactorHandler.RegenerateRecoveryCodes)
+	router.POST("/users/me/tokens", authentication, middlewares.RequireScope(enums.ScopeAdmin), personalAccessTokenHandler.CreatePersonalAccessToken)
+	router.GET("/users/me/tokens", authentication, middlewares.RequireScope(enums.ScopeAdmin), personalAccessTokenHandler.ListPersonalAccessTokens)
+	router.DELETE("/users/me/tokens/:token_id", authentication, middlewares.RequireScope(enums.ScopeAdmin), personalAccessTokenHandler.RevokePersonalAccessToken)
+	router.POST("/users/me/webhooks", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.CreateWebhook)
+	router.GET("/users/me/webhooks", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.ListWebhooks)
+	router.GET("/users/me/webhooks/:webhook_id", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.GetWebhook)
+	router.PUT("/users/me/webhooks/:webhook_id", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.UpdateWebhook)
+	router.DELETE("/users/me/webhooks/:webhook_id", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.DeleteWebhook)
+	router.GET("/users/me/webhooks/:webhook_id/deliveries", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.ListWebhookDeliveries)
+	router.POST("/users/me/webhooks/:webhook_id/test", authentication, middlewares.RequireScope(enums.ScopeAdmin), webhookHandler.TestWebhook)
+	router.GET("/users/me/usage", authentication, middlewares.RequireScope(enums.ScopeRead), userHandler.GetCurrentUserUsage)
+	router.GET("/users/me/favorites", authentication, middlewares.RequireScope(enums.ScopeRead), favoriteHandler.ListFavorites)
+	router.GET("/users/me/recent", authentication, middlewares.RequireScope(enums.ScopeRead), recentActivityHandler.ListRecentActivities)
+	router.GET("/users/me/reviews", authentication, middlewares.RequireScope(enums.ScopeRead), reviewHandler.ListMyPendingReviews)
+	router.GET("/users/me/notifications", authentication, middlewares.RequireScope(enums.ScopeRead), notificationHandler.ListNotifications)
+	router.POST("/users/me/notifications/read", authentication, middlewares.RequireScope(enums.ScopeWrite), notificationHandler.ReadNotifications)
+	router.POST("/users/me/notifications/:notification_id/read", authentication, middlewares.RequireScope(enums.ScopeWrite), notificationHandler.ReadNotification)
+	router.GET("/users/me/notifications/preferences", authentication, middlewares.RequireScope(enums.ScopeAdmin), notificationHandler.GetNotificationPreferences)
+	router.PUT("/users/me/notifications/preferences", authentication, middlewares.RequireScope(enums.ScopeAdmin), notificationHandler.UpdateNotificationPreferences)
+
+	router.POST("/users/settings", authentication, middlewares.RequireScope(enums.ScopeAdmin), userSettingHandler.CreateUserSetting)
+
+	router.POST("/directories", authentication, middlewares.RequireScope(enums.ScopeWrite), directoryHandler.CreateDirectory)
+	router.PUT("/directories/:directory_id", authentication, middlewares.RequireScope(enums.ScopeWrite), directoryHandler.UpdateDirectory)
+	router.GET("/directories/:directory_id/details", authentication, middlewares.RequireScope(enums.ScopeRead), directoryHandler.GetDirectoryByID)
+	router.POST("/directories/:directory_id/files", authentication, middlewares.RequireScope(enums.ScopeWrite), fileHandler.UploadFile)
+	router.GET("/directories/:directory_id", authentication, middlewares.RequireScope(enums.ScopeRead), directoryHandler.ListFilesOrFoldersByDirectoryID)
+	router.POST("/directories/move", authentication, middlewares.RequireScope(enums.ScopeWrite), directoryHandler.MoveDirectories)
+	router.POST("/directories/copy", authentication, middlewares.RequireScope(enums.ScopeWrite), directoryHandler.CopyDirectories)
+	router.GET("/directories/:directory_id/upload-policy", authentication, middlewares.RequireScope(enums.ScopeRead), directoryHandler.GetUploadPolicy)
+	router.PUT("/directories/:directory_id/upload-policy", authentication, middlewares.RequireScope(enums.ScopeWrite), directoryHandler.UpdateUploadPolicy)
+	router.GET("/directories/:directory_id/tree", authentication, middlewares.RequireScope(enums.ScopeRead), directoryHandler.GetDirectoryTree)
+	router.GET("/directories/:directory_id/breadcrumbs", authentication, middlewares.RequireScope(enums.ScopeRead), directoryHandler.GetDirectoryBreadcrumbs)
+	router.GET("/directories/:directory_id/activity", authentication, middlewares.RequireScope(enums.ScopeRead), activityHandler.ListDirectoryActivity)
+	router.PUT("/directories/:directory_id/favorite", authentication, middlewares.RequireScope(enums.ScopeWrite), favoriteHandler.FavoriteDirectory)
+	router.DELETE("/directories/:directory_id/favorite", authentication, middlewares.RequireScope(enums.ScopeWrite), favoriteHandler.UnfavoriteDirectory)
+	router.GET("/paths/resolve", authentication, middlewares.RequireScope(enums.ScopeRead), directoryHandler.ResolvePath)
+
+	router.POST("/files/move", authentication, middlewares.RequireScope(enums.ScopeWrite), fileHandler.MoveFiles)
+	router.POST("/files/copy", authentication, middlewares.RequireScope(enums.ScopeWrite), fileHandler.CopyFiles)
+	router.GET("/files/:file_id", authentication, middlewares.RequireScope(enums.ScopeRead), fileHandler.GetFile)
+	router.PUT("/files/:file_id", authentication, middlewares.RequireScope(enums.ScopeWrite), fileHandler.UpdateFile)
+	router.GET("/files/:file_id/versions", authentication, middlewares.RequireScope(enums.ScopeRead), fileHandler.ListFileVersions)
+	router.GET("/files/:file_id/versions/:file_version_id/reviews", authentication, middlewares.RequireScope(enums.ScopeRead), reviewHandler.ListReviews)
+	router.POST("/files/:file_id/versions/:file_version_id/reviews", authentication, middlewares.RequireScope(enums.ScopeWrite), reviewHandler.RequestReview)
+	router.PUT("/files/:file_id/versions/:file_version_id/reviews/me", authentication, middlewares.RequireScope(enums.ScopeWrite), reviewHandler.DecideReview)
+	router.GET("/files/:file_id/breadcrumbs", authentication, middlewares.RequireScope(enums.ScopeRead), fileHandler.GetFileBreadcrumbs)
+	router.GET("/files/:file_id/activity", authentication, middlewares.RequireScope(enums.ScopeRead), activityHandler.ListFileActivity)
+	router.GET("/files/:file_id/comments", authentication, middlewares.RequireScope(enums.ScopeRead), commentHandler.ListComments)
+	router.POST("/files/:file_id/comments", authentication, middlewares.RequireScope(enums.ScopeWrite), commentHandler.CreateComment)
+	router.GET("/files/:file_id/download", authentication, middlewares.RequireScope(enums.ScopeRead), fileHandler.DownloadFile)
+	router.PUT("/files/:file_id/favorite", authentication, middlewares.RequireScope(enums.ScopeWrite), favoriteHandler.FavoriteFile)
+	router.DELETE("/files/:file_id/favorite", authentication, middlewares.RequireScope(enums.ScopeWrite), favoriteHandler.UnfavoriteFile)
+
+	router.PUT("/comments/:comment_id", authentication, middlewares.RequireScope(enums.ScopeWrite), commentHandler.UpdateComment)
+	router.DELETE("/comments/:comment_id", authentication, middlewares.RequireScope(enums.ScopeWrite), commentHandler.DeleteComment)
+	router.POST("/comments/:comment_id/resolve", authentication, middlewares.RequireScope(enums.ScopeWrite), commentHandler.ResolveComment)
+	router.POST("/comments/:comment_id/unresolve", authentication, middlewares.RequireScope(enums.ScopeWrite), commentHandler.UnresolveComment)
+
+	router.GET("/events", authentication, middlewares.RequireScope(enums.ScopeRead), eventStreamHandler.StreamEvents)
+
+	router.GET("/audit", authentication, middlewares.RequireScope(enums.ScopeRead), auditHandler.ListAuditLogs)
+	router.GET("/audit/export", authentication, middlewares.RequireScope(enums.ScopeRead), auditHandler.ExportAuditLogs)
+
+	admin := router.Group("/admin", authentication, middlewares.RequireScope(enums.ScopeAdmin), middlewares.RequireRole(enums.RoleAdmin, userRepo))
+	admin.GET("/users", adminHandler.ListUsers)
+	admin.GET("/users/:user_id", adminHandler.GetUser)
+	admin.POST("/users/:user_id/disable", adminHandler.DisableUser)
+	admin.POST("/users/:user_id/enable", adminHandler.EnableUser)
+	admin.POST("/users/:user_id/quota/reset", adminHandler.ResetUserQuota)
+	admin.PUT("/users/:user_id/quota", adminHandler.UpdateUserQuota)
+	admin.GET("/users/:user_id/usage", adminHandler.GetUserUsage)
+	admin.POST("/users/:user_id/impersonate", adminHandler.ImpersonateUser)
 
 	// TODO: add ping and health
 	srv := &http.Server{
@@ -3,17 +3,23 @@ package middlewares
 import (
 	"context"
 	"dam/apis"
+	"dam/auth"
 	"dam/enums"
-	"fmt"
+	"dam/models"
+	"dam/repositories"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"github.com/redis/go-redis/v9"
 )
 
-func Authentication(rdClient *redis.Client) gin.HandlerFunc {
+// Authentication accepts either a session JWT or a personal access token as bearer token.
+// Requests made with a personal access token carry its scopes, see RequireScope.
+// Disabled users are rejected: their sessions are revoked when they are disabled, their
+// personal access tokens are checked here.
+func Authentication(tokenManager *auth.TokenManager, sessionStore *auth.SessionStore, personalAccessTokenRepo repositories.PersonalAccessTokenRepoInterface, userRepo repositories.UserRepoInterface) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ctx := c.Request.Context()
 
@@ -37,26 +43,28 @@ func Authentication(rdClient *redis.Client) gin.HandlerFunc {
 			return
 		}
 
-		tokenStr := authParts[1]
-		if _, err := rdClient.Get(ctx, tokenStr).Result(); err != nil {
-			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
-				Message: "Invalid JWT",
-				Code:    enums.InvalidTokenError,
-			})
-			c.Abort()
-			return
-		}
-
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		if auth.IsPersonalAccessToken(authParts[1]) {
+			token, err := authenticatePersonalAccessToken(ctx, personalAccessTokenRepo, userRepo, authParts[1])
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+					Message: "Invalid personal access token",
+					Code:    enums.InvalidTokenError,
+				})
+				c.Abort()
+				return
 			}
 
-			return []byte("your-secret-key"), nil
-		})
+			ctx = context.WithValue(ctx, enums.UserIDCtxKey, token.UserID)
+			ctx = context.WithValue(ctx, enums.ScopesCtxKey, []string(token.Scopes))
+
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+			return
+		}
 
-		if err != nil || !token.Valid {
-			c.JSON(401, apis.ErrorResponse{
+		claims, err := tokenManager.ParseAccessToken(authParts[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
 				Message: "Invalid JWT",
 				Code:    enums.InvalidTokenError,
 			})
@@ -64,19 +72,52 @@ func Authentication(rdClient *redis.Client) gin.HandlerFunc {
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(401, apis.ErrorResponse{
-				Message: "Invalid JWT claims",
+		// The token is only accepted while its session was neither revoked nor expired.
+		userID, err := sessionStore.TouchSession(ctx, claims.SessionID)
+		if err != nil || userID != claims.UserID {
+			c.JSON(http.StatusUnauthorized, apis.ErrorResponse{
+				Message: "Invalid JWT",
 				Code:    enums.InvalidTokenError,
 			})
 			c.Abort()
 			return
 		}
 
-		ctx = context.WithValue(ctx, enums.UserIDCtxKey, claims[string(enums.UserIDCtxKey)])
+		ctx = context.WithValue(ctx, enums.UserIDCtxKey, claims.UserID)
+		ctx = context.WithValue(ctx, enums.SessionIDCtxKey, claims.SessionID)
+		if claims.ImpersonatorID != "" {
+			ctx = context.WithValue(ctx, enums.ImpersonatorIDCtxKey, claims.ImpersonatorID)
+		}
 
 		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
+
+func authenticatePersonalAccessToken(ctx context.Context, personalAccessTokenRepo repositories.PersonalAccessTokenRepoInterface, userRepo repositories.UserRepoInterface, tokenStr string) (*models.PersonalAccessToken, error) {
+	token, err := personalAccessTokenRepo.GetPersonalAccessTokenByHash(ctx, auth.HashToken(tokenStr))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if token.RevokedAt != nil {
+		return nil, errors.New("personal access token was revoked")
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return nil, errors.New("personal access token expired")
+	}
+
+	user, err := userRepo.GetUserByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.DisabledAt != nil {
+		return nil, errors.New("user is disabled")
+	}
+
+	if err := personalAccessTokenRepo.TouchPersonalAccessToken(ctx, token.PersonalAccessTokenID, now); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
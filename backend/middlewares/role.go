@@ -0,0 +1,38 @@
+package middlewares
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"dam/repositories"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole rejects requests of users without role. It must run after Authentication.
+func RequireRole(role enums.UserRole, userRepo repositories.UserRepoInterface) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		user, err := userRepo.GetUserByID(ctx, ctx.Value(enums.UserIDCtxKey).(string))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, apis.ErrorResponse{
+				Message: err.Error(),
+				Code:    enums.InternalError,
+			})
+			c.Abort()
+			return
+		}
+
+		if user.Role != string(role) {
+			c.JSON(http.StatusForbidden, apis.ErrorResponse{
+				Message: "Insufficient role",
+				Code:    enums.InsufficientRoleError,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
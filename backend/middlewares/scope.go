@@ -0,0 +1,42 @@
+package middlewares
+
+import (
+	"dam/apis"
+	"dam/enums"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireScope rejects requests made with a personal access token lacking scope. It must
+// run after Authentication. Session tokens act with the full rights of their user, except
+// that an admin impersonating a user cannot touch their account settings, sessions or
+// tokens.
+func RequireScope(scope enums.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+
+		scopes, ok := ctx.Value(enums.ScopesCtxKey).([]string)
+		if ok && !slices.Contains(scopes, string(scope)) {
+			c.JSON(http.StatusForbidden, apis.ErrorResponse{
+				Message: fmt.Sprintf("token is missing the %s scope", scope),
+				Code:    enums.InsufficientScopeError,
+			})
+			c.Abort()
+			return
+		}
+
+		if _, impersonating := ctx.Value(enums.ImpersonatorIDCtxKey).(string); impersonating && scope == enums.ScopeAdmin {
+			c.JSON(http.StatusForbidden, apis.ErrorResponse{
+				Message: "Not allowed while impersonating a user",
+				Code:    enums.ImpersonationNotAllowedError,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
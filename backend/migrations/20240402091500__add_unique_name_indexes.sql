@@ -0,0 +1,3 @@
+CREATE UNIQUE INDEX directories_parent_directory_id_name_idx ON directories (parent_directory_id, name);
+
+CREATE UNIQUE INDEX files_directory_id_name_idx ON files (directory_id, name);
@@ -0,0 +1,4 @@
+ALTER TABLE file_versions
+ADD COLUMN blob_key VARCHAR(80);
+
+UPDATE file_versions SET blob_key = file_version_id WHERE blob_key IS NULL;
@@ -0,0 +1,15 @@
+CREATE TABLE storage_usages (
+    user_id VARCHAR(80) PRIMARY KEY,
+    used_bytes BIGINT NOT NULL DEFAULT 0,
+    soft_limit_bytes BIGINT,
+    hard_limit_bytes BIGINT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+INSERT INTO storage_usages (user_id, used_bytes)
+SELECT files.user_id, SUM(file_versions.size)
+FROM file_versions
+JOIN files ON files.file_id = file_versions.file_id
+GROUP BY files.user_id;
@@ -0,0 +1,10 @@
+CREATE TABLE upload_policies (
+    directory_id VARCHAR(80) PRIMARY KEY,
+    max_file_size BIGINT,
+    allowed_mime_types _TEXT,
+    allowed_extensions _TEXT,
+    max_files INT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (directory_id) REFERENCES directories(directory_id)
+);
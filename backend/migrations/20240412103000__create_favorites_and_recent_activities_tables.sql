@@ -0,0 +1,20 @@
+CREATE TABLE favorites (
+    user_id VARCHAR(80) NOT NULL,
+    item_id VARCHAR(80) NOT NULL,
+    is_directory BOOLEAN NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, item_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE TABLE recent_activities (
+    user_id VARCHAR(80) NOT NULL,
+    file_id VARCHAR(80) NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    accessed_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, file_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (file_id) REFERENCES files(file_id)
+);
+
+CREATE INDEX recent_activities_user_id_accessed_at_idx ON recent_activities (user_id, accessed_at DESC);
@@ -0,0 +1,15 @@
+CREATE TABLE audit_logs (
+    audit_log_id VARCHAR(80) PRIMARY KEY,
+    actor_id VARCHAR(80) NOT NULL DEFAULT '',
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL,
+    target_id VARCHAR(80) NOT NULL DEFAULT '',
+    ip VARCHAR(45) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX audit_logs_created_at_idx ON audit_logs (created_at);
+CREATE INDEX audit_logs_actor_id_idx ON audit_logs (actor_id, created_at);
+CREATE INDEX audit_logs_target_idx ON audit_logs (target_type, target_id, created_at);
@@ -0,0 +1,3 @@
+ALTER TABLE users ADD COLUMN disabled_at TIMESTAMP;
+
+CREATE INDEX users_created_at_idx ON users (created_at DESC, user_id DESC);
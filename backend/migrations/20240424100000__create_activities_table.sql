@@ -0,0 +1,14 @@
+CREATE TABLE activities (
+    activity_id VARCHAR(80) PRIMARY KEY,
+    item_id VARCHAR(80) NOT NULL,
+    is_directory BOOLEAN NOT NULL,
+    directory_id VARCHAR(80) NOT NULL,
+    actor_id VARCHAR(80) NOT NULL,
+    action VARCHAR(30) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (actor_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX activities_item_id_idx ON activities (item_id, created_at DESC, activity_id DESC);
+CREATE INDEX activities_directory_id_idx ON activities (directory_id, created_at DESC, activity_id DESC);
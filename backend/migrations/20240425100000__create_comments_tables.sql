@@ -0,0 +1,28 @@
+CREATE TABLE comments (
+    comment_id VARCHAR(80) PRIMARY KEY,
+    file_id VARCHAR(80) NOT NULL,
+    file_version_id VARCHAR(80) NOT NULL DEFAULT '',
+    parent_comment_id VARCHAR(80) NOT NULL DEFAULT '',
+    user_id VARCHAR(80) NOT NULL,
+    body TEXT NOT NULL,
+    annotation JSONB,
+    resolved_at TIMESTAMP,
+    resolved_by VARCHAR(80) NOT NULL DEFAULT '',
+    deleted_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (file_id) REFERENCES files(file_id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX comments_file_id_idx ON comments (file_id, created_at);
+
+CREATE TABLE comment_mentions (
+    comment_id VARCHAR(80) NOT NULL,
+    user_id VARCHAR(80) NOT NULL,
+    PRIMARY KEY (comment_id, user_id),
+    FOREIGN KEY (comment_id) REFERENCES comments(comment_id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX comment_mentions_user_id_idx ON comment_mentions (user_id);
@@ -0,0 +1,19 @@
+ALTER TABLE file_versions ADD COLUMN review_status VARCHAR(20) NOT NULL DEFAULT 'draft';
+
+ALTER TABLE upload_policies ADD COLUMN require_approval BOOLEAN;
+
+CREATE TABLE version_reviews (
+    file_version_id VARCHAR(80) NOT NULL,
+    reviewer_id VARCHAR(80) NOT NULL,
+    requested_by VARCHAR(80) NOT NULL,
+    decision VARCHAR(20) NOT NULL DEFAULT 'pending',
+    comment TEXT NOT NULL DEFAULT '',
+    requested_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    decided_at TIMESTAMP,
+    PRIMARY KEY (file_version_id, reviewer_id),
+    FOREIGN KEY (file_version_id) REFERENCES file_versions(file_version_id),
+    FOREIGN KEY (reviewer_id) REFERENCES users(user_id),
+    FOREIGN KEY (requested_by) REFERENCES users(user_id)
+);
+
+CREATE INDEX version_reviews_pending_idx ON version_reviews (reviewer_id, requested_at, file_version_id) WHERE decision = 'pending';
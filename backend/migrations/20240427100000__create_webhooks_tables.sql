@@ -0,0 +1,47 @@
+CREATE TABLE webhooks (
+    webhook_id VARCHAR(80) PRIMARY KEY,
+    user_id VARCHAR(80) NOT NULL,
+    url TEXT NOT NULL,
+    secret VARCHAR(80) NOT NULL,
+    events TEXT[] NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX webhooks_user_id_idx ON webhooks (user_id);
+
+-- outbox_events is written in the same transaction as the change it describes, so that
+-- nothing is announced for a change which is rolled back.
+CREATE TABLE outbox_events (
+    event_id BIGSERIAL PRIMARY KEY,
+    event_type VARCHAR(50) NOT NULL,
+    actor_id VARCHAR(80) NOT NULL DEFAULT '',
+    directory_id VARCHAR(80) NOT NULL DEFAULT '',
+    data JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    dispatched_at TIMESTAMP
+);
+
+CREATE INDEX outbox_events_undispatched_idx ON outbox_events (event_id) WHERE dispatched_at IS NULL;
+
+CREATE TABLE webhook_deliveries (
+    webhook_delivery_id VARCHAR(80) PRIMARY KEY,
+    webhook_id VARCHAR(80) NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP,
+    response_status INT,
+    response_body TEXT NOT NULL DEFAULT '',
+    error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (webhook_id) REFERENCES webhooks(webhook_id) ON DELETE CASCADE
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_webhook_id_idx ON webhook_deliveries (webhook_id, created_at DESC, webhook_delivery_id DESC);
@@ -0,0 +1,9 @@
+-- stream_position orders events as they are pushed to GET /events, which is the order
+-- their transactions committed in rather than the order of event_id. It doubles as the
+-- SSE event ID clients resume from.
+CREATE SEQUENCE outbox_events_stream_position_seq;
+
+ALTER TABLE outbox_events ADD COLUMN stream_position BIGINT;
+
+CREATE UNIQUE INDEX outbox_events_stream_position_idx ON outbox_events (stream_position);
+CREATE INDEX outbox_events_unpublished_idx ON outbox_events (event_id) WHERE stream_position IS NULL;
@@ -0,0 +1,20 @@
+CREATE TABLE notifications (
+    notification_id VARCHAR(80) PRIMARY KEY,
+    user_id VARCHAR(80) NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    actor_id VARCHAR(80) NOT NULL,
+    item_id VARCHAR(80) NOT NULL,
+    is_directory BOOLEAN NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    read_at TIMESTAMP,
+    email_pending BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    FOREIGN KEY (user_id) REFERENCES users(user_id),
+    FOREIGN KEY (actor_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC, notification_id DESC);
+CREATE INDEX notifications_unread_idx ON notifications (user_id, created_at DESC, notification_id DESC) WHERE read_at IS NULL;
+CREATE INDEX notifications_email_pending_idx ON notifications (created_at) WHERE email_pending;
+
+ALTER TABLE user_settings ADD COLUMN notification_preferences JSON;
@@ -0,0 +1,5 @@
+-- owner_id is the user owning the item an event is about, whose webhooks alone receive it.
+-- Events written before have the owner in their data.
+ALTER TABLE outbox_events ADD COLUMN owner_id VARCHAR(80) NOT NULL DEFAULT '';
+
+UPDATE outbox_events SET owner_id = COALESCE(data->>'user_id', '');
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Activity is an entry of the history users see on a file or directory.
+type Activity struct {
+	ActivityID  string
+	ItemID      string
+	IsDirectory bool
+	// DirectoryID is the directory the item was in after the change.
+	DirectoryID string
+	ActorID     string
+	Action      string
+	Details     string
+	CreatedAt   time.Time
+}
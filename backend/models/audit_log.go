@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type AuditLog struct {
+	AuditLogID string
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	IP         string
+	UserAgent  string
+	Metadata   string
+	CreatedAt  time.Time
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+type Comment struct {
+	CommentID string
+	FileID    string
+	// FileVersionID pins the comment to a version of the file, empty for the file as a whole.
+	FileVersionID string
+	// ParentCommentID is the comment opening the thread a reply belongs to, empty for the
+	// comment opening a thread.
+	ParentCommentID string
+	UserID          string
+	Body            string
+	Annotation      *CommentAnnotation `gorm:"serializer:json"`
+	ResolvedAt      *time.Time
+	ResolvedBy      string
+	// DeletedAt is set instead of removing the comment, so that its replies stay in place.
+	DeletedAt *time.Time
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// CommentAnnotation points a comment at a part of the file. Exactly one field is set.
+type CommentAnnotation struct {
+	Region    *AnnotationRegion
+	TimeRange *AnnotationTimeRange
+}
+
+// AnnotationRegion is a rectangle on an image, in fractions of its width and height from
+// its top left corner.
+type AnnotationRegion struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+}
+
+// AnnotationTimeRange is a moment or, with End, a span of a video, in seconds from its start.
+type AnnotationTimeRange struct {
+	Start float64
+	End   *float64
+}
+
+type CommentMention struct {
+	CommentID string
+	UserID    string
+}
@@ -12,3 +12,15 @@ type Directory struct {
 	CreatedAt         time.Time
 	UpdatedAt         time.Time
 }
+
+type DirectoryTreeNode struct {
+	DirectoryID       string
+	Name              string
+	FullPath          string
+	Level             int
+	ParentDirectoryID string
+	FileCount         int64
+	TotalSize         int64
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type Favorite struct {
+	UserID      string
+	ItemID      string
+	IsDirectory bool
+	CreatedAt   time.Time
+}
@@ -22,11 +22,16 @@ type File struct {
 }
 
 type FileOrFolder struct {
-	ID                string
-	Name              string
-	ParentDirectoryID string
-	IsDirectory       bool
-	FullPath          string
-	CreatedAt         time.Time
-	UpdatedAt         time.Time
+	ID                  string
+	Name                string
+	ParentDirectoryID   string
+	IsDirectory         bool
+	FullPath            string
+	Size                int64
+	MimeType            string
+	Tags                pq.StringArray `gorm:"type:_text"`
+	LatestFileVersionID string
+	SortValue           string
+	CreatedAt           time.Time
+	UpdatedAt           time.Time
 }
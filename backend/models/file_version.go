@@ -5,9 +5,11 @@ import "time"
 type FileVersion struct {
 	FileVersionID string
 	FileID        string
+	BlobKey       string
 	Size          int64
 	Extension     string
 	UserID        string
+	ReviewStatus  string
 	CreatedAt     time.Time
 	UpdatedAt     time.Time
 }
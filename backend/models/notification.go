@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// Notification tells a user about something another user did which concerns them.
+type Notification struct {
+	NotificationID string
+	UserID         string
+	Type           string
+	ActorID        string
+	// ItemID is the file or directory the notification is about.
+	ItemID      string
+	IsDirectory bool
+	Details     string
+	ReadAt      *time.Time
+	// EmailPending is set while the notification is yet to be emailed to its user.
+	EmailPending bool
+	CreatedAt    time.Time
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PersonalAccessToken struct {
+	PersonalAccessTokenID string
+	UserID                string
+	Name                  string
+	TokenHash             string
+	Scopes                pq.StringArray `gorm:"type:_text"`
+	ExpiresAt             *time.Time
+	LastUsedAt            *time.Time
+	RevokedAt             *time.Time
+	CreatedAt             time.Time
+}
@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+type RecentActivity struct {
+	UserID     string
+	FileID     string
+	Action     string
+	AccessedAt time.Time
+}
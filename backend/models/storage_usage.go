@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+type StorageUsage struct {
+	UserID         string
+	UsedBytes      int64
+	SoftLimitBytes *int64
+	HardLimitBytes *int64
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type StorageUsageBreakdown struct {
+	Key       string
+	Name      string
+	UsedBytes int64
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+type TwoFactor struct {
+	UserID       string
+	Secret       string
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+type RecoveryCode struct {
+	UserID    string
+	CodeHash  string
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
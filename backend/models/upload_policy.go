@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type UploadPolicy struct {
+	DirectoryID       string
+	MaxFileSize       *int64
+	AllowedMimeTypes  pq.StringArray `gorm:"type:_text"`
+	AllowedExtensions pq.StringArray `gorm:"type:_text"`
+	MaxFiles          *int
+	// RequireApproval keeps versions which are not approved from being shared publicly.
+	RequireApproval *bool
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
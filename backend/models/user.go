@@ -3,11 +3,14 @@ package models
 import "time"
 
 type User struct {
-	UserID       string
-	Username     string
-	Email        string
-	PasswordHash string
-	Name         string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	UserID          string
+	Username        string
+	Email           string
+	PasswordHash    string
+	Name            string
+	Role            string
+	EmailVerifiedAt *time.Time
+	DisabledAt      *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
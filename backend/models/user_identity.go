@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+type UserIdentity struct {
+	Issuer    string
+	Subject   string
+	UserID    string
+	Email     string
+	CreatedAt time.Time
+}
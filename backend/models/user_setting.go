@@ -8,8 +8,10 @@ type UserSetting struct {
 	StorageVendor       string
 	StorageCredentials  *StorageCredentials  `gorm:"serializer:json"`
 	StorageInformations *StorageInformations `gorm:"serializer:json"`
-	CreatedAt           time.Time
-	UpdatedAt           time.Time
+	// NotificationPreferences is nil until the user first chooses them.
+	NotificationPreferences *NotificationPreferences `gorm:"serializer:json"`
+	CreatedAt               time.Time
+	UpdatedAt               time.Time
 }
 
 type StorageInformations struct {
@@ -21,3 +23,8 @@ type StorageCredentials struct {
 	AWSS3AccessKeyID     string
 	AWSS3SecretAccessKey string
 }
+
+type NotificationPreferences struct {
+	// EmailTypes are the notification types which are emailed as well.
+	EmailTypes []string
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+type UserToken struct {
+	TokenHash string
+	UserID    string
+	Purpose   string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// VersionReview asks a reviewer to approve a file version or to request changes to it.
+type VersionReview struct {
+	FileVersionID string
+	ReviewerID    string
+	RequestedBy   string
+	Decision      string
+	Comment       string
+	RequestedAt   time.Time
+	DecidedAt     *time.Time
+}
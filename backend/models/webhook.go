@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Webhook posts the events it subscribes to to URL, signed with Secret.
+type Webhook struct {
+	WebhookID   string
+	UserID      string
+	URL         string
+	Secret      string
+	Events      pq.StringArray `gorm:"type:_text"`
+	Description string
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// OutboxEvent is a change to announce to webhooks and to the event stream.
+type OutboxEvent struct {
+	EventID   int64 `gorm:"primaryKey"`
+	EventType string
+	ActorID   string
+	// OwnerID owns the item which changed; only their webhooks receive the event.
+	OwnerID      string
+	DirectoryID  string
+	Data         string
+	CreatedAt    time.Time
+	DispatchedAt *time.Time
+	// StreamPosition is set once the event is pushed to the event stream.
+	StreamPosition *int64
+}
+
+// WebhookDelivery is the payload of one event for one webhook along with how posting it
+// went so far.
+type WebhookDelivery struct {
+	WebhookDeliveryID string
+	WebhookID         string
+	EventType         string
+	Payload           string
+	Status            string
+	Attempts          int
+	NextAttemptAt     *time.Time
+	ResponseStatus    *int
+	ResponseBody      string
+	Error             string
+	CreatedAt         time.Time
+	UpdatedAt         time.Time
+}
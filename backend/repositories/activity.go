@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ActivityRepo struct {
+	db *gorm.DB
+}
+
+type ActivityRepoInterface interface {
+	ListActivities(ctx context.Context, params ListActivitiesParams) (*ActivitiesPage, error)
+}
+
+func NewActivityRepo(db *gorm.DB) ActivityRepoInterface {
+	return &ActivityRepo{db: db}
+}
+
+func CreateActivity(ctx context.Context, db *gorm.DB, activity *models.Activity) error {
+	return db.WithContext(ctx).Create(activity).Error
+}
+
+// ListActivitiesParams describes one page of the activity feed of an item, newest first.
+type ListActivitiesParams struct {
+	ItemID string
+	// IncludeChildren also lists what happened to the items which were directly in the
+	// item, a directory, at the time.
+	IncludeChildren bool
+	Limit           int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *ActivityCursor
+}
+
+// ActivityCursor points at the last activity of a page.
+type ActivityCursor struct {
+	CreatedAt  time.Time `json:"c"`
+	ActivityID string    `json:"id"`
+}
+
+type ActivitiesPage struct {
+	Activities []models.Activity
+	NextCursor *ActivityCursor
+}
+
+func ListActivities(ctx context.Context, db *gorm.DB, params ListActivitiesParams) (*ActivitiesPage, error) {
+	query := db.WithContext(ctx).Model(&models.Activity{})
+	if params.IncludeChildren {
+		query = query.Where("item_id = ? OR directory_id = ?", params.ItemID, params.ItemID)
+	} else {
+		query = query.Where("item_id = ?", params.ItemID)
+	}
+	if params.After != nil {
+		query = query.Where("(created_at, activity_id) < (?, ?)", params.After.CreatedAt, params.After.ActivityID)
+	}
+
+	activities := []models.Activity{}
+	err := query.
+		Order("created_at DESC, activity_id DESC").
+		Limit(params.Limit + 1).
+		Find(&activities).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &ActivitiesPage{Activities: activities}
+	if len(activities) > params.Limit {
+		page.Activities = activities[:params.Limit]
+		last := page.Activities[params.Limit-1]
+		page.NextCursor = &ActivityCursor{CreatedAt: last.CreatedAt, ActivityID: last.ActivityID}
+	}
+	return page, nil
+}
+
+func (r *ActivityRepo) ListActivities(ctx context.Context, params ListActivitiesParams) (*ActivitiesPage, error) {
+	return ListActivities(ctx, r.db, params)
+}
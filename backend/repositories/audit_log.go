@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateAuditLog appends entry to the audit log. Audit entries are never updated or
+// deleted.
+func CreateAuditLog(ctx context.Context, db *gorm.DB, entry *models.AuditLog) error {
+	return db.WithContext(ctx).Create(entry).Error
+}
+
+// ListAuditLogsParams describes one page of audit entries, newest first. Empty filters
+// match every entry.
+type ListAuditLogsParams struct {
+	ActorID    string
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *AuditLogCursor
+}
+
+// AuditLogCursor points at the last entry of a page.
+type AuditLogCursor struct {
+	CreatedAt  time.Time `json:"c"`
+	AuditLogID string    `json:"id"`
+}
+
+type AuditLogsPage struct {
+	AuditLogs  []models.AuditLog
+	NextCursor *AuditLogCursor
+}
+
+func ListAuditLogs(ctx context.Context, db *gorm.DB, params ListAuditLogsParams) (*AuditLogsPage, error) {
+	query := db.WithContext(ctx).Model(&models.AuditLog{})
+	if params.ActorID != "" {
+		query = query.Where("actor_id = ?", params.ActorID)
+	}
+	if params.Action != "" {
+		query = query.Where("action = ?", params.Action)
+	}
+	if params.TargetType != "" {
+		query = query.Where("target_type = ?", params.TargetType)
+	}
+	if params.TargetID != "" {
+		query = query.Where("target_id = ?", params.TargetID)
+	}
+	if params.Since != nil {
+		query = query.Where("created_at >= ?", *params.Since)
+	}
+	if params.Until != nil {
+		query = query.Where("created_at < ?", *params.Until)
+	}
+	if params.After != nil {
+		query = query.Where("(created_at, audit_log_id) < (?, ?)", params.After.CreatedAt, params.After.AuditLogID)
+	}
+
+	auditLogs := []models.AuditLog{}
+	err := query.
+		Order("created_at DESC, audit_log_id DESC").
+		Limit(params.Limit + 1).
+		Find(&auditLogs).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &AuditLogsPage{AuditLogs: auditLogs}
+	if len(auditLogs) > params.Limit {
+		page.AuditLogs = auditLogs[:params.Limit]
+		last := page.AuditLogs[params.Limit-1]
+		page.NextCursor = &AuditLogCursor{CreatedAt: last.CreatedAt, AuditLogID: last.AuditLogID}
+	}
+	return page, nil
+}
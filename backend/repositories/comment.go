@@ -0,0 +1,92 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type CommentRepo struct {
+	db *gorm.DB
+}
+
+type CommentRepoInterface interface {
+	GetCommentByID(ctx context.Context, commentID string, isForUpdate bool) (*models.Comment, error)
+	ListCommentsByFileID(ctx context.Context, fileID string) ([]models.Comment, error)
+	ListCommentMentions(ctx context.Context, commentIDs []string) ([]models.CommentMention, error)
+}
+
+func NewCommentRepo(db *gorm.DB) CommentRepoInterface {
+	return &CommentRepo{db: db}
+}
+
+func CreateComment(ctx context.Context, db *gorm.DB, comment *models.Comment) error {
+	return db.WithContext(ctx).Create(comment).Error
+}
+
+func UpdateComment(ctx context.Context, db *gorm.DB, comment *models.Comment) error {
+	return db.WithContext(ctx).Save(comment).Error
+}
+
+func GetCommentByID(ctx context.Context, db *gorm.DB, commentID string, isForUpdate bool) (*models.Comment, error) {
+	comment := &models.Comment{}
+	query := db.WithContext(ctx).Where("comment_id = ?", commentID)
+	if isForUpdate {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return comment, query.First(comment).Error
+}
+
+func (r *CommentRepo) GetCommentByID(ctx context.Context, commentID string, isForUpdate bool) (*models.Comment, error) {
+	return GetCommentByID(ctx, r.db, commentID, isForUpdate)
+}
+
+// ListCommentsByFileID returns every comment on a file, deleted ones included, oldest first.
+func ListCommentsByFileID(ctx context.Context, db *gorm.DB, fileID string) ([]models.Comment, error) {
+	comments := []models.Comment{}
+	err := db.
+		WithContext(ctx).
+		Where("file_id = ?", fileID).
+		Order("created_at, comment_id").
+		Find(&comments).
+		Error
+	return comments, err
+}
+
+func (r *CommentRepo) ListCommentsByFileID(ctx context.Context, fileID string) ([]models.Comment, error) {
+	return ListCommentsByFileID(ctx, r.db, fileID)
+}
+
+// ReplaceCommentMentions sets the users mentioned in a comment to userIDs.
+func ReplaceCommentMentions(ctx context.Context, db *gorm.DB, commentID string, userIDs []string) error {
+	if err := db.WithContext(ctx).Where("comment_id = ?", commentID).Delete(&models.CommentMention{}).Error; err != nil {
+		return err
+	}
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	mentions := make([]models.CommentMention, 0, len(userIDs))
+	for _, userID := range userIDs {
+		mentions = append(mentions, models.CommentMention{
+			CommentID: commentID,
+			UserID:    userID,
+		})
+	}
+	return db.WithContext(ctx).Create(&mentions).Error
+}
+
+func ListCommentMentions(ctx context.Context, db *gorm.DB, commentIDs []string) ([]models.CommentMention, error) {
+	mentions := []models.CommentMention{}
+	if len(commentIDs) == 0 {
+		return mentions, nil
+	}
+	err := db.WithContext(ctx).Where("comment_id IN ?", commentIDs).Find(&mentions).Error
+	return mentions, err
+}
+
+func (r *CommentRepo) ListCommentMentions(ctx context.Context, commentIDs []string) ([]models.CommentMention, error) {
+	return ListCommentMentions(ctx, r.db, commentIDs)
+}
@@ -2,9 +2,14 @@ package repositories
 
 import (
 	"context"
+	"dam/enums"
 	"dam/models"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type DirectoryRepoInterface interface {
@@ -12,8 +17,14 @@ type DirectoryRepoInterface interface {
 	UpdateDirectory(ctx context.Context, directory *models.Directory) error
 	GetDirectoryByID(ctx context.Context, directoryID string) (*models.Directory, error)
 	GetDirectoryByFullPath(ctx context.Context, fullPath string) (*models.Directory, error)
-	ListFilesOrFoldersByDirectoryID(ctx context.Context, directoryID string, orderBy string, limit, offset int) ([]models.FileOrFolder, error)
+	ListFilesOrFoldersByDirectoryID(ctx context.Context, params ListFilesOrFoldersParams) (*FilesOrFoldersPage, error)
 	MoveDirectory(ctx context.Context, sourceDirectory, destinationDirectory *models.Directory) error
+	ListChildrenByNamePrefix(ctx context.Context, directoryID, prefix string) ([]models.FileOrFolder, error)
+	ListChildrenByName(ctx context.Context, directoryID, name string) ([]models.FileOrFolder, error)
+	ListRootDirectoriesByUserID(ctx context.Context, userID string) ([]models.Directory, error)
+	ListDirectoriesByIDs(ctx context.Context, directoryIDs []string) ([]models.Directory, error)
+	ListDescendantDirectories(ctx context.Context, directory *models.Directory) ([]models.Directory, error)
+	GetDirectoryTree(ctx context.Context, directory *models.Directory, depth int) ([]models.DirectoryTreeNode, error)
 }
 
 type DirectoryRepo struct {
@@ -24,57 +35,379 @@ func NewDirectoryRepo(db *gorm.DB) DirectoryRepoInterface {
 	return &DirectoryRepo{db: db}
 }
 
+func CreateDirectory(ctx context.Context, db *gorm.DB, directory *models.Directory) error {
+	return db.WithContext(ctx).Create(directory).Error
+}
+
 func (r *DirectoryRepo) CreateDirectory(ctx context.Context, directory *models.Directory) error {
-	return r.db.Create(directory).WithContext(ctx).Error
+	return CreateDirectory(ctx, r.db, directory)
+}
+
+func UpdateDirectory(ctx context.Context, db *gorm.DB, directory *models.Directory) error {
+	return db.WithContext(ctx).Where("directory_id = ?", directory.DirectoryID).Save(directory).Error
 }
 
 func (r *DirectoryRepo) UpdateDirectory(ctx context.Context, directory *models.Directory) error {
-	return r.db.Where("directory_id = ?", directory.DirectoryID).Save(directory).WithContext(ctx).Error
+	return UpdateDirectory(ctx, r.db, directory)
 }
 
-func (r *DirectoryRepo) GetDirectoryByID(ctx context.Context, directoryID string) (*models.Directory, error) {
+func GetDirectoryByID(ctx context.Context, db *gorm.DB, directoryID string) (*models.Directory, error) {
 	directory := &models.Directory{}
-	err := r.db.Where("directory_id = ?", directoryID).First(directory).WithContext(ctx).Error
+	err := db.WithContext(ctx).Where("directory_id = ?", directoryID).First(directory).Error
 	return directory, err
 }
 
+func (r *DirectoryRepo) GetDirectoryByID(ctx context.Context, directoryID string) (*models.Directory, error) {
+	return GetDirectoryByID(ctx, r.db, directoryID)
+}
+
+// LockDirectory locks the row of a directory until the end of the transaction db is in.
+func LockDirectory(ctx context.Context, db *gorm.DB, directoryID string) error {
+	return db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("directory_id = ?", directoryID).
+		First(&models.Directory{}).
+		Error
+}
+
+// directoryTreeLockClass is the first key of the advisory locks which serialize the moves
+// in the directory tree of a user, the second being a hash of their ID.
+const directoryTreeLockClass = 1_618_033
+
+// LockDirectoryTree waits for the directory tree lock of a user and holds it until the end
+// of the transaction db is in, so that the directories a move reads, and checks for
+// cycles, cannot be moved by a concurrent one.
+func LockDirectoryTree(ctx context.Context, db *gorm.DB, userID string) error {
+	return db.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(?, hashtext(?))", directoryTreeLockClass, userID).Error
+}
+
 func (r *DirectoryRepo) GetDirectoryByFullPath(ctx context.Context, fullPath string) (*models.Directory, error) {
 	directory := &models.Directory{}
 	err := r.db.Where("full_path = ?", fullPath).First(directory).WithContext(ctx).Error
 	return directory, err
 }
 
-func (r *DirectoryRepo) ListFilesOrFoldersByDirectoryID(ctx context.Context, directoryID string, orderBy string, limit, offset int) ([]models.FileOrFolder, error) {
-	filesOrFolders := []models.FileOrFolder{}
-	err := r.db.
+// ListFilesOrFoldersParams describes one page of a directory listing.
+type ListFilesOrFoldersParams struct {
+	DirectoryID      string
+	SortKey          enums.SortKey
+	SortDirection    enums.SortDirection
+	DirectoriesFirst bool
+	// Extension keeps the files whose name ends with the extension, without the dot.
+	Extension string
+	// MimeType keeps the files of that MIME type, or of a whole family such as "image/*".
+	MimeType string
+	Tag      string
+	Limit    int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *FileOrFolderCursor
+}
+
+// FileOrFolderCursor points at the last item of a page, in the order of the listing. It
+// records the order it was made for, so that it is not applied to another one.
+type FileOrFolderCursor struct {
+	SortKey          enums.SortKey       `json:"k"`
+	SortDirection    enums.SortDirection `json:"o"`
+	DirectoriesFirst bool                `json:"f"`
+	IsDirectory      bool                `json:"d"`
+	SortValue        string              `json:"v"`
+	ID               string              `json:"id"`
+}
+
+// Matches reports whether the cursor was made for the order of params.
+func (c *FileOrFolderCursor) Matches(params *ListFilesOrFoldersParams) bool {
+	return c.SortKey == params.SortKey && c.SortDirection == params.SortDirection && c.DirectoriesFirst == params.DirectoriesFirst
+}
+
+type FilesOrFoldersPage struct {
+	Items      []models.FileOrFolder
+	NextCursor *FileOrFolderCursor
+	Total      int64
+}
+
+type sortColumn struct {
+	expression string
+	sqlType    string
+}
+
+// sortColumns whitelists what a listing can be ordered by; nothing from the request is
+// ever written into the query itself.
+var sortColumns = map[enums.SortKey]sortColumn{
+	enums.SortByName:      {expression: "LOWER(name)", sqlType: "TEXT"},
+	enums.SortBySize:      {expression: "size", sqlType: "BIGINT"},
+	enums.SortByCreatedAt: {expression: "created_at", sqlType: "TIMESTAMP"},
+	enums.SortByUpdatedAt: {expression: "updated_at", sqlType: "TIMESTAMP"},
+	enums.SortByType:      {expression: "type", sqlType: "TEXT"},
+}
+
+// IsSortKeySupported reports whether a listing can be ordered by key.
+func IsSortKeySupported(key enums.SortKey) bool {
+	_, ok := sortColumns[key]
+	return ok
+}
+
+const filesOrFoldersQuery = `
+	SELECT directory_id AS id, parent_directory_id, name, full_path, 0 AS size, 'directory' AS type, '' AS mime_type,
+		NULL::TEXT[] AS tags, '' AS latest_file_version_id, created_at, updated_at, true AS is_directory
+	FROM directories
+	WHERE parent_directory_id = ?
+	UNION ALL
+	SELECT file_id AS id, directory_id AS parent_directory_id, name, full_path, size, extension AS type, extension AS mime_type,
+		tags, latest_file_version_id, created_at, updated_at, false AS is_directory
+	FROM files
+	WHERE directory_id = ?
+`
+
+// ListFilesOrFoldersByDirectoryID returns one page of the files and directories directly
+// under params.DirectoryID, using keyset pagination on the sort key and the item ID.
+func ListFilesOrFoldersByDirectoryID(ctx context.Context, db *gorm.DB, params ListFilesOrFoldersParams) (*FilesOrFoldersPage, error) {
+	column, ok := sortColumns[params.SortKey]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort key %q", params.SortKey)
+	}
+
+	filters := []string{"true"}
+	filterArgs := []interface{}{params.DirectoryID, params.DirectoryID}
+	if params.Extension != "" {
+		filters = append(filters, "NOT is_directory AND name ILIKE ?")
+		filterArgs = append(filterArgs, "%."+escapeLike(strings.TrimPrefix(params.Extension, ".")))
+	}
+	if family, ok := strings.CutSuffix(params.MimeType, "/*"); ok {
+		filters = append(filters, "NOT is_directory AND mime_type ILIKE ?")
+		filterArgs = append(filterArgs, escapeLike(family)+"/%")
+	} else if params.MimeType != "" {
+		filters = append(filters, "NOT is_directory AND mime_type ILIKE ?")
+		filterArgs = append(filterArgs, escapeLike(params.MimeType))
+	}
+	if params.Tag != "" {
+		filters = append(filters, "? = ANY(tags)")
+		filterArgs = append(filterArgs, params.Tag)
+	}
+
+	page := &FilesOrFoldersPage{}
+	err := db.
 		WithContext(ctx).
-		Raw(`
-			SELECT id, parent_directory_id, name, full_path, created_at, updated_at, is_directory
-			FROM (
-				SELECT directory_id AS id, parent_directory_id, name, full_path, created_at, updated_at, true AS is_directory 
-				FROM directories
-				UNION
-				SELECT file_id AS id, directory_id, name, full_path, created_at, updated_at, false AS is_directory
-				FROM files
-			) AS files_or_folders
-			WHERE parent_directory_id = ?
-			ORDER BY ?
+		Raw("SELECT COUNT(*) FROM ("+filesOrFoldersQuery+") AS files_or_folders WHERE "+strings.Join(filters, " AND "), filterArgs...).
+		Scan(&page.Total).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if params.SortDirection == enums.SortDescending {
+		direction, comparison = "DESC", "<"
+	}
+
+	orderBy := fmt.Sprintf("%s %s, id %s", column.expression, direction, direction)
+	if params.DirectoriesFirst {
+		orderBy = "is_directory DESC, " + orderBy
+	}
+
+	args := append([]interface{}{}, filterArgs...)
+	if params.After != nil {
+		after := fmt.Sprintf("(%s, id) %s (CAST(? AS %s), ?)", column.expression, comparison, column.sqlType)
+		if params.DirectoriesFirst {
+			after = fmt.Sprintf("(is_directory < ? OR (is_directory = ? AND %s))", after)
+			args = append(args, params.After.IsDirectory, params.After.IsDirectory)
+		}
+		filters = append(filters, after)
+		args = append(args, params.After.SortValue, params.After.ID)
+	}
+	args = append(args, params.Limit+1)
+
+	page.Items = []models.FileOrFolder{}
+	err = db.
+		WithContext(ctx).
+		Raw(fmt.Sprintf(`
+			SELECT *, (%s)::TEXT AS sort_value
+			FROM (%s) AS files_or_folders
+			WHERE %s
+			ORDER BY %s
 			LIMIT ?
-			OFFSET ?
-		`, directoryID, orderBy, limit, offset).
-		Scan(&filesOrFolders).
+		`, column.expression, filesOrFoldersQuery, strings.Join(filters, " AND "), orderBy), args...).
+		Scan(&page.Items).
 		Error
+	if err != nil {
+		return nil, err
+	}
 
-	return filesOrFolders, err
+	if len(page.Items) > params.Limit {
+		page.Items = page.Items[:params.Limit]
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = &FileOrFolderCursor{
+			SortKey:          params.SortKey,
+			SortDirection:    params.SortDirection,
+			DirectoriesFirst: params.DirectoriesFirst,
+			IsDirectory:      last.IsDirectory,
+			SortValue:        last.SortValue,
+			ID:               last.ID,
+		}
+	}
+
+	return page, nil
 }
 
-func (r *DirectoryRepo) MoveDirectory(ctx context.Context, sourceDirectory, destinationDirectory *models.Directory) error {
-	return r.db.
+func (r *DirectoryRepo) ListFilesOrFoldersByDirectoryID(ctx context.Context, params ListFilesOrFoldersParams) (*FilesOrFoldersPage, error) {
+	return ListFilesOrFoldersByDirectoryID(ctx, r.db, params)
+}
+
+// MoveDirectoryDescendants rewrites the FullPath and Level of every directory below
+// sourceDirectory as if sourceDirectory was a child of destinationDirectory. sourceDirectory
+// must still hold its old FullPath and Level; the row itself is left to the caller.
+func MoveDirectoryDescendants(ctx context.Context, db *gorm.DB, sourceDirectory, destinationDirectory *models.Directory) error {
+	newFullPath := destinationDirectory.FullPath + "/" + sourceDirectory.DirectoryID
+	levelDelta := destinationDirectory.Level + 1 - sourceDirectory.Level
+	return db.
 		WithContext(ctx).
 		Exec(`
 			UPDATE directories
-			SET full_path = REPLACE(full_path, ?, ?)
+			SET full_path = ? || SUBSTRING(full_path FROM ?), level = level + ?
 			WHERE full_path LIKE ?
-		`, sourceDirectory.FullPath, destinationDirectory.FullPath+"/"+sourceDirectory.DirectoryID, sourceDirectory.FullPath+"%").
+		`, newFullPath, utf8.RuneCountInString(sourceDirectory.FullPath)+1, levelDelta, escapeLike(sourceDirectory.FullPath)+"/%").
 		Error
 }
+
+func (r *DirectoryRepo) MoveDirectory(ctx context.Context, sourceDirectory, destinationDirectory *models.Directory) error {
+	return MoveDirectoryDescendants(ctx, r.db, sourceDirectory, destinationDirectory)
+}
+
+// ListChildrenByNamePrefix returns the files and directories directly under directoryID
+// whose name starts with prefix, ignoring case.
+func ListChildrenByNamePrefix(ctx context.Context, db *gorm.DB, directoryID, prefix string) ([]models.FileOrFolder, error) {
+	filesOrFolders := []models.FileOrFolder{}
+	pattern := escapeLike(prefix) + "%"
+	err := db.
+		WithContext(ctx).
+		Raw(`
+			SELECT directory_id AS id, parent_directory_id, name, full_path, created_at, updated_at, true AS is_directory
+			FROM directories
+			WHERE parent_directory_id = ? AND name ILIKE ?
+			UNION ALL
+			SELECT file_id AS id, directory_id AS parent_directory_id, name, full_path, created_at, updated_at, false AS is_directory
+			FROM files
+			WHERE directory_id = ? AND name ILIKE ?
+		`, directoryID, pattern, directoryID, pattern).
+		Scan(&filesOrFolders).
+		Error
+
+	return filesOrFolders, err
+}
+
+func (r *DirectoryRepo) ListChildrenByNamePrefix(ctx context.Context, directoryID, prefix string) ([]models.FileOrFolder, error) {
+	return ListChildrenByNamePrefix(ctx, r.db, directoryID, prefix)
+}
+
+// ListChildrenByName returns the files and directories directly under directoryID named
+// name, ignoring case. Callers narrow the result down when names are case-sensitive.
+func ListChildrenByName(ctx context.Context, db *gorm.DB, directoryID, name string) ([]models.FileOrFolder, error) {
+	filesOrFolders := []models.FileOrFolder{}
+	err := db.
+		WithContext(ctx).
+		Raw(`
+			SELECT directory_id AS id, parent_directory_id, name, full_path, created_at, updated_at, true AS is_directory
+			FROM directories
+			WHERE parent_directory_id = ? AND LOWER(name) = LOWER(?)
+			UNION ALL
+			SELECT file_id AS id, directory_id AS parent_directory_id, name, full_path, created_at, updated_at, false AS is_directory
+			FROM files
+			WHERE directory_id = ? AND LOWER(name) = LOWER(?)
+		`, directoryID, name, directoryID, name).
+		Scan(&filesOrFolders).
+		Error
+
+	return filesOrFolders, err
+}
+
+func (r *DirectoryRepo) ListChildrenByName(ctx context.Context, directoryID, name string) ([]models.FileOrFolder, error) {
+	return ListChildrenByName(ctx, r.db, directoryID, name)
+}
+
+// ListRootDirectoriesByUserID returns the directories of userID which have no parent.
+func ListRootDirectoriesByUserID(ctx context.Context, db *gorm.DB, userID string) ([]models.Directory, error) {
+	directories := []models.Directory{}
+	err := db.
+		WithContext(ctx).
+		Where("user_id = ? AND (parent_directory_id IS NULL OR parent_directory_id = '')", userID).
+		Find(&directories).
+		Error
+	return directories, err
+}
+
+func (r *DirectoryRepo) ListRootDirectoriesByUserID(ctx context.Context, userID string) ([]models.Directory, error) {
+	return ListRootDirectoriesByUserID(ctx, r.db, userID)
+}
+
+func ListDirectoriesByIDs(ctx context.Context, db *gorm.DB, directoryIDs []string) ([]models.Directory, error) {
+	directories := []models.Directory{}
+	if len(directoryIDs) == 0 {
+		return directories, nil
+	}
+	err := db.WithContext(ctx).Where("directory_id IN ?", directoryIDs).Find(&directories).Error
+	return directories, err
+}
+
+func (r *DirectoryRepo) ListDirectoriesByIDs(ctx context.Context, directoryIDs []string) ([]models.Directory, error) {
+	return ListDirectoriesByIDs(ctx, r.db, directoryIDs)
+}
+
+// ListDescendantDirectories returns every directory below directory, parents before children.
+func ListDescendantDirectories(ctx context.Context, db *gorm.DB, directory *models.Directory) ([]models.Directory, error) {
+	directories := []models.Directory{}
+	err := db.
+		WithContext(ctx).
+		Where("full_path LIKE ?", escapeLike(directory.FullPath)+"/%").
+		Order("level").
+		Find(&directories).
+		Error
+	return directories, err
+}
+
+func (r *DirectoryRepo) ListDescendantDirectories(ctx context.Context, directory *models.Directory) ([]models.Directory, error) {
+	return ListDescendantDirectories(ctx, r.db, directory)
+}
+
+// GetDirectoryTree returns directory and its descendants down to depth levels below it,
+// ordered by level then name. FileCount and TotalSize of every node cover all the files
+// in its subtree, including those deeper than depth. Directories and files of other users
+// than the owner of directory are left out.
+func GetDirectoryTree(ctx context.Context, db *gorm.DB, directory *models.Directory, depth int) ([]models.DirectoryTreeNode, error) {
+	nodes := []models.DirectoryTreeNode{}
+	err := db.
+		WithContext(ctx).
+		Raw(`
+			SELECT d.directory_id, d.name, d.full_path, d.level, d.parent_directory_id, d.created_at, d.updated_at,
+				COUNT(f.file_id) AS file_count, COALESCE(SUM(f.size), 0) AS total_size
+			FROM directories AS d
+			LEFT JOIN files AS f ON f.full_path LIKE d.full_path || '/%' AND f.user_id = d.user_id
+			WHERE (d.directory_id = ? OR d.full_path LIKE ?) AND d.level <= ? AND d.user_id = ?
+			GROUP BY d.directory_id
+			ORDER BY d.level, d.name
+		`, directory.DirectoryID, escapeLike(directory.FullPath)+"/%", directory.Level+depth, directory.UserID).
+		Scan(&nodes).
+		Error
+
+	return nodes, err
+}
+
+func (r *DirectoryRepo) GetDirectoryTree(ctx context.Context, directory *models.Directory, depth int) ([]models.DirectoryTreeNode, error) {
+	return GetDirectoryTree(ctx, r.db, directory, depth)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// EnsureCaseInsensitiveNameIndexes adds unique indexes on the lowercased names of the items
+// of a directory, so that concurrent requests cannot create "A.txt" and "a.txt" side by
+// side when names are case-insensitive. They are not part of the migrations as names are
+// case-sensitive by default. It fails while such names exist.
+func EnsureCaseInsensitiveNameIndexes(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS directories_parent_directory_id_lower_name_idx ON directories (parent_directory_id, LOWER(name))").Error; err != nil {
+			return err
+		}
+		return tx.Exec("CREATE UNIQUE INDEX IF NOT EXISTS files_directory_id_lower_name_idx ON files (directory_id, LOWER(name))").Error
+	})
+}
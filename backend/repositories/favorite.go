@@ -0,0 +1,38 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type FavoriteRepo struct {
+	db *gorm.DB
+}
+
+type FavoriteRepoInterface interface {
+	AddFavorite(ctx context.Context, favorite *models.Favorite) error
+	RemoveFavorite(ctx context.Context, userID, itemID string) error
+	ListFavoritesByUserID(ctx context.Context, userID string) ([]models.Favorite, error)
+}
+
+func NewFavoriteRepo(db *gorm.DB) FavoriteRepoInterface {
+	return &FavoriteRepo{db: db}
+}
+
+// AddFavorite stars an item; starring it again is a no-op.
+func (r *FavoriteRepo) AddFavorite(ctx context.Context, favorite *models.Favorite) error {
+	return r.db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(favorite).Error
+}
+
+func (r *FavoriteRepo) RemoveFavorite(ctx context.Context, userID, itemID string) error {
+	return r.db.WithContext(ctx).Where("user_id = ? AND item_id = ?", userID, itemID).Delete(&models.Favorite{}).Error
+}
+
+func (r *FavoriteRepo) ListFavoritesByUserID(ctx context.Context, userID string) ([]models.Favorite, error) {
+	favorites := []models.Favorite{}
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at DESC").Find(&favorites).Error
+	return favorites, err
+}
@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"dam/models"
+	"unicode/utf8"
 
 	"gorm.io/gorm"
 )
@@ -16,33 +17,92 @@ type FileRepoInterface interface {
 	UpdateFile(ctx context.Context, file *models.File) error
 	GetFileByID(ctx context.Context, fileID string) (*models.File, error)
 	MoveDirectory(ctx context.Context, sourceDirectory, destinationDirectory *models.Directory) error
+	ListFilesByDirectoryIDs(ctx context.Context, directoryIDs []string) ([]models.File, error)
+	CountFilesByDirectoryID(ctx context.Context, directoryID string) (int64, error)
+	ListFilesByIDs(ctx context.Context, fileIDs []string) ([]models.File, error)
 }
 
 func NewFileRepo(db *gorm.DB) FileRepoInterface {
 	return &FileRepo{db: db}
 }
 
+func CreateFile(ctx context.Context, db *gorm.DB, file *models.File) error {
+	return db.WithContext(ctx).Create(file).Error
+}
+
 func (r *FileRepo) CreateFile(ctx context.Context, file *models.File) error {
-	return r.db.Create(file).WithContext(ctx).Error
+	return CreateFile(ctx, r.db, file)
+}
+
+func UpdateFile(ctx context.Context, db *gorm.DB, file *models.File) error {
+	return db.WithContext(ctx).Where("file_id = ?", file.FileID).Save(file).Error
 }
 
 func (r *FileRepo) UpdateFile(ctx context.Context, file *models.File) error {
-	return r.db.Where("file_id = ?", file.FileID).Save(file).WithContext(ctx).Error
+	return UpdateFile(ctx, r.db, file)
 }
 
-func (r *FileRepo) GetFileByID(ctx context.Context, fileID string) (*models.File, error) {
+func GetFileByID(ctx context.Context, db *gorm.DB, fileID string) (*models.File, error) {
 	file := &models.File{}
-	err := r.db.Where("file_id = ?", fileID).WithContext(ctx).First(file).Error
+	err := db.WithContext(ctx).Where("file_id = ?", fileID).First(file).Error
 	return file, err
 }
 
-func (r *FileRepo) MoveDirectory(ctx context.Context, sourceDirectory, destinationDirectory *models.Directory) error {
-	return r.db.
+func (r *FileRepo) GetFileByID(ctx context.Context, fileID string) (*models.File, error) {
+	return GetFileByID(ctx, r.db, fileID)
+}
+
+// MoveDirectoryFiles rewrites the FullPath of every file below sourceDirectory as if
+// sourceDirectory was a child of destinationDirectory. sourceDirectory must still hold its
+// old FullPath.
+func MoveDirectoryFiles(ctx context.Context, db *gorm.DB, sourceDirectory, destinationDirectory *models.Directory) error {
+	newFullPath := destinationDirectory.FullPath + "/" + sourceDirectory.DirectoryID
+	return db.
 		WithContext(ctx).
 		Exec(`
-			UPDATE directories
-			SET full_path = REPLACE(full_path, ?, ?)
+			UPDATE files
+			SET full_path = ? || SUBSTRING(full_path FROM ?)
 			WHERE full_path LIKE ?
-		`, sourceDirectory.FullPath, destinationDirectory.FullPath+"/"+sourceDirectory.DirectoryID, sourceDirectory.FullPath+"%").
+		`, newFullPath, utf8.RuneCountInString(sourceDirectory.FullPath)+1, escapeLike(sourceDirectory.FullPath)+"/%").
 		Error
 }
+
+func (r *FileRepo) MoveDirectory(ctx context.Context, sourceDirectory, destinationDirectory *models.Directory) error {
+	return MoveDirectoryFiles(ctx, r.db, sourceDirectory, destinationDirectory)
+}
+
+func ListFilesByDirectoryIDs(ctx context.Context, db *gorm.DB, directoryIDs []string) ([]models.File, error) {
+	files := []models.File{}
+	if len(directoryIDs) == 0 {
+		return files, nil
+	}
+	err := db.WithContext(ctx).Where("directory_id IN ?", directoryIDs).Find(&files).Error
+	return files, err
+}
+
+func (r *FileRepo) ListFilesByDirectoryIDs(ctx context.Context, directoryIDs []string) ([]models.File, error) {
+	return ListFilesByDirectoryIDs(ctx, r.db, directoryIDs)
+}
+
+func CountFilesByDirectoryID(ctx context.Context, db *gorm.DB, directoryID string) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&models.File{}).Where("directory_id = ?", directoryID).Count(&count).Error
+	return count, err
+}
+
+func (r *FileRepo) CountFilesByDirectoryID(ctx context.Context, directoryID string) (int64, error) {
+	return CountFilesByDirectoryID(ctx, r.db, directoryID)
+}
+
+func ListFilesByIDs(ctx context.Context, db *gorm.DB, fileIDs []string) ([]models.File, error) {
+	files := []models.File{}
+	if len(fileIDs) == 0 {
+		return files, nil
+	}
+	err := db.WithContext(ctx).Where("file_id IN ?", fileIDs).Find(&files).Error
+	return files, err
+}
+
+func (r *FileRepo) ListFilesByIDs(ctx context.Context, fileIDs []string) ([]models.File, error) {
+	return ListFilesByIDs(ctx, r.db, fileIDs)
+}
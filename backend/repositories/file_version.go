@@ -3,8 +3,10 @@ package repositories
 import (
 	"context"
 	"dam/models"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type FileVersionRepo struct {
@@ -14,6 +16,7 @@ type FileVersionRepo struct {
 type FileVersionRepoInterface interface {
 	CreateFileVersion(ctx context.Context, fileVersion *models.FileVersion) error
 	ListFileVersions(ctx context.Context, fileID string) ([]models.FileVersion, error)
+	GetFileVersionByID(ctx context.Context, fileVersionID string) (*models.FileVersion, error)
 }
 
 func NewFileVersionRepo(db *gorm.DB) FileVersionRepoInterface {
@@ -22,12 +25,65 @@ func NewFileVersionRepo(db *gorm.DB) FileVersionRepoInterface {
 	}
 }
 
+func CreateFileVersion(ctx context.Context, db *gorm.DB, fileVersion *models.FileVersion) error {
+	return db.WithContext(ctx).Create(fileVersion).Error
+}
+
 func (r *FileVersionRepo) CreateFileVersion(ctx context.Context, fileVersion *models.FileVersion) error {
-	return r.db.Create(fileVersion).WithContext(ctx).Error
+	return CreateFileVersion(ctx, r.db, fileVersion)
+}
+
+// ListFileVersions returns the versions of fileID, oldest first.
+func ListFileVersions(ctx context.Context, db *gorm.DB, fileID string) ([]models.FileVersion, error) {
+	fileVersions := []models.FileVersion{}
+	err := db.WithContext(ctx).Where("file_id = ?", fileID).Order("created_at").Find(&fileVersions).Error
+	return fileVersions, err
 }
 
 func (r *FileVersionRepo) ListFileVersions(ctx context.Context, fileID string) ([]models.FileVersion, error) {
+	return ListFileVersions(ctx, r.db, fileID)
+}
+
+func GetFileVersionByID(ctx context.Context, db *gorm.DB, fileVersionID string) (*models.FileVersion, error) {
+	fileVersion := &models.FileVersion{}
+	err := db.WithContext(ctx).Where("file_version_id = ?", fileVersionID).First(fileVersion).Error
+	return fileVersion, err
+}
+
+func (r *FileVersionRepo) GetFileVersionByID(ctx context.Context, fileVersionID string) (*models.FileVersion, error) {
+	return GetFileVersionByID(ctx, r.db, fileVersionID)
+}
+
+// GetFileVersionForUpdate reads a file version and locks it until the end of the
+// transaction db is in.
+func GetFileVersionForUpdate(ctx context.Context, db *gorm.DB, fileVersionID string) (*models.FileVersion, error) {
+	fileVersion := &models.FileVersion{}
+	err := db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("file_version_id = ?", fileVersionID).
+		First(fileVersion).
+		Error
+	return fileVersion, err
+}
+
+func UpdateFileVersionReviewStatus(ctx context.Context, db *gorm.DB, fileVersionID string, reviewStatus string, updatedAt time.Time) error {
+	return db.
+		WithContext(ctx).
+		Model(&models.FileVersion{}).
+		Where("file_version_id = ?", fileVersionID).
+		Updates(map[string]interface{}{
+			"review_status": reviewStatus,
+			"updated_at":    updatedAt,
+		}).
+		Error
+}
+
+func ListFileVersionsByIDs(ctx context.Context, db *gorm.DB, fileVersionIDs []string) ([]models.FileVersion, error) {
 	fileVersions := []models.FileVersion{}
-	err := r.db.Where("file_id = ?", fileID).Find(&fileVersions).WithContext(ctx).Error
+	if len(fileVersionIDs) == 0 {
+		return fileVersions, nil
+	}
+	err := db.WithContext(ctx).Where("file_version_id IN ?", fileVersionIDs).Find(&fileVersions).Error
 	return fileVersions, err
 }
@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type NotificationRepo struct {
+	db *gorm.DB
+}
+
+type NotificationRepoInterface interface {
+	ListNotifications(ctx context.Context, params ListNotificationsParams) (*NotificationsPage, error)
+	CountUnreadNotifications(ctx context.Context, userID string) (int64, error)
+}
+
+func NewNotificationRepo(db *gorm.DB) NotificationRepoInterface {
+	return &NotificationRepo{db: db}
+}
+
+func CreateNotifications(ctx context.Context, db *gorm.DB, notifications []models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Create(&notifications).Error
+}
+
+// ListNotificationsParams describes one page of the notifications of a user, newest first.
+type ListNotificationsParams struct {
+	UserID string
+	// UnreadOnly leaves out the notifications already read.
+	UnreadOnly bool
+	Limit      int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *NotificationCursor
+}
+
+// NotificationCursor points at the last notification of a page.
+type NotificationCursor struct {
+	CreatedAt      time.Time `json:"c"`
+	NotificationID string    `json:"id"`
+}
+
+type NotificationsPage struct {
+	Notifications []models.Notification
+	NextCursor    *NotificationCursor
+}
+
+func ListNotifications(ctx context.Context, db *gorm.DB, params ListNotificationsParams) (*NotificationsPage, error) {
+	query := db.WithContext(ctx).Model(&models.Notification{}).Where("user_id = ?", params.UserID)
+	if params.UnreadOnly {
+		query = query.Where("read_at IS NULL")
+	}
+	if params.After != nil {
+		query = query.Where("(created_at, notification_id) < (?, ?)", params.After.CreatedAt, params.After.NotificationID)
+	}
+
+	notifications := []models.Notification{}
+	err := query.
+		Order("created_at DESC, notification_id DESC").
+		Limit(params.Limit + 1).
+		Find(&notifications).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &NotificationsPage{Notifications: notifications}
+	if len(notifications) > params.Limit {
+		page.Notifications = notifications[:params.Limit]
+		last := page.Notifications[params.Limit-1]
+		page.NextCursor = &NotificationCursor{CreatedAt: last.CreatedAt, NotificationID: last.NotificationID}
+	}
+	return page, nil
+}
+
+func (r *NotificationRepo) ListNotifications(ctx context.Context, params ListNotificationsParams) (*NotificationsPage, error) {
+	return ListNotifications(ctx, r.db, params)
+}
+
+func CountUnreadNotifications(ctx context.Context, db *gorm.DB, userID string) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).
+		Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Count(&count).
+		Error
+	return count, err
+}
+
+func (r *NotificationRepo) CountUnreadNotifications(ctx context.Context, userID string) (int64, error) {
+	return CountUnreadNotifications(ctx, r.db, userID)
+}
+
+// MarkNotificationRead marks a notification of the user read at readAt, unless it was read
+// already, and returns it.
+func MarkNotificationRead(ctx context.Context, db *gorm.DB, userID, notificationID string, readAt time.Time) (*models.Notification, error) {
+	notification := &models.Notification{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ? AND notification_id = ?", userID, notificationID).
+			First(notification).
+			Error
+		if err != nil || notification.ReadAt != nil {
+			return err
+		}
+
+		notification.ReadAt = &readAt
+		return tx.
+			Model(&models.Notification{}).
+			Where("notification_id = ?", notificationID).
+			Update("read_at", readAt).
+			Error
+	})
+	return notification, err
+}
+
+// MarkNotificationsRead marks the unread notifications of the user read at readAt, only
+// those with the given IDs unless notificationIDs is nil, and returns how many it marked.
+func MarkNotificationsRead(ctx context.Context, db *gorm.DB, userID string, notificationIDs []string, readAt time.Time) (int64, error) {
+	query := db.WithContext(ctx).Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if notificationIDs != nil {
+		query = query.Where("notification_id IN ?", notificationIDs)
+	}
+	result := query.Update("read_at", readAt)
+	return result.RowsAffected, result.Error
+}
+
+// ClaimPendingNotificationEmails returns up to limit notifications yet to be emailed,
+// oldest first, and clears their flag so that no other instance emails them too. An email
+// which then fails to go out is not retried.
+func ClaimPendingNotificationEmails(ctx context.Context, db *gorm.DB, limit int) ([]models.Notification, error) {
+	notifications := []models.Notification{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("email_pending").
+			Order("created_at").
+			Limit(limit).
+			Find(&notifications).
+			Error
+		if err != nil || len(notifications) == 0 {
+			return err
+		}
+
+		notificationIDs := make([]string, 0, len(notifications))
+		for i := range notifications {
+			notificationIDs = append(notificationIDs, notifications[i].NotificationID)
+			notifications[i].EmailPending = false
+		}
+		return tx.
+			Model(&models.Notification{}).
+			Where("notification_id IN ?", notificationIDs).
+			Update("email_pending", false).
+			Error
+	})
+	return notifications, err
+}
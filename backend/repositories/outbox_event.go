@@ -0,0 +1,108 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateOutboxEvent records a change to announce. db must be the transaction making the
+// change.
+func CreateOutboxEvent(ctx context.Context, db *gorm.DB, event *models.OutboxEvent) error {
+	return db.WithContext(ctx).Create(event).Error
+}
+
+// LockUndispatchedOutboxEvents returns up to limit events which were not dispatched yet,
+// oldest first, and locks them until the end of the transaction db is in. Events locked by
+// another instance are skipped.
+func LockUndispatchedOutboxEvents(ctx context.Context, db *gorm.DB, limit int) ([]models.OutboxEvent, error) {
+	events := []models.OutboxEvent{}
+	err := db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("dispatched_at IS NULL").
+		Order("event_id").
+		Limit(limit).
+		Find(&events).
+		Error
+	return events, err
+}
+
+func MarkOutboxEventsDispatched(ctx context.Context, db *gorm.DB, eventIDs []int64, dispatchedAt time.Time) error {
+	if len(eventIDs) == 0 {
+		return nil
+	}
+	return db.
+		WithContext(ctx).
+		Model(&models.OutboxEvent{}).
+		Where("event_id IN ?", eventIDs).
+		Update("dispatched_at", dispatchedAt).
+		Error
+}
+
+// eventPublishingLockKey identifies the advisory lock which lets a single instance publish
+// events at a time, so that stream positions are handed out in publishing order.
+const eventPublishingLockKey = 4_815_162_342
+
+// TryLockEventPublishing takes the event publishing lock for the session of db, which must
+// be a single connection, and reports whether it was free. It is held across transactions
+// until UnlockEventPublishing or the connection closes.
+func TryLockEventPublishing(ctx context.Context, db *gorm.DB) (bool, error) {
+	var locked bool
+	err := db.WithContext(ctx).Raw("SELECT pg_try_advisory_lock(?)", eventPublishingLockKey).Scan(&locked).Error
+	return locked, err
+}
+
+// UnlockEventPublishing releases the event publishing lock taken by TryLockEventPublishing
+// on the same connection.
+func UnlockEventPublishing(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Exec("SELECT pg_advisory_unlock(?)", eventPublishingLockKey).Error
+}
+
+// ListUnpublishedOutboxEvents returns up to limit events which were not pushed to the
+// event stream yet, oldest first.
+func ListUnpublishedOutboxEvents(ctx context.Context, db *gorm.DB, limit int) ([]models.OutboxEvent, error) {
+	events := []models.OutboxEvent{}
+	err := db.
+		WithContext(ctx).
+		Where("stream_position IS NULL").
+		Order("event_id").
+		Limit(limit).
+		Find(&events).
+		Error
+	return events, err
+}
+
+// SetOutboxEventStreamPosition gives an event the next stream position. Positions taken
+// by a transaction which rolls back are skipped, never reused.
+func SetOutboxEventStreamPosition(ctx context.Context, db *gorm.DB, event *models.OutboxEvent) error {
+	var position int64
+	err := db.WithContext(ctx).Raw("SELECT nextval('outbox_events_stream_position_seq')").Scan(&position).Error
+	if err != nil {
+		return err
+	}
+	event.StreamPosition = &position
+	return db.
+		WithContext(ctx).
+		Model(&models.OutboxEvent{}).
+		Where("event_id = ?", event.EventID).
+		Update("stream_position", position).
+		Error
+}
+
+// ListOutboxEventsAfter returns up to limit events pushed to the event stream after
+// position, in stream order.
+func ListOutboxEventsAfter(ctx context.Context, db *gorm.DB, position int64, limit int) ([]models.OutboxEvent, error) {
+	events := []models.OutboxEvent{}
+	err := db.
+		WithContext(ctx).
+		Where("stream_position > ?", position).
+		Order("stream_position").
+		Limit(limit).
+		Find(&events).
+		Error
+	return events, err
+}
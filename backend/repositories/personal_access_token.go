@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PersonalAccessTokenRepo struct {
+	db *gorm.DB
+}
+
+type PersonalAccessTokenRepoInterface interface {
+	CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error
+	GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error)
+	ListPersonalAccessTokensByUserID(ctx context.Context, userID string) ([]models.PersonalAccessToken, error)
+	RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) (bool, error)
+	TouchPersonalAccessToken(ctx context.Context, tokenID string, usedAt time.Time) error
+}
+
+func NewPersonalAccessTokenRepo(db *gorm.DB) PersonalAccessTokenRepoInterface {
+	return &PersonalAccessTokenRepo{db: db}
+}
+
+func CreatePersonalAccessToken(ctx context.Context, db *gorm.DB, token *models.PersonalAccessToken) error {
+	return db.WithContext(ctx).Create(token).Error
+}
+
+func (r *PersonalAccessTokenRepo) CreatePersonalAccessToken(ctx context.Context, token *models.PersonalAccessToken) error {
+	return CreatePersonalAccessToken(ctx, r.db, token)
+}
+
+func (r *PersonalAccessTokenRepo) GetPersonalAccessTokenByHash(ctx context.Context, tokenHash string) (*models.PersonalAccessToken, error) {
+	token := &models.PersonalAccessToken{}
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(token).Error
+	return token, err
+}
+
+// ListPersonalAccessTokensByUserID returns the tokens of userID which were not revoked,
+// newest first. Expired tokens are kept so that users can see why a script stopped working.
+func (r *PersonalAccessTokenRepo) ListPersonalAccessTokensByUserID(ctx context.Context, userID string) ([]models.PersonalAccessToken, error) {
+	tokens := []models.PersonalAccessToken{}
+	err := r.db.
+		WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at DESC").
+		Find(&tokens).
+		Error
+	return tokens, err
+}
+
+// RevokePersonalAccessToken reports whether an active token of userID was revoked.
+func RevokePersonalAccessToken(ctx context.Context, db *gorm.DB, userID, tokenID string) (bool, error) {
+	result := db.
+		WithContext(ctx).
+		Model(&models.PersonalAccessToken{}).
+		Where("personal_access_token_id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *PersonalAccessTokenRepo) RevokePersonalAccessToken(ctx context.Context, userID, tokenID string) (bool, error) {
+	return RevokePersonalAccessToken(ctx, r.db, userID, tokenID)
+}
+
+// TouchPersonalAccessToken records that a token was used. It writes at most once a minute
+// per token so that busy scripts do not turn every request into a write.
+func (r *PersonalAccessTokenRepo) TouchPersonalAccessToken(ctx context.Context, tokenID string, usedAt time.Time) error {
+	return r.db.
+		WithContext(ctx).
+		Model(&models.PersonalAccessToken{}).
+		Where("personal_access_token_id = ? AND (last_used_at IS NULL OR last_used_at < ?)", tokenID, usedAt.Add(-time.Minute)).
+		Update("last_used_at", usedAt).
+		Error
+}
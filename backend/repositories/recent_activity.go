@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RecentActivityRepo struct {
+	db *gorm.DB
+}
+
+type RecentActivityRepoInterface interface {
+	SaveRecentActivity(ctx context.Context, recentActivity *models.RecentActivity) error
+	ListRecentActivitiesByUserID(ctx context.Context, userID string, limit int) ([]models.RecentActivity, error)
+}
+
+func NewRecentActivityRepo(db *gorm.DB) RecentActivityRepoInterface {
+	return &RecentActivityRepo{db: db}
+}
+
+// SaveRecentActivity keeps only the latest action of a user on a file.
+func (r *RecentActivityRepo) SaveRecentActivity(ctx context.Context, recentActivity *models.RecentActivity) error {
+	return r.db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}, {Name: "file_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"action", "accessed_at"}),
+		}).
+		Create(recentActivity).
+		Error
+}
+
+func (r *RecentActivityRepo) ListRecentActivitiesByUserID(ctx context.Context, userID string, limit int) ([]models.RecentActivity, error) {
+	recentActivities := []models.RecentActivity{}
+	err := r.db.
+		WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("accessed_at DESC").
+		Limit(limit).
+		Find(&recentActivities).
+		Error
+	return recentActivities, err
+}
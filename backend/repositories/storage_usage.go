@@ -0,0 +1,190 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type StorageUsageRepo struct {
+	db *gorm.DB
+}
+
+type StorageUsageRepoInterface interface {
+	GetStorageUsageByUserID(ctx context.Context, userID string, isForUpdate bool) (*models.StorageUsage, error)
+	AddStorageUsage(ctx context.Context, userID string, delta int64) error
+	GetTotalStorageUsage(ctx context.Context) (int64, error)
+	ListStorageUsageByTopLevelDirectory(ctx context.Context, userID string) ([]models.StorageUsageBreakdown, error)
+	ListStorageUsageByMimeFamily(ctx context.Context, userID string) ([]models.StorageUsageBreakdown, error)
+}
+
+func NewStorageUsageRepo(db *gorm.DB) StorageUsageRepoInterface {
+	return &StorageUsageRepo{db: db}
+}
+
+// GetStorageUsageByUserID returns the usage row of userID, creating an empty one for users
+// who never stored anything so that it can always be locked.
+func GetStorageUsageByUserID(ctx context.Context, db *gorm.DB, userID string, isForUpdate bool) (*models.StorageUsage, error) {
+	err := db.
+		WithContext(ctx).
+		Exec(`INSERT INTO storage_usages (user_id) VALUES (?) ON CONFLICT (user_id) DO NOTHING`, userID).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	usage := &models.StorageUsage{}
+	query := db.WithContext(ctx).Where("user_id = ?", userID)
+	if isForUpdate {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return usage, query.First(usage).Error
+}
+
+func (r *StorageUsageRepo) GetStorageUsageByUserID(ctx context.Context, userID string, isForUpdate bool) (*models.StorageUsage, error) {
+	return GetStorageUsageByUserID(ctx, r.db, userID, isForUpdate)
+}
+
+// AddStorageUsage adds delta bytes, which may be negative, to the usage of userID.
+func AddStorageUsage(ctx context.Context, db *gorm.DB, userID string, delta int64) error {
+	return db.
+		WithContext(ctx).
+		Exec(`
+			INSERT INTO storage_usages (user_id, used_bytes) VALUES (?, GREATEST(?, 0))
+			ON CONFLICT (user_id) DO UPDATE
+			SET used_bytes = GREATEST(storage_usages.used_bytes + ?, 0), updated_at = NOW()
+		`, userID, delta, delta).
+		Error
+}
+
+func (r *StorageUsageRepo) AddStorageUsage(ctx context.Context, userID string, delta int64) error {
+	return AddStorageUsage(ctx, r.db, userID, delta)
+}
+
+// ResetStorageUsage puts userID back on the default limits and recounts the bytes they use
+// from their file versions, fixing any drift of the running total.
+func ResetStorageUsage(ctx context.Context, db *gorm.DB, userID string) error {
+	if _, err := GetStorageUsageByUserID(ctx, db, userID, true); err != nil {
+		return err
+	}
+
+	return db.
+		WithContext(ctx).
+		Exec(`
+			UPDATE storage_usages
+			SET soft_limit_bytes = NULL, hard_limit_bytes = NULL, updated_at = NOW(),
+				used_bytes = (
+					SELECT COALESCE(SUM(file_versions.size), 0)
+					FROM file_versions
+					JOIN files ON files.file_id = file_versions.file_id
+					WHERE files.user_id = ?
+				)
+			WHERE user_id = ?
+		`, userID, userID).
+		Error
+}
+
+// SetStorageLimits sets the soft and hard limit of userID in bytes, nil putting them back
+// on the configured defaults.
+func SetStorageLimits(ctx context.Context, db *gorm.DB, userID string, softLimitBytes, hardLimitBytes *int64) error {
+	if _, err := GetStorageUsageByUserID(ctx, db, userID, true); err != nil {
+		return err
+	}
+
+	return db.
+		WithContext(ctx).
+		Exec(`
+			UPDATE storage_usages
+			SET soft_limit_bytes = ?, hard_limit_bytes = ?, updated_at = NOW()
+			WHERE user_id = ?
+		`, softLimitBytes, hardLimitBytes, userID).
+		Error
+}
+
+// workspaceStorageLockKey identifies the advisory lock which serializes the charges checked
+// against the workspace limit.
+const workspaceStorageLockKey = 2_718_281_828
+
+// LockWorkspaceStorage waits for the workspace storage lock and holds it until the end of
+// the transaction db is in, so that concurrent charges by different users cannot all pass
+// the workspace limit on the same total.
+func LockWorkspaceStorage(ctx context.Context, db *gorm.DB) error {
+	return db.WithContext(ctx).Exec("SELECT pg_advisory_xact_lock(?)", workspaceStorageLockKey).Error
+}
+
+func GetTotalStorageUsage(ctx context.Context, db *gorm.DB) (int64, error) {
+	var total int64
+	err := db.WithContext(ctx).Raw(`SELECT COALESCE(SUM(used_bytes), 0) FROM storage_usages`).Scan(&total).Error
+	return total, err
+}
+
+func (r *StorageUsageRepo) GetTotalStorageUsage(ctx context.Context) (int64, error) {
+	return GetTotalStorageUsage(ctx, r.db)
+}
+
+// ListStorageUsageByTopLevelDirectory sums the versions of the files of userID per
+// directory directly below the user's root directories. Files stored in a root directory
+// itself are reported under that root.
+func ListStorageUsageByTopLevelDirectory(ctx context.Context, db *gorm.DB, userID string) ([]models.StorageUsageBreakdown, error) {
+	breakdowns := []models.StorageUsageBreakdown{}
+	err := db.
+		WithContext(ctx).
+		Raw(`
+			WITH roots AS (
+				SELECT directory_id, name, full_path
+				FROM directories
+				WHERE user_id = ? AND (parent_directory_id IS NULL OR parent_directory_id = '')
+			), top_levels AS (
+				SELECT directories.directory_id, directories.name, directories.full_path
+				FROM directories
+				JOIN roots ON directories.parent_directory_id = roots.directory_id
+			)
+			SELECT top_levels.directory_id AS key, top_levels.name, SUM(file_versions.size) AS used_bytes
+			FROM top_levels
+			JOIN files ON files.full_path LIKE top_levels.full_path || '/%'
+			JOIN file_versions ON file_versions.file_id = files.file_id
+			WHERE files.user_id = ?
+			GROUP BY top_levels.directory_id, top_levels.name
+			UNION ALL
+			SELECT roots.directory_id AS key, roots.name, SUM(file_versions.size) AS used_bytes
+			FROM roots
+			JOIN files ON files.directory_id = roots.directory_id
+			JOIN file_versions ON file_versions.file_id = files.file_id
+			WHERE files.user_id = ?
+			GROUP BY roots.directory_id, roots.name
+			ORDER BY used_bytes DESC
+		`, userID, userID, userID).
+		Scan(&breakdowns).
+		Error
+	return breakdowns, err
+}
+
+func (r *StorageUsageRepo) ListStorageUsageByTopLevelDirectory(ctx context.Context, userID string) ([]models.StorageUsageBreakdown, error) {
+	return ListStorageUsageByTopLevelDirectory(ctx, r.db, userID)
+}
+
+// ListStorageUsageByMimeFamily sums the versions of the files of userID per MIME family,
+// the part of the MIME type before the slash such as "image" or "video".
+func ListStorageUsageByMimeFamily(ctx context.Context, db *gorm.DB, userID string) ([]models.StorageUsageBreakdown, error) {
+	breakdowns := []models.StorageUsageBreakdown{}
+	err := db.
+		WithContext(ctx).
+		Raw(`
+			SELECT SPLIT_PART(file_versions.extension, '/', 1) AS key, SPLIT_PART(file_versions.extension, '/', 1) AS name,
+				SUM(file_versions.size) AS used_bytes
+			FROM file_versions
+			JOIN files ON files.file_id = file_versions.file_id
+			WHERE files.user_id = ?
+			GROUP BY 1
+			ORDER BY used_bytes DESC
+		`, userID).
+		Scan(&breakdowns).
+		Error
+	return breakdowns, err
+}
+
+func (r *StorageUsageRepo) ListStorageUsageByMimeFamily(ctx context.Context, userID string) ([]models.StorageUsageBreakdown, error) {
+	return ListStorageUsageByMimeFamily(ctx, r.db, userID)
+}
@@ -0,0 +1,107 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type TwoFactorRepo struct {
+	db *gorm.DB
+}
+
+type TwoFactorRepoInterface interface {
+	GetTwoFactorByUserID(ctx context.Context, userID string, isForUpdate bool) (*models.TwoFactor, error)
+	SaveTwoFactor(ctx context.Context, twoFactor *models.TwoFactor) error
+	DeleteTwoFactor(ctx context.Context, userID string) error
+	CountUnusedRecoveryCodes(ctx context.Context, userID string) (int64, error)
+}
+
+func NewTwoFactorRepo(db *gorm.DB) TwoFactorRepoInterface {
+	return &TwoFactorRepo{db: db}
+}
+
+func GetTwoFactorByUserID(ctx context.Context, db *gorm.DB, userID string, isForUpdate bool) (*models.TwoFactor, error) {
+	twoFactor := &models.TwoFactor{}
+	query := db.WithContext(ctx).Where("user_id = ?", userID)
+	if isForUpdate {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return twoFactor, query.First(twoFactor).Error
+}
+
+func (r *TwoFactorRepo) GetTwoFactorByUserID(ctx context.Context, userID string, isForUpdate bool) (*models.TwoFactor, error) {
+	return GetTwoFactorByUserID(ctx, r.db, userID, isForUpdate)
+}
+
+// SaveTwoFactor creates the second factor of a user or replaces the existing one.
+func SaveTwoFactor(ctx context.Context, db *gorm.DB, twoFactor *models.TwoFactor) error {
+	return db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"secret", "enabled_at", "last_used_step", "updated_at"}),
+		}).
+		Create(twoFactor).
+		Error
+}
+
+func (r *TwoFactorRepo) SaveTwoFactor(ctx context.Context, twoFactor *models.TwoFactor) error {
+	return SaveTwoFactor(ctx, r.db, twoFactor)
+}
+
+// DeleteTwoFactor removes the second factor of userID together with its recovery codes.
+func DeleteTwoFactor(ctx context.Context, db *gorm.DB, userID string) error {
+	if err := db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	return db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.TwoFactor{}).Error
+}
+
+func (r *TwoFactorRepo) DeleteTwoFactor(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return DeleteTwoFactor(ctx, tx, userID)
+	})
+}
+
+// ReplaceRecoveryCodes drops every recovery code of userID in favour of codeHashes.
+func ReplaceRecoveryCodes(ctx context.Context, db *gorm.DB, userID string, codeHashes []string) error {
+	if err := db.WithContext(ctx).Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	recoveryCodes := make([]models.RecoveryCode, 0, len(codeHashes))
+	for _, codeHash := range codeHashes {
+		recoveryCodes = append(recoveryCodes, models.RecoveryCode{
+			UserID:    userID,
+			CodeHash:  codeHash,
+			CreatedAt: now,
+		})
+	}
+	return db.WithContext(ctx).Create(&recoveryCodes).Error
+}
+
+// UseRecoveryCode marks an unused recovery code of userID as used and reports whether
+// there was one.
+func UseRecoveryCode(ctx context.Context, db *gorm.DB, userID, codeHash string) (bool, error) {
+	result := db.
+		WithContext(ctx).
+		Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	return result.RowsAffected > 0, result.Error
+}
+
+func CountUnusedRecoveryCodes(ctx context.Context, db *gorm.DB, userID string) (int64, error) {
+	var count int64
+	err := db.WithContext(ctx).Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&count).Error
+	return count, err
+}
+
+func (r *TwoFactorRepo) CountUnusedRecoveryCodes(ctx context.Context, userID string) (int64, error) {
+	return CountUnusedRecoveryCodes(ctx, r.db, userID)
+}
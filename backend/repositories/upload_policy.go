@@ -0,0 +1,62 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type UploadPolicyRepo struct {
+	db *gorm.DB
+}
+
+type UploadPolicyRepoInterface interface {
+	GetUploadPolicyByDirectoryID(ctx context.Context, directoryID string) (*models.UploadPolicy, error)
+	ListUploadPoliciesByDirectoryIDs(ctx context.Context, directoryIDs []string) ([]models.UploadPolicy, error)
+	SaveUploadPolicy(ctx context.Context, uploadPolicy *models.UploadPolicy) error
+}
+
+func NewUploadPolicyRepo(db *gorm.DB) UploadPolicyRepoInterface {
+	return &UploadPolicyRepo{db: db}
+}
+
+func GetUploadPolicyByDirectoryID(ctx context.Context, db *gorm.DB, directoryID string) (*models.UploadPolicy, error) {
+	uploadPolicy := &models.UploadPolicy{}
+	err := db.WithContext(ctx).Where("directory_id = ?", directoryID).First(uploadPolicy).Error
+	return uploadPolicy, err
+}
+
+func (r *UploadPolicyRepo) GetUploadPolicyByDirectoryID(ctx context.Context, directoryID string) (*models.UploadPolicy, error) {
+	return GetUploadPolicyByDirectoryID(ctx, r.db, directoryID)
+}
+
+func ListUploadPoliciesByDirectoryIDs(ctx context.Context, db *gorm.DB, directoryIDs []string) ([]models.UploadPolicy, error) {
+	uploadPolicies := []models.UploadPolicy{}
+	if len(directoryIDs) == 0 {
+		return uploadPolicies, nil
+	}
+	err := db.WithContext(ctx).Where("directory_id IN ?", directoryIDs).Find(&uploadPolicies).Error
+	return uploadPolicies, err
+}
+
+func (r *UploadPolicyRepo) ListUploadPoliciesByDirectoryIDs(ctx context.Context, directoryIDs []string) ([]models.UploadPolicy, error) {
+	return ListUploadPoliciesByDirectoryIDs(ctx, r.db, directoryIDs)
+}
+
+// SaveUploadPolicy creates the policy of a directory or replaces the existing one.
+func SaveUploadPolicy(ctx context.Context, db *gorm.DB, uploadPolicy *models.UploadPolicy) error {
+	return db.
+		WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "directory_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"max_file_size", "allowed_mime_types", "allowed_extensions", "max_files", "updated_at"}),
+		}).
+		Create(uploadPolicy).
+		Error
+}
+
+func (r *UploadPolicyRepo) SaveUploadPolicy(ctx context.Context, uploadPolicy *models.UploadPolicy) error {
+	return SaveUploadPolicy(ctx, r.db, uploadPolicy)
+}
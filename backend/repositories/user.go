@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"dam/models"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -15,29 +16,140 @@ type UserRepoInterface interface {
 	CreateUser(ctx context.Context, user *models.User) error
 	GetUserByID(ctx context.Context, userID string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	ListUsersByIDs(ctx context.Context, userIDs []string) ([]models.User, error)
 }
 
 func NewUserRepo(db *gorm.DB) UserRepoInterface {
 	return &UserRepo{db: db}
 }
 
+func CreateUser(ctx context.Context, db *gorm.DB, user *models.User) error {
+	return db.WithContext(ctx).Create(user).Error
+}
+
 func (r *UserRepo) CreateUser(ctx context.Context, user *models.User) error {
-	return r.db.Create(user).WithContext(ctx).Error
+	return CreateUser(ctx, r.db, user)
+}
+
+func GetUserByID(ctx context.Context, db *gorm.DB, userID string) (*models.User, error) {
+	user := &models.User{}
+	err := db.WithContext(ctx).Where("user_id = ?", userID).First(user).Error
+	return user, err
 }
 
 func (r *UserRepo) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	return GetUserByID(ctx, r.db, userID)
+}
+
+func GetUserByEmail(ctx context.Context, db *gorm.DB, email string) (*models.User, error) {
 	user := &models.User{}
-	err := r.db.Where("user_id = ?", userID).First(user).WithContext(ctx).Error
+	err := db.WithContext(ctx).Where("email = ?", email).First(user).Error
 	return user, err
 }
 
 func (r *UserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	return GetUserByEmail(ctx, r.db, email)
+}
+
+func GetUserByUsername(ctx context.Context, db *gorm.DB, username string) (*models.User, error) {
 	user := &models.User{}
-	err := r.db.Where("email = ?", email).First(user).WithContext(ctx).Error
+	err := db.WithContext(ctx).Where("username = ?", username).First(user).Error
 	return user, err
 }
 
+func (r *UserRepo) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
+	return GetUserByUsername(ctx, r.db, username)
+}
+
+func UpdateUser(ctx context.Context, db *gorm.DB, user *models.User) error {
+	return db.WithContext(ctx).Save(user).Error
+}
+
 func (r *UserRepo) UpdateUser(ctx context.Context, user *models.User) error {
-	return r.db.Save(user).WithContext(ctx).Error
+	return UpdateUser(ctx, r.db, user)
+}
+
+func ListUsersByIDs(ctx context.Context, db *gorm.DB, userIDs []string) ([]models.User, error) {
+	users := []models.User{}
+	if len(userIDs) == 0 {
+		return users, nil
+	}
+	err := db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&users).Error
+	return users, err
+}
+
+func (r *UserRepo) ListUsersByIDs(ctx context.Context, userIDs []string) ([]models.User, error) {
+	return ListUsersByIDs(ctx, r.db, userIDs)
+}
+
+func ListUsersByUsernames(ctx context.Context, db *gorm.DB, usernames []string) ([]models.User, error) {
+	users := []models.User{}
+	if len(usernames) == 0 {
+		return users, nil
+	}
+	err := db.WithContext(ctx).Where("username IN ?", usernames).Find(&users).Error
+	return users, err
+}
+
+// ListUsersParams describes one page of the users an admin looks through, newest first.
+type ListUsersParams struct {
+	// Query matches part of the username, email or name, ignoring case.
+	Query    string
+	Role     string
+	Disabled *bool
+	Limit    int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *UserCursor
+}
+
+// UserCursor points at the last user of a page.
+type UserCursor struct {
+	CreatedAt time.Time `json:"c"`
+	UserID    string    `json:"id"`
+}
+
+type UsersPage struct {
+	Users      []models.User
+	NextCursor *UserCursor
+}
+
+func ListUsers(ctx context.Context, db *gorm.DB, params ListUsersParams) (*UsersPage, error) {
+	query := db.WithContext(ctx).Model(&models.User{})
+	if params.Query != "" {
+		pattern := "%" + escapeLike(params.Query) + "%"
+		query = query.Where("username ILIKE ? OR email ILIKE ? OR name ILIKE ?", pattern, pattern, pattern)
+	}
+	if params.Role != "" {
+		query = query.Where("role = ?", params.Role)
+	}
+	if params.Disabled != nil {
+		if *params.Disabled {
+			query = query.Where("disabled_at IS NOT NULL")
+		} else {
+			query = query.Where("disabled_at IS NULL")
+		}
+	}
+	if params.After != nil {
+		query = query.Where("(created_at, user_id) < (?, ?)", params.After.CreatedAt, params.After.UserID)
+	}
+
+	users := []models.User{}
+	err := query.
+		Order("created_at DESC, user_id DESC").
+		Limit(params.Limit + 1).
+		Find(&users).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &UsersPage{Users: users}
+	if len(users) > params.Limit {
+		page.Users = users[:params.Limit]
+		last := page.Users[params.Limit-1]
+		page.NextCursor = &UserCursor{CreatedAt: last.CreatedAt, UserID: last.UserID}
+	}
+	return page, nil
 }
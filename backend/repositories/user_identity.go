@@ -0,0 +1,39 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+)
+
+type UserIdentityRepo struct {
+	db *gorm.DB
+}
+
+type UserIdentityRepoInterface interface {
+	GetUserIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error)
+	CreateUserIdentity(ctx context.Context, userIdentity *models.UserIdentity) error
+}
+
+func NewUserIdentityRepo(db *gorm.DB) UserIdentityRepoInterface {
+	return &UserIdentityRepo{db: db}
+}
+
+func GetUserIdentity(ctx context.Context, db *gorm.DB, issuer, subject string) (*models.UserIdentity, error) {
+	userIdentity := &models.UserIdentity{}
+	err := db.WithContext(ctx).Where("issuer = ? AND subject = ?", issuer, subject).First(userIdentity).Error
+	return userIdentity, err
+}
+
+func (r *UserIdentityRepo) GetUserIdentity(ctx context.Context, issuer, subject string) (*models.UserIdentity, error) {
+	return GetUserIdentity(ctx, r.db, issuer, subject)
+}
+
+func CreateUserIdentity(ctx context.Context, db *gorm.DB, userIdentity *models.UserIdentity) error {
+	return db.WithContext(ctx).Create(userIdentity).Error
+}
+
+func (r *UserIdentityRepo) CreateUserIdentity(ctx context.Context, userIdentity *models.UserIdentity) error {
+	return CreateUserIdentity(ctx, r.db, userIdentity)
+}
@@ -53,3 +53,13 @@ func GetUserSettingsByUserID(ctx context.Context, db *gorm.DB, userID string, is
 func (r *userSettingRepo) GetUserSettingsByUserID(ctx context.Context, userID string, isForUpdate bool) (*models.UserSetting, error) {
 	return GetUserSettingsByUserID(ctx, r.db, userID, isForUpdate)
 }
+
+// ListUserSettingsByUserIDs returns the settings of those of the given users who have any.
+func ListUserSettingsByUserIDs(ctx context.Context, db *gorm.DB, userIDs []string) ([]models.UserSetting, error) {
+	userSettings := []models.UserSetting{}
+	if len(userIDs) == 0 {
+		return userSettings, nil
+	}
+	err := db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&userSettings).Error
+	return userSettings, err
+}
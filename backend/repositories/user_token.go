@@ -0,0 +1,45 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func CreateUserToken(ctx context.Context, db *gorm.DB, token *models.UserToken) error {
+	return db.WithContext(ctx).Create(token).Error
+}
+
+// ConsumeUserToken marks the token stored under tokenHash as used and returns it. It
+// returns gorm.ErrRecordNotFound unless the token is meant for purpose, unused and not
+// expired.
+func ConsumeUserToken(ctx context.Context, db *gorm.DB, tokenHash, purpose string) (*models.UserToken, error) {
+	token := &models.UserToken{}
+	now := time.Now()
+	err := db.
+		WithContext(ctx).
+		Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", tokenHash, purpose, now).
+		First(token).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	token.UsedAt = &now
+	return token, db.WithContext(ctx).Model(&models.UserToken{}).Where("token_hash = ?", tokenHash).Update("used_at", now).Error
+}
+
+// InvalidateUserTokens marks every unused token of userID for purpose as used, so that
+// only the latest one emailed works or none after it served its purpose.
+func InvalidateUserTokens(ctx context.Context, db *gorm.DB, userID, purpose string) error {
+	return db.
+		WithContext(ctx).
+		Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).
+		Error
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"dam/enums"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type VersionReviewRepo struct {
+	db *gorm.DB
+}
+
+type VersionReviewRepoInterface interface {
+	ListVersionReviews(ctx context.Context, fileVersionID string) ([]models.VersionReview, error)
+	ListPendingReviews(ctx context.Context, params ListPendingReviewsParams) (*PendingReviewsPage, error)
+}
+
+func NewVersionReviewRepo(db *gorm.DB) VersionReviewRepoInterface {
+	return &VersionReviewRepo{db: db}
+}
+
+// ListVersionReviews returns the reviews asked for a file version, in the order they were
+// asked for.
+func ListVersionReviews(ctx context.Context, db *gorm.DB, fileVersionID string) ([]models.VersionReview, error) {
+	reviews := []models.VersionReview{}
+	err := db.
+		WithContext(ctx).
+		Where("file_version_id = ?", fileVersionID).
+		Order("requested_at, reviewer_id").
+		Find(&reviews).
+		Error
+	return reviews, err
+}
+
+func (r *VersionReviewRepo) ListVersionReviews(ctx context.Context, fileVersionID string) ([]models.VersionReview, error) {
+	return ListVersionReviews(ctx, r.db, fileVersionID)
+}
+
+// ReplaceVersionReviews drops the reviews of a previous round on a file version and asks
+// for reviews.
+func ReplaceVersionReviews(ctx context.Context, db *gorm.DB, fileVersionID string, reviews []models.VersionReview) error {
+	if err := db.WithContext(ctx).Where("file_version_id = ?", fileVersionID).Delete(&models.VersionReview{}).Error; err != nil {
+		return err
+	}
+	if len(reviews) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Create(&reviews).Error
+}
+
+// DecideVersionReview records the answer of reviewerID. The row is keyed by two columns,
+// which Save cannot tell, hence the explicit condition.
+func DecideVersionReview(ctx context.Context, db *gorm.DB, review *models.VersionReview) error {
+	return db.
+		WithContext(ctx).
+		Model(&models.VersionReview{}).
+		Where("file_version_id = ? AND reviewer_id = ?", review.FileVersionID, review.ReviewerID).
+		Updates(map[string]interface{}{
+			"decision":   review.Decision,
+			"comment":    review.Comment,
+			"decided_at": review.DecidedAt,
+		}).
+		Error
+}
+
+// ListPendingReviewsParams describes one page of the reviews a user has yet to answer,
+// newest first.
+type ListPendingReviewsParams struct {
+	ReviewerID string
+	Limit      int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *PendingReviewCursor
+}
+
+// PendingReviewCursor points at the last review of a page.
+type PendingReviewCursor struct {
+	RequestedAt   time.Time `json:"c"`
+	FileVersionID string    `json:"id"`
+}
+
+type PendingReviewsPage struct {
+	Reviews    []models.VersionReview
+	NextCursor *PendingReviewCursor
+}
+
+// ListPendingReviews leaves out the reviews of versions no longer in review, which another
+// reviewer rejected before the user answered.
+func ListPendingReviews(ctx context.Context, db *gorm.DB, params ListPendingReviewsParams) (*PendingReviewsPage, error) {
+	query := db.
+		WithContext(ctx).
+		Model(&models.VersionReview{}).
+		Select("version_reviews.*").
+		Joins("JOIN file_versions ON file_versions.file_version_id = version_reviews.file_version_id").
+		Where("version_reviews.reviewer_id = ? AND version_reviews.decision = ?", params.ReviewerID, enums.ReviewDecisionPending).
+		Where("file_versions.review_status = ?", enums.ReviewStatusInReview)
+	if params.After != nil {
+		query = query.Where("(version_reviews.requested_at, version_reviews.file_version_id) < (?, ?)", params.After.RequestedAt, params.After.FileVersionID)
+	}
+
+	reviews := []models.VersionReview{}
+	err := query.
+		Order("version_reviews.requested_at DESC, version_reviews.file_version_id DESC").
+		Limit(params.Limit + 1).
+		Find(&reviews).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &PendingReviewsPage{Reviews: reviews}
+	if len(reviews) > params.Limit {
+		page.Reviews = reviews[:params.Limit]
+		last := page.Reviews[params.Limit-1]
+		page.NextCursor = &PendingReviewCursor{RequestedAt: last.RequestedAt, FileVersionID: last.FileVersionID}
+	}
+	return page, nil
+}
+
+func (r *VersionReviewRepo) ListPendingReviews(ctx context.Context, params ListPendingReviewsParams) (*PendingReviewsPage, error) {
+	return ListPendingReviews(ctx, r.db, params)
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"dam/models"
+
+	"gorm.io/gorm"
+)
+
+type WebhookRepo struct {
+	db *gorm.DB
+}
+
+type WebhookRepoInterface interface {
+	GetWebhookByID(ctx context.Context, userID, webhookID string) (*models.Webhook, error)
+	ListWebhooksByUserID(ctx context.Context, userID string) ([]models.Webhook, error)
+}
+
+func NewWebhookRepo(db *gorm.DB) WebhookRepoInterface {
+	return &WebhookRepo{db: db}
+}
+
+func CreateWebhook(ctx context.Context, db *gorm.DB, webhook *models.Webhook) error {
+	return db.WithContext(ctx).Create(webhook).Error
+}
+
+func UpdateWebhook(ctx context.Context, db *gorm.DB, webhook *models.Webhook) error {
+	return db.WithContext(ctx).Where("webhook_id = ?", webhook.WebhookID).Save(webhook).Error
+}
+
+// DeleteWebhook deletes a webhook of userID along with its deliveries and reports whether
+// there was one.
+func DeleteWebhook(ctx context.Context, db *gorm.DB, userID, webhookID string) (bool, error) {
+	result := db.
+		WithContext(ctx).
+		Where("webhook_id = ? AND user_id = ?", webhookID, userID).
+		Delete(&models.Webhook{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetWebhookByID returns the webhook only when userID owns it.
+func GetWebhookByID(ctx context.Context, db *gorm.DB, userID, webhookID string) (*models.Webhook, error) {
+	webhook := &models.Webhook{}
+	err := db.WithContext(ctx).Where("webhook_id = ? AND user_id = ?", webhookID, userID).First(webhook).Error
+	return webhook, err
+}
+
+func (r *WebhookRepo) GetWebhookByID(ctx context.Context, userID, webhookID string) (*models.Webhook, error) {
+	return GetWebhookByID(ctx, r.db, userID, webhookID)
+}
+
+func ListWebhooksByUserID(ctx context.Context, db *gorm.DB, userID string) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&webhooks).Error
+	return webhooks, err
+}
+
+func (r *WebhookRepo) ListWebhooksByUserID(ctx context.Context, userID string) ([]models.Webhook, error) {
+	return ListWebhooksByUserID(ctx, r.db, userID)
+}
+
+// ListActiveWebhooks returns the webhooks which are on and whose owner is not disabled.
+func ListActiveWebhooks(ctx context.Context, db *gorm.DB) ([]models.Webhook, error) {
+	webhooks := []models.Webhook{}
+	err := db.
+		WithContext(ctx).
+		Joins("JOIN users ON users.user_id = webhooks.user_id").
+		Where("webhooks.active AND users.disabled_at IS NULL").
+		Find(&webhooks).
+		Error
+	return webhooks, err
+}
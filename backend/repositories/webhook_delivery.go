@@ -0,0 +1,119 @@
+package repositories
+
+import (
+	"context"
+	"dam/enums"
+	"dam/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type WebhookDeliveryRepo struct {
+	db *gorm.DB
+}
+
+type WebhookDeliveryRepoInterface interface {
+	ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) (*WebhookDeliveriesPage, error)
+}
+
+func NewWebhookDeliveryRepo(db *gorm.DB) WebhookDeliveryRepoInterface {
+	return &WebhookDeliveryRepo{db: db}
+}
+
+func CreateWebhookDeliveries(ctx context.Context, db *gorm.DB, deliveries []models.WebhookDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Create(&deliveries).Error
+}
+
+func UpdateWebhookDelivery(ctx context.Context, db *gorm.DB, delivery *models.WebhookDelivery) error {
+	return db.WithContext(ctx).Where("webhook_delivery_id = ?", delivery.WebhookDeliveryID).Save(delivery).Error
+}
+
+// ClaimDueWebhookDeliveries returns up to limit pending deliveries due at now and pushes
+// their next attempt to leaseUntil, so that no other instance attempts them meanwhile and
+// they are attempted again should this one stop before recording the outcome.
+func ClaimDueWebhookDeliveries(ctx context.Context, db *gorm.DB, now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	deliveries := []models.WebhookDelivery{}
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", enums.WebhookDeliveryPending, now).
+			Order("next_attempt_at").
+			Limit(limit).
+			Find(&deliveries).
+			Error
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+
+		deliveryIDs := make([]string, 0, len(deliveries))
+		for i := range deliveries {
+			deliveryIDs = append(deliveryIDs, deliveries[i].WebhookDeliveryID)
+			deliveries[i].NextAttemptAt = &leaseUntil
+		}
+		return tx.
+			Model(&models.WebhookDelivery{}).
+			Where("webhook_delivery_id IN ?", deliveryIDs).
+			Update("next_attempt_at", leaseUntil).
+			Error
+	})
+	return deliveries, err
+}
+
+// ListWebhookDeliveriesParams describes one page of the deliveries of a webhook, newest
+// first.
+type ListWebhookDeliveriesParams struct {
+	WebhookID string
+	// Status only lists the deliveries in this status when set.
+	Status string
+	Limit  int
+	// After is the cursor returned with the previous page, nil for the first page.
+	After *WebhookDeliveryCursor
+}
+
+// WebhookDeliveryCursor points at the last delivery of a page.
+type WebhookDeliveryCursor struct {
+	CreatedAt         time.Time `json:"c"`
+	WebhookDeliveryID string    `json:"id"`
+}
+
+type WebhookDeliveriesPage struct {
+	Deliveries []models.WebhookDelivery
+	NextCursor *WebhookDeliveryCursor
+}
+
+func ListWebhookDeliveries(ctx context.Context, db *gorm.DB, params ListWebhookDeliveriesParams) (*WebhookDeliveriesPage, error) {
+	query := db.WithContext(ctx).Model(&models.WebhookDelivery{}).Where("webhook_id = ?", params.WebhookID)
+	if params.Status != "" {
+		query = query.Where("status = ?", params.Status)
+	}
+	if params.After != nil {
+		query = query.Where("(created_at, webhook_delivery_id) < (?, ?)", params.After.CreatedAt, params.After.WebhookDeliveryID)
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	err := query.
+		Order("created_at DESC, webhook_delivery_id DESC").
+		Limit(params.Limit + 1).
+		Find(&deliveries).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	page := &WebhookDeliveriesPage{Deliveries: deliveries}
+	if len(deliveries) > params.Limit {
+		page.Deliveries = deliveries[:params.Limit]
+		last := page.Deliveries[params.Limit-1]
+		page.NextCursor = &WebhookDeliveryCursor{CreatedAt: last.CreatedAt, WebhookDeliveryID: last.WebhookDeliveryID}
+	}
+	return page, nil
+}
+
+func (r *WebhookDeliveryRepo) ListWebhookDeliveries(ctx context.Context, params ListWebhookDeliveriesParams) (*WebhookDeliveriesPage, error) {
+	return ListWebhookDeliveries(ctx, r.db, params)
+}